@@ -6,6 +6,10 @@ type LetsDANERecord struct {
 	Host          string
 	DANEValidated string
 	Error         string
+	// Started, TLSALookup and Finished are empty in the results of letsdane before they were recorded.
+	Started    string
+	TLSALookup string
+	Finished   string
 }
 
 func ConvertLetsDANERecords(records [][]string) LetsDANERecords {
@@ -16,11 +20,17 @@ func ConvertLetsDANERecords(records [][]string) LetsDANERecords {
 
 	for _, record := range records[1:] {
 
-		r = append(r, LetsDANERecord{
+		letsDANERecord := LetsDANERecord{
 			Host:          record[0],
 			DANEValidated: record[1],
 			Error:         record[2],
-		})
+		}
+		if len(record) >= 6 {
+			letsDANERecord.Started = record[3]
+			letsDANERecord.TLSALookup = record[4]
+			letsDANERecord.Finished = record[5]
+		}
+		r = append(r, letsDANERecord)
 
 	}
 	return r
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yagikota/danewebperf/cmd/dane-check/model"
+	"github.com/yagikota/danewebperf/cmd/pageloadtime/har"
+	"github.com/yagikota/danewebperf/storage"
+)
+
+const (
+	awsProfile = "default"
+	awsRegion  = "ap-northeast-1"
+	s3Bucket   = "pageloadtime-results"
+
+	outPutFilePath = "../../analysis/dane-join.csv"
+
+	// defaultTolerance is how far a tunnel of letsdane may start outside the connect phase of a HAR entry,
+	// because the times of the HAR are in milliseconds.
+	defaultTolerance = 100 * time.Millisecond
+)
+
+// match is how a HAR entry is joined with a tunnel of letsdane.
+type match string
+
+const (
+	// matchConnect is an entry which opened a connection, and the tunnel was established for it.
+	matchConnect match = "connect"
+	// matchReused is an entry which reused the connection of an earlier entry, and so its tunnel.
+	matchReused match = "reused"
+	// matchHTTP is an entry which is not https, so no tunnel was established for it.
+	matchHTTP match = "http"
+	// matchNone is an entry without a tunnel in the time window, e.g. one served from the cache of Firefox.
+	matchNone match = "none"
+)
+
+var logger *slog.Logger
+
+// readCSV reads all records of the csv file in the result store.
+func readCSV(ctx context.Context, store storage.ResultStore, key storage.Key) ([][]string, error) {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	reader := csv.NewReader(body)
+	// the results of an old letsdane have no timing columns.
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
+
+// readHAR reads the HAR file in the result store.
+func readHAR(ctx context.Context, store storage.ResultStore, key storage.Key) (*har.Har, error) {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var h har.Har
+	if err := json.NewDecoder(body).Decode(&h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// tunnel is a CONNECT request handled by letsdane.
+type tunnel struct {
+	model.LetsDANERecord
+	started  time.Time
+	finished time.Time
+	used     bool
+}
+
+func newTunnels(records model.LetsDANERecords) ([]*tunnel, error) {
+	tunnels := make([]*tunnel, 0, len(records))
+	for _, record := range records {
+		if record.Started == "" {
+			return nil, fmt.Errorf("no timing of the tunnel to %s, which is not recorded by an old letsdane", record.Host)
+		}
+		started, err := time.Parse(time.RFC3339Nano, record.Started)
+		if err != nil {
+			return nil, err
+		}
+		finished, err := time.Parse(time.RFC3339Nano, record.Finished)
+		if err != nil {
+			return nil, err
+		}
+		tunnels = append(tunnels, &tunnel{LetsDANERecord: record, started: started, finished: finished})
+	}
+	return tunnels, nil
+}
+
+// JoinedRecord is a HAR entry and the tunnel of letsdane for it.
+type JoinedRecord struct {
+	MeasurementID string
+	// Measurement is the HAR file name without the extension, e.g. example.com-with-cache-with-dane.
+	Measurement string
+	Domain      string
+	// Index is the index of the entry in the HAR file.
+	Index           int
+	StartedDateTime time.Time
+	har.Record
+	Match  match
+	Tunnel *tunnel
+	// TunnelOffset is the time from the start of the connect phase of the entry to the start of the tunnel.
+	// It is only for matchConnect.
+	TunnelOffset time.Duration
+}
+
+// connectPhase returns when the entry started and finished to connect. Firefox connects to the server through
+// letsdane in this phase.
+func connectPhase(entry har.Entry) (time.Time, time.Time) {
+	milliseconds := func(ms int) time.Duration {
+		return time.Duration(max(ms, 0)) * time.Millisecond
+	}
+	start := entry.StartedDateTime.Add(milliseconds(entry.Timings.Blocked) + milliseconds(entry.Timings.DNS))
+	return start, start.Add(milliseconds(entry.Timings.Connect))
+}
+
+// join matches each entry of the HAR file with the tunnel to the same host in its connect phase.
+// The entries which reused a connection are matched with the tunnel of that connection.
+func join(h *har.Har, tunnels []*tunnel, tolerance time.Duration) []JoinedRecord {
+	entries := h.Entries()
+	indexes := make([]int, len(entries))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	// the tunnels are taken by the entries in the order they started.
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return entries[indexes[i]].StartedDateTime.Before(entries[indexes[j]].StartedDateTime)
+	})
+
+	// connections are the tunnels by the host and the connection of the entries.
+	connections := make(map[string]*tunnel)
+	var joined []JoinedRecord
+	for _, i := range indexes {
+		entry := entries[i]
+		record, err := h.ConvertEntry(entry)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("unable to convert the entry %d, %v", i, err))
+			continue
+		}
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			continue
+		}
+		host := u.Hostname()
+		connection := host + "/" + entry.Connection
+
+		r := JoinedRecord{Index: i, StartedDateTime: entry.StartedDateTime, Record: record, Match: matchNone}
+		connectStart, connectEnd := connectPhase(entry)
+		switch {
+		case u.Scheme != "https":
+			r.Match = matchHTTP
+		case entry.Timings.Connect > 0:
+			var best *tunnel
+			for _, t := range tunnels {
+				if t.used || t.Host != host || t.started.Before(connectStart.Add(-tolerance)) || t.started.After(connectEnd.Add(tolerance)) {
+					continue
+				}
+				if best == nil || (t.started.Sub(connectStart)).Abs() < (best.started.Sub(connectStart)).Abs() {
+					best = t
+				}
+			}
+			if best != nil {
+				best.used = true
+				connections[connection] = best
+				r.Match = matchConnect
+				r.Tunnel = best
+				r.TunnelOffset = best.started.Sub(connectStart)
+			}
+		default:
+			t, ok := connections[connection]
+			if !ok || entry.Connection == "" {
+				t = lastTunnel(tunnels, host, entry.StartedDateTime.Add(tolerance))
+			}
+			if t != nil {
+				r.Match = matchReused
+				r.Tunnel = t
+			}
+		}
+		joined = append(joined, r)
+	}
+	return joined
+}
+
+// lastTunnel returns the tunnel to the host which was used by an entry and started last before the time.
+func lastTunnel(tunnels []*tunnel, host string, before time.Time) *tunnel {
+	var last *tunnel
+	for _, t := range tunnels {
+		if !t.used || t.Host != host || t.started.After(before) {
+			continue
+		}
+		if last == nil || t.started.After(last.started) {
+			last = t
+		}
+	}
+	return last
+}
+
+func formatMilliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+func exportResultAsCSV(result []JoinedRecord, filPath string) error {
+	file, err := os.OpenFile(filPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	// write the header only if the file is empty
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if fileInfo.Size() == 0 {
+		if err := writer.Write([]string{
+			"measurementID", "measurement", "domain", "index", "started_date_time", "status", "method", "host", "file",
+			"blocked_ms", "dns_ms", "connect_ms", "tls_ms", "wait_ms",
+			"match", "dane_validated", "error", "tlsa_lookup_ms", "tunnel_started", "tunnel_ms", "tunnel_offset_ms",
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range result {
+		csvRecord := []string{
+			r.MeasurementID,
+			r.Measurement,
+			r.Domain,
+			strconv.Itoa(r.Index),
+			r.StartedDateTime.Format(time.RFC3339Nano),
+			r.Status,
+			r.Method,
+			r.Record.Domain,
+			r.File,
+			r.Transaction.Blocked,
+			r.Transaction.DNSResolution,
+			r.Transaction.Connecting,
+			r.Transaction.TLSSetup,
+			r.Transaction.Waiting,
+			string(r.Match),
+		}
+		if r.Tunnel != nil {
+			csvRecord = append(csvRecord,
+				r.Tunnel.DANEValidated,
+				r.Tunnel.Error,
+				r.Tunnel.TLSALookup,
+				r.Tunnel.Started,
+				formatMilliseconds(r.Tunnel.finished.Sub(r.Tunnel.started)),
+			)
+			if r.Match == matchConnect {
+				csvRecord = append(csvRecord, formatMilliseconds(r.TunnelOffset))
+			} else {
+				csvRecord = append(csvRecord, "")
+			}
+		} else {
+			csvRecord = append(csvRecord, "", "", "", "", "", "")
+		}
+		if err := writer.Write(csvRecord); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	start := time.Now()
+	log.Println("start time: ", start.Format("2006-01-02-15-04-05"))
+
+	measurementID := flag.String("measurementID", "", "measurementID. if empty, all finished measurements in the result store are processed")
+	includeLegacy := flag.Bool("include-legacy", false, "without -measurementID, also process the measurements without manifest.json, which were run by an old pageloadtime")
+	outPutFilePath := flag.String("outPutFilePath", outPutFilePath, "outPutFilePath")
+	tolerance := flag.Duration("tolerance", defaultTolerance, "how far a tunnel of letsdane may start outside the connect phase of a HAR entry")
+	storeConfig := storage.Config{
+		URL:     "s3://" + s3Bucket,
+		Region:  awsRegion,
+		Profile: awsProfile,
+	}
+	storeConfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	ctx := context.Background()
+	store, err := storage.New(storeConfig)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var result []JoinedRecord
+
+	measurementIDs := []string{*measurementID}
+	if *measurementID == "" {
+		// the measurements without a finished manifest are still running, failed, or run by an old pageloadtime.
+		var skipped []string
+		measurementIDs, skipped, err = storage.FinishedMeasurementIDs(ctx, store, *includeLegacy)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, id := range skipped {
+			logger.Warn(fmt.Sprintf("skip %s without manifest.json, use -include-legacy to process it", id))
+		}
+		if len(measurementIDs) == 0 {
+			log.Fatalf("no finished measurement in %s", storeConfig.URL)
+		}
+		logger.Info(fmt.Sprintf("finished measurements in %s: %s", storeConfig.URL, strings.Join(measurementIDs, ", ")))
+	}
+
+	var keys []storage.Key
+	for _, id := range measurementIDs {
+		logger.Info(fmt.Sprintf("listing DANE validation results in %s of %s", id, storeConfig.URL))
+		measurementKeys, err := store.List(ctx, storage.Filter{MeasurementID: id, Kind: storage.KindDANEValidation})
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to list DANE validation results, %v", err))
+			continue
+		}
+		keys = append(keys, measurementKeys...)
+	}
+
+	for idx, key := range keys {
+		logger.Info(fmt.Sprintf("now processing %s (%d/%d) %f%%", key.Path(), idx+1, len(keys), float64(idx+1)/float64(len(keys))*100))
+
+		records, err := readCSV(ctx, store, key)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to read csv file %q, %v", key.Path(), err))
+			continue
+		}
+		tunnels, err := newTunnels(model.ConvertLetsDANERecords(records))
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to read tunnels in %q, %v", key.Path(), err))
+			continue
+		}
+
+		// letsdane-example.com-with-cache-with-dane.csv is of example.com-with-cache-with-dane.har
+		measurement := strings.TrimSuffix(strings.TrimPrefix(key.Name, "letsdane-"), filepath.Ext(key.Name))
+		harKey := key
+		harKey.Name = measurement + ".har"
+		h, err := readHAR(ctx, store, harKey)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to read har file %q, %v", harKey.Path(), err))
+			continue
+		}
+
+		joined := join(h, tunnels, *tolerance)
+		unmatched := 0
+		for _, t := range tunnels {
+			if !t.used {
+				unmatched++
+			}
+		}
+		if unmatched > 0 {
+			logger.Info(fmt.Sprintf("%d of %d tunnels in %s have no HAR entry", unmatched, len(tunnels), key.Path()))
+		}
+
+		for i := range joined {
+			joined[i].MeasurementID = key.MeasurementID
+			joined[i].Measurement = measurement
+			joined[i].Domain = key.Domain
+		}
+		result = append(result, joined...)
+	}
+
+	if err := exportResultAsCSV(result, *outPutFilePath); err != nil {
+		logger.Error(fmt.Sprintf("unable to export result as csv, %v", err))
+	}
+
+	logger.Info(fmt.Sprintf("elapsed time: %f min", time.Since(start).Minutes()))
+	logger.Info("done")
+}
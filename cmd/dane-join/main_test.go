@@ -0,0 +1,179 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yagikota/danewebperf/cmd/dane-check/model"
+	"github.com/yagikota/danewebperf/cmd/pageloadtime/har"
+)
+
+var base = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func at(ms int) time.Time {
+	return base.Add(time.Duration(ms) * time.Millisecond)
+}
+
+// testEntry is a HAR entry which starts at the millisecond from base.
+type testEntry struct {
+	url        string
+	started    int
+	blocked    int
+	dns        int
+	connect    int
+	connection string
+}
+
+func (e testEntry) entry() har.Entry {
+	return har.Entry{
+		StartedDateTime: at(e.started),
+		Request:         har.Request{Method: "GET", URL: e.url},
+		Timings:         har.Timings{Blocked: e.blocked, DNS: e.dns, Connect: e.connect},
+		Connection:      e.connection,
+	}
+}
+
+// testTunnel is a tunnel of letsdane which starts at the millisecond from base.
+type testTunnel struct {
+	host    string
+	started int
+}
+
+// wantJoin is the match of the entry at the index of the HAR file, and the index of its tunnel or -1.
+type wantJoin struct {
+	match  match
+	tunnel int
+}
+
+func TestConnectPhase(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry     testEntry
+		wantStart int
+		wantEnd   int
+	}{
+		{"after blocked and dns", testEntry{started: 1000, blocked: 5, dns: 10, connect: 30}, 1015, 1045},
+		// -1 is a timing which does not apply to the entry.
+		{"timings which do not apply", testEntry{started: 1000, blocked: -1, dns: -1, connect: -1}, 1000, 1000},
+	}
+	for _, test := range tests {
+		start, end := connectPhase(test.entry.entry())
+		if !start.Equal(at(test.wantStart)) || !end.Equal(at(test.wantEnd)) {
+			t.Errorf("%s: connectPhase() = %s, %s, want %s, %s", test.name, start, end, at(test.wantStart), at(test.wantEnd))
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tolerance := 100 * time.Millisecond
+	tests := []struct {
+		name    string
+		entries []testEntry
+		tunnels []testTunnel
+		want    []wantJoin
+	}{
+		{
+			name:    "no tunnel to the host",
+			entries: []testEntry{{url: "https://example.com/", started: 1000, connect: 30, connection: "1"}},
+			tunnels: []testTunnel{{host: "cdn.example.com", started: 1000}},
+			want:    []wantJoin{{matchNone, -1}},
+		},
+		{
+			name:    "tunnel out of the connect phase",
+			entries: []testEntry{{url: "https://example.com/", started: 1000, connect: 30, connection: "1"}},
+			tunnels: []testTunnel{{host: "example.com", started: 500}, {host: "example.com", started: 1500}},
+			want:    []wantJoin{{matchNone, -1}},
+		},
+		{
+			name:    "http",
+			entries: []testEntry{{url: "http://example.com/", started: 1000, connect: 30, connection: "1"}},
+			tunnels: []testTunnel{{host: "example.com", started: 1000}},
+			want:    []wantJoin{{matchHTTP, -1}},
+		},
+		{
+			name: "within the tolerance",
+			entries: []testEntry{
+				// the connect phase is 1010-1040.
+				{url: "https://a.example/", started: 1000, dns: 10, connect: 30, connection: "1"},
+				{url: "https://b.example/", started: 1000, dns: 10, connect: 30, connection: "2"},
+				{url: "https://c.example/", started: 1000, dns: 10, connect: 30, connection: "3"},
+				{url: "https://d.example/", started: 1000, dns: 10, connect: 30, connection: "4"},
+			},
+			tunnels: []testTunnel{
+				{host: "a.example", started: 920},
+				{host: "b.example", started: 1130},
+				{host: "c.example", started: 900},
+				{host: "d.example", started: 1150},
+			},
+			want: []wantJoin{{matchConnect, 0}, {matchConnect, 1}, {matchNone, -1}, {matchNone, -1}},
+		},
+		{
+			name: "several tunnels to the host",
+			entries: []testEntry{
+				{url: "https://example.com/", started: 1000, connect: 30, connection: "1"},
+				{url: "https://example.com/style.css", started: 1010, connect: 30, connection: "2"},
+				{url: "https://example.com/script.js", started: 1020, connect: 30, connection: "3"},
+			},
+			tunnels: []testTunnel{
+				{host: "example.com", started: 1011},
+				{host: "example.com", started: 1001},
+				{host: "example.com", started: 3000},
+			},
+			// a tunnel is taken by only one entry, the first one which started nearest to it.
+			want: []wantJoin{{matchConnect, 1}, {matchConnect, 0}, {matchNone, -1}},
+		},
+		{
+			name: "no connect phase",
+			entries: []testEntry{
+				{url: "https://example.com/", started: 1000, connect: 30, connection: "1"},
+				{url: "https://example.com/next", started: 2000, connect: 30, connection: "2"},
+				// reuses the connection 1, not the later connection 2.
+				{url: "https://example.com/style.css", started: 3000, connect: -1, connection: "1"},
+				// without a connection, the last tunnel started before the entry.
+				{url: "https://example.com/script.js", started: 3000, connect: 0},
+				{url: "https://example.com/early.js", started: 1500, connect: -1},
+				// no tunnel to the host was taken by an entry with a connect phase.
+				{url: "https://cdn.example.com/image.png", started: 3000, connect: -1, connection: "3"},
+			},
+			tunnels: []testTunnel{
+				{host: "example.com", started: 1000},
+				{host: "example.com", started: 2000},
+				{host: "cdn.example.com", started: 2500},
+			},
+			want: []wantJoin{
+				{matchConnect, 0},
+				{matchConnect, 1},
+				{matchReused, 0},
+				{matchReused, 1},
+				{matchReused, 0},
+				{matchNone, -1},
+			},
+		},
+	}
+	for _, test := range tests {
+		h := &har.Har{}
+		for _, e := range test.entries {
+			h.Log.Entries = append(h.Log.Entries, e.entry())
+		}
+		var tunnels []*tunnel
+		for _, tt := range test.tunnels {
+			tunnels = append(tunnels, &tunnel{LetsDANERecord: model.LetsDANERecord{Host: tt.host}, started: at(tt.started), finished: at(tt.started + 50)})
+		}
+
+		joined := join(h, tunnels, tolerance)
+		if len(joined) != len(test.want) {
+			t.Errorf("%s: len(join()) = %d, want %d", test.name, len(joined), len(test.want))
+			continue
+		}
+		for _, r := range joined {
+			want := test.want[r.Index]
+			var wantTunnel *tunnel
+			if want.tunnel >= 0 {
+				wantTunnel = tunnels[want.tunnel]
+			}
+			if r.Match != want.match || r.Tunnel != wantTunnel {
+				t.Errorf("%s: entry %d = %s with %+v, want %s with tunnel %d", test.name, r.Index, r.Match, r.Tunnel, want.match, want.tunnel)
+			}
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"os"
 	"sync"
 	"time"
+
+	"github.com/yagikota/danewebperf/utils"
 )
 
 var (
@@ -53,22 +55,26 @@ type DomainIP struct {
 	IP     string
 }
 
+// readDomainIPCSV reads the output of zdns/a-record, whose header is domain,ip.
 func readDomainIPCSV(filePath string) (DomainIPs, error) {
-	var domainIPs DomainIPs
-	file, err := os.Open(filePath)
+	dataset, err := utils.ReadDataset(filePath)
 	if err != nil {
-		return domainIPs, err
+		return nil, err
 	}
-	defer file.Close()
-	reader := csv.NewReader(file)
-	rows, err := reader.ReadAll()
-	if err != nil {
-		return domainIPs, err
+	for _, rejected := range dataset.Rejected {
+		logger.Warn(fmt.Sprintf("skip %s of %s", rejected, filePath))
 	}
-	for _, row := range rows[1:] {
+
+	var domainIPs DomainIPs
+	for _, record := range dataset.Records {
+		ip := record.Metadata.Get("ip")
+		if ip == "" {
+			logger.Warn(fmt.Sprintf("skip %s of %s: ip is empty", record.Domain, filePath))
+			continue
+		}
 		domainIPs = append(domainIPs, DomainIP{
-			Domain: row[0],
-			IP:     row[1],
+			Domain: record.Domain,
+			IP:     ip,
 		})
 	}
 	return domainIPs, nil
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"flag"
 	"fmt"
@@ -12,11 +13,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/client"
-	"github.com/aws/aws-sdk-go/aws/request"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/yagikota/danewebperf/storage"
 )
 
 const (
@@ -27,44 +24,7 @@ const (
 	outPutFilePath = "../../analysis/pageload-status-code-info.csv"
 )
 
-var (
-	logger         *slog.Logger
-	measurementIDs = []string{
-		"tokyo-v2-01",
-		"tokyo-v2-02",
-		"tokyo-v2-03",
-		"tokyo-v2-04",
-		"tokyo-v2-05",
-		// "tokyo-v2-06",
-		"tokyo-v2-07",
-		"tokyo-v2-08",
-		"tokyo-v2-09",
-		"tokyo-v2-10",
-		"frankfurt-v2-01",
-		"frankfurt-v2-02",
-		"frankfurt-v2-03",
-		"frankfurt-v2-04",
-		"frankfurt-v2-05",
-		// "frankfurt-v2-06",
-		"frankfurt-v2-07",
-		"frankfurt-v2-08",
-		"frankfurt-v2-09",
-		"frankfurt-v2-10",
-	}
-)
-
-// tokyo-01/example.com/example.com-with-cache-with-dane.csv
-func targetCSV(s3ObjectKey string) (bool, string) {
-	splitKey := strings.Split(s3ObjectKey, "/")
-	if len(splitKey) != 3 {
-		return false, ""
-	}
-	if strings.HasPrefix(splitKey[2], "letsdane-") || !strings.HasSuffix(splitKey[2], ".csv") {
-		return false, ""
-	}
-
-	return true, splitKey[2]
-}
+var logger *slog.Logger
 
 type Records []Record
 
@@ -108,9 +68,13 @@ func newResultRecord() *ResultRecord {
 	return &ResultRecord{
 		MeasurementID: "",
 		MeasurementInfo: MeasurementInfo{
-			Domain: "",
-			Cache:  "",
-			Dane:   "",
+			Domain:      "",
+			Cache:       "",
+			Dane:        "",
+			Dnssec:      "",
+			Resolver:    "",
+			RepeatVisit: "",
+			Trial:       "",
 		},
 		OneXX:   0,
 		TwoXX:   0,
@@ -126,6 +90,13 @@ type MeasurementInfo struct {
 	Domain string
 	Cache  string
 	Dane   string
+	// Dnssec is "false" for the measurements with DNSSEC validation disabled in unbound.
+	Dnssec string
+	// Resolver is the resolver of letsdane, stub or recursive, if the measurement chose it.
+	Resolver string
+	// RepeatVisit is "true" for the second load of the page in the same Firefox profile.
+	RepeatVisit string
+	Trial       string
 }
 
 func (r *ResultRecord) setMeasurementID(measurementID string) {
@@ -144,31 +115,34 @@ func (r *ResultRecord) setDane(dane string) {
 	r.Dane = dane
 }
 
+func (r *ResultRecord) setDnssec(dnssec string) {
+	r.Dnssec = dnssec
+}
+
+func (r *ResultRecord) setResolver(resolver string) {
+	r.Resolver = resolver
+}
+
+func (r *ResultRecord) setRepeatVisit(repeatVisit string) {
+	r.RepeatVisit = repeatVisit
+}
+
+func (r *ResultRecord) setTrial(trial string) {
+	r.Trial = trial
+}
+
 func (r *ResultRecord) setMeasurementInfoFromFile(file string) {
-	if strings.Contains(file, "with-cache-with-dane") {
-		r.setDomain(strings.Split(file, "-with-cache-with-dane")[0])
-		r.setCache("true")
-		r.setDane("true")
-		return
-	}
-	if strings.Contains(file, "with-cache-without-dane") {
-		r.setDomain(strings.Split(file, "-with-cache-without-dane")[0])
-		r.setCache("true")
-		r.setDane("false")
-		return
-	}
-	if strings.Contains(file, "without-cache-with-dane") {
-		r.setDomain(strings.Split(file, "-without-cache-with-dane")[0])
-		r.setCache("false")
-		r.setDane("true")
-		return
-	}
-	if strings.Contains(file, "without-cache-without-dane") {
-		r.setDomain(strings.Split(file, "-without-cache-without-dane")[0])
-		r.setCache("false")
-		r.setDane("false")
+	m, ok := storage.ParseMeasurementName(file)
+	if !ok {
 		return
 	}
+	r.setDomain(m.Domain)
+	r.setCache(strconv.FormatBool(m.Cache))
+	r.setDane(strconv.FormatBool(m.DANE))
+	r.setDnssec(strconv.FormatBool(m.DNSSEC))
+	r.setResolver(m.Resolver)
+	r.setRepeatVisit(strconv.FormatBool(m.RepeatVisit))
+	r.setTrial(strconv.Itoa(m.Trial))
 }
 
 func (r *ResultRecord) setCalculatedResult(records Records) {
@@ -205,7 +179,7 @@ func exportResultAsCSV(result Result, filPath string) error {
 	writer := csv.NewWriter(file)
 	defer writer.Flush()
 
-	if err := writer.Write([]string{"measurementID", "domain", "cache", "dane", "1xx", "2xx", "3xx", "4xx", "5xx", "xxx", "total"}); err != nil {
+	if err := writer.Write([]string{"measurementID", "domain", "cache", "dane", "dnssec", "resolver", "repeat_visit", "trial", "1xx", "2xx", "3xx", "4xx", "5xx", "xxx", "total"}); err != nil {
 		return err
 	}
 
@@ -215,6 +189,10 @@ func exportResultAsCSV(result Result, filPath string) error {
 			r.Domain,
 			r.Cache,
 			r.Dane,
+			r.Dnssec,
+			r.Resolver,
+			r.RepeatVisit,
+			r.Trial,
 			strconv.Itoa(r.OneXX),
 			strconv.Itoa(r.TwoXX),
 			strconv.Itoa(r.ThreeXX),
@@ -230,114 +208,86 @@ func exportResultAsCSV(result Result, filPath string) error {
 	return nil
 }
 
-func ListAllObjects(svc *s3.S3, bucket, prefix string) ([]*s3.Object, error) {
-	var objects []*s3.Object
-	err := svc.ListObjectsPages(&s3.ListObjectsInput{
-		Prefix: aws.String(prefix),
-		Bucket: aws.String(bucket),
-	}, func(p *s3.ListObjectsOutput, last bool) (shouldContinue bool) {
-		objects = append(objects, p.Contents...)
-		return true
-	})
+// readCSV reads all records of the csv file in the result store.
+func readCSV(ctx context.Context, store storage.ResultStore, key storage.Key) ([][]string, error) {
+	body, err := store.Get(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-	return objects, nil
-}
-
-type CustomRetryer struct {
-	client.DefaultRetryer
-}
-
-type temporary interface {
-	Temporary() bool
-}
-
-func (r CustomRetryer) ShouldRetry(req *request.Request) bool {
-	if origErr := req.Error; origErr != nil {
-		switch origErr.(type) {
-		case temporary:
-			if strings.Contains(origErr.Error(), "read: connection reset") {
-				// デフォルトのSDKではリトライしないが、リトライ可にする
-				return true
-			}
-		}
-	}
-	return r.DefaultRetryer.ShouldRetry(req)
+	defer body.Close()
+	return csv.NewReader(body).ReadAll()
 }
 
 func main() {
 	start := time.Now()
 	log.Println("start time: ", start.Format("2006-01-02-15-04-05"))
 
-	measurementID := flag.String("measurementID", "", "measurementID")
+	measurementID := flag.String("measurementID", "", "measurementID. if empty, all finished measurements in the result store are processed")
+	includeLegacy := flag.Bool("include-legacy", false, "without -measurementID, also process the measurements without manifest.json, which were run by an old pageloadtime")
 	outPutFilePath := flag.String("outPutFilePath", outPutFilePath, "outPutFilePath")
+	storeConfig := storage.Config{
+		URL:     "s3://" + s3Bucket,
+		Region:  awsRegion,
+		Profile: awsProfile,
+	}
+	storeConfig.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
 	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
-	// Create an AWS session
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		Profile:           awsProfile,
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-	svc := s3.New(sess, &aws.Config{
-		Region:  aws.String(awsRegion),
-		Retryer: CustomRetryer{},
-	})
+	ctx := context.Background()
+	store, err := storage.New(storeConfig)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
 	var result Result
 
-	prefix := *measurementID + "/"
-	logger.Info(fmt.Sprintf("listing items in bucket %s with prefix %s", s3Bucket, prefix))
-	objs, err := ListAllObjects(svc, s3Bucket, prefix)
-	if err != nil {
-		logger.Error("unable to list items in bucket %s, %v", s3Bucket, err)
+	measurementIDs := []string{*measurementID}
+	if *measurementID == "" {
+		// the measurements without a finished manifest are still running, failed, or run by an old pageloadtime.
+		var skipped []string
+		measurementIDs, skipped, err = storage.FinishedMeasurementIDs(ctx, store, *includeLegacy)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, id := range skipped {
+			logger.Warn(fmt.Sprintf("skip %s without manifest.json, use -include-legacy to process it", id))
+		}
+		if len(measurementIDs) == 0 {
+			log.Fatalf("no finished measurement in %s", storeConfig.URL)
+		}
+		logger.Info(fmt.Sprintf("finished measurements in %s: %s", storeConfig.URL, strings.Join(measurementIDs, ", ")))
 	}
 
-	// var wg sync.WaitGroup
-	// var mutex sync.Mutex
-	// sem := make(chan struct{}, 10)
-	for idx, obj := range objs {
-		logger.Info(fmt.Sprintf("now processing %s (%d/%d) %f%%", *obj.Key, idx+1, len(objs), float64(idx+1)/float64(len(objs))*100))
-		ok, targetCSVFileName := targetCSV(*obj.Key)
-		if !ok {
+	var keys []storage.Key
+	for _, id := range measurementIDs {
+		logger.Info(fmt.Sprintf("listing HAR csv files in %s of %s", id, storeConfig.URL))
+		measurementKeys, err := store.List(ctx, storage.Filter{MeasurementID: id, Kind: storage.KindHARCSV})
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to list HAR csv files, %v", err))
 			continue
 		}
+		keys = append(keys, measurementKeys...)
+	}
 
-		// wg.Add(1)
-		// sem <- struct{}{}
-		// go func(obj *s3.Object) {
-		// defer func() {
-		// 	<-sem
-		// 	wg.Done()
-		// }()
-
-		gotObj, err := svc.GetObject(&s3.GetObjectInput{
-			Bucket: aws.String(s3Bucket),
-			Key:    obj.Key,
-		})
-		if err != nil {
-			logger.Error(fmt.Sprintf("unable to get object %q from bucket %q, %v", *obj.Key, s3Bucket, err))
-		}
+	for idx, key := range keys {
+		logger.Info(fmt.Sprintf("now processing %s (%d/%d) %f%%", key.Path(), idx+1, len(keys), float64(idx+1)/float64(len(keys))*100))
 
-		reader := csv.NewReader(gotObj.Body)
-		records, err := reader.ReadAll()
+		records, err := readCSV(ctx, store, key)
 		if err != nil {
-			logger.Error(fmt.Sprintf("unable to read csv file %q, %v", *obj.Key, err))
+			logger.Error(fmt.Sprintf("unable to read csv file %q, %v", key.Path(), err))
+			continue
 		}
 
 		convertedRecords := convertStruct(records)
 
 		resultRecord := newResultRecord()
-		resultRecord.setMeasurementID(*measurementID)
-		resultRecord.setMeasurementInfoFromFile(targetCSVFileName)
+		resultRecord.setMeasurementID(key.MeasurementID)
+		resultRecord.setMeasurementInfoFromFile(key.Name)
 		resultRecord.setCalculatedResult(convertedRecords)
 
-		// mutex.Lock()
 		result = append(result, *resultRecord)
-		// mutex.Unlock()
-		// }(obj)
 	}
 
 	sort.SliceStable(result, func(i, j int) bool {
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+// defaultLeaseDuration is how long a worker holds a measurement without renewing the lease.
+// The workers renew their leases every third of it, so it only has to cover a few lost requests.
+const defaultLeaseDuration = 2 * time.Minute
+
+// workItem is a measurement handed out to a worker: a trial of a scenario for a page.
+type workItem struct {
+	// Index is the 1-based index of the page in the domain list.
+	Index         int          `json:"index"`
+	Record        utils.Record `json:"record"`
+	Scenario      scenario     `json:"scenario"`
+	Trial         int          `json:"trial"`
+	MeasurementID string       `json:"measurementID"`
+}
+
+// lease is a work item held by a worker until the deadline. The worker renews the deadline while it measures.
+type lease struct {
+	item     workItem
+	worker   string
+	deadline time.Time
+}
+
+// leaseRequest is the body of POST /leases.
+type leaseRequest struct {
+	// Worker is the name of the worker, which is only used in the logs.
+	Worker string `json:"worker"`
+}
+
+// leaseResponse is the body of a granted lease.
+type leaseResponse struct {
+	ID   string   `json:"id"`
+	Item workItem `json:"item"`
+	// LeaseMilliseconds is the lease duration. The lease expires if it is not renewed within it.
+	LeaseMilliseconds int64 `json:"leaseMilliseconds"`
+}
+
+// coordinator hands out the measurements of a run to the workers (pageloadtime worker) over HTTP.
+//
+// A worker leases a work item, runs the measurement with collectHAR, uploads the HAR file, the pcap files and
+// the other results into the result sub directory and completes the lease with its measurementResult, which is
+// sent to run like the results of the local measurements. A lease which is not renewed in time, e.g. because
+// its worker died, expires and its work item is handed out again. A failed measurement is handed out again
+// up to retries times, after the other work items, and each of its results is sent to run.
+//
+//	GET  /experiment                  the experiment to measure
+//	POST /leases                      lease a work item. 204 if all are leased now, 410 if all are finished
+//	POST /leases/{id}/renew           extend the lease
+//	PUT  /leases/{id}/files/{name}    upload a result file of the measurement
+//	POST /leases/{id}/complete        finish the lease with the measurementResult
+//
+// The requests for an unknown or expired lease fail with 410 Gone, and the worker drops the measurement.
+type coordinator struct {
+	exp           *experiment
+	progress      *progress
+	leaseDuration time.Duration
+	// retries is how many times a failed work item is handed out again.
+	retries int
+
+	mu     sync.Mutex
+	queue  []workItem
+	leases map[string]*lease
+	// retried is the number of times each work item has been handed out again after it failed.
+	retried map[string]int
+	// remaining is the number of work items which are not completed yet.
+	remaining int
+	results   chan<- measurementResult
+	closed    bool
+	done      chan struct{}
+}
+
+// newCoordinator queues the measurements which are not finished in the order of the local run:
+// the trials of the scenarios of each page. results is closed when all of them are completed or the run is interrupted.
+// results must have room for retries+1 results of each measurement.
+func newCoordinator(exp *experiment, p *progress, subsetDomainList []utils.Record, scenarios []scenario, finished map[journalKey]bool, leaseDuration time.Duration, retries int, results chan<- measurementResult) *coordinator {
+	c := &coordinator{
+		exp:           exp,
+		progress:      p,
+		leaseDuration: leaseDuration,
+		retries:       retries,
+		leases:        make(map[string]*lease),
+		retried:       make(map[string]int),
+		results:       results,
+		done:          make(chan struct{}),
+	}
+	for index, record := range subsetDomainList {
+		for trial := 1; trial <= exp.Trials; trial++ {
+			for _, s := range scenarios {
+				if finished[journalKey{Domain: record.Slug(), Scenario: s.String(), Trial: trial}] {
+					continue
+				}
+				c.queue = append(c.queue, workItem{
+					Index:         exp.Input.First + index,
+					Record:        record,
+					Scenario:      s,
+					Trial:         trial,
+					MeasurementID: trialMeasurementID(record, s, trial, exp.Trials),
+				})
+			}
+		}
+	}
+	c.remaining = len(c.queue)
+	if c.remaining == 0 {
+		c.closeLocked()
+	}
+	return c
+}
+
+// serve serves the workers on addr until stop is called. The leases are given up when ctx is done.
+func (c *coordinator) serve(ctx context.Context, addr string) (stop func(), err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the workers: %w", err)
+	}
+	server := &http.Server{Handler: c.handler()}
+	go func() {
+		logger.Info(fmt.Sprintf("hand out %d measurements to the workers on %s", c.remaining, listener.Addr()))
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(fmt.Sprintf("Failed to serve the workers: %s", err))
+		}
+	}()
+	go c.watch(ctx)
+	return func() { server.Close() }, nil
+}
+
+// watch expires the leases which are not renewed until all work items are completed, and gives up the leases when ctx is done.
+func (c *coordinator) watch(ctx context.Context) {
+	ticker := time.NewTicker(max(c.leaseDuration/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ctx.Done():
+			c.interrupt()
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			c.expireLocked(now)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// interrupt aborts the leased measurements and closes the results. The workers find their leases gone.
+func (c *coordinator) interrupt() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, l := range c.leases {
+		logger.Info(fmt.Sprintf("aborted: %s on %s", l.item.MeasurementID, l.worker))
+		c.progress.abort(l.item.Scenario)
+		delete(c.leases, id)
+	}
+	c.closeLocked()
+}
+
+// expireLocked hands out the work items of the expired leases again, before the others.
+func (c *coordinator) expireLocked(now time.Time) {
+	for id, l := range c.leases {
+		if now.Before(l.deadline) {
+			continue
+		}
+		logger.Warn(fmt.Sprintf("lease of %s on %s expired, hand it out again", l.item.MeasurementID, l.worker))
+		c.requeueLocked(id, l)
+	}
+}
+
+func (c *coordinator) requeueLocked(id string, l *lease) {
+	delete(c.leases, id)
+	c.progress.abort(l.item.Scenario)
+	c.queue = append([]workItem{l.item}, c.queue...)
+}
+
+func (c *coordinator) closeLocked() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.results)
+	close(c.done)
+}
+
+func (c *coordinator) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /experiment", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, c.exp)
+	})
+	mux.HandleFunc("POST /leases", c.handleLease)
+	mux.HandleFunc("POST /leases/{id}/renew", c.handleRenew)
+	mux.HandleFunc("PUT /leases/{id}/files/{name}", c.handleFile)
+	mux.HandleFunc("POST /leases/{id}/complete", c.handleComplete)
+	return mux
+}
+
+func (c *coordinator) handleLease(w http.ResponseWriter, r *http.Request) {
+	var req leaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, err := newLeaseID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.expireLocked(now)
+	if c.closed {
+		http.Error(w, "no more measurements", http.StatusGone)
+		return
+	}
+	if len(c.queue) == 0 {
+		// the leased measurements may still expire and be handed out again.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	item := c.queue[0]
+	c.queue = c.queue[1:]
+	c.leases[id] = &lease{item: item, worker: req.Worker, deadline: now.Add(c.leaseDuration)}
+	c.progress.begin(item.Scenario)
+	logger.Info(fmt.Sprintf("lease %s to %s", item.MeasurementID, req.Worker))
+	writeJSON(w, leaseResponse{ID: id, Item: item, LeaseMilliseconds: c.leaseDuration.Milliseconds()})
+}
+
+// leaseOf returns the lease of the request. If the lease is unknown or expired, it responds 410 and returns nil.
+// It must be called with c.mu held.
+func (c *coordinator) leaseOf(w http.ResponseWriter, r *http.Request) *lease {
+	c.expireLocked(time.Now())
+	l, ok := c.leases[r.PathValue("id")]
+	if !ok {
+		http.Error(w, "lease is expired or unknown", http.StatusGone)
+		return nil
+	}
+	return l
+}
+
+func (c *coordinator) handleRenew(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l := c.leaseOf(w, r)
+	if l == nil {
+		return
+	}
+	l.deadline = time.Now().Add(c.leaseDuration)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleFile writes the uploaded file into the directory of the page in the result sub directory,
+// where the local measurements write their results.
+func (c *coordinator) handleFile(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		http.Error(w, fmt.Sprintf("invalid file name %q", name), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	l := c.leaseOf(w, r)
+	c.mu.Unlock()
+	if l == nil {
+		return
+	}
+
+	dir := filepath.Join(c.exp.resultSubDirectoryPath(), l.item.Record.Slug())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// the file is renamed after it is fully written, so that a broken upload does not leave a truncated result.
+	file, err := os.CreateTemp(dir, ".upload-"+name+"-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(file.Name())
+	_, err = io.Copy(file, r.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(dir, name))
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to write %s: %s", name, err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleComplete sends the result of the lease to run. An aborted measurement is handed out again,
+// and so is a failed one until it has been retried c.retries times.
+func (c *coordinator) handleComplete(w http.ResponseWriter, r *http.Request) {
+	var result measurementResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l := c.leaseOf(w, r)
+	if l == nil {
+		return
+	}
+	id := r.PathValue("id")
+	if result.Aborted {
+		logger.Info(fmt.Sprintf("aborted: %s on %s, hand it out again", l.item.MeasurementID, l.worker))
+		c.requeueLocked(id, l)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// the work item, not the worker, tells which measurement it is.
+	result.Domain = l.item.Record.Slug()
+	result.Scenario = l.item.Scenario
+	result.Trial = l.item.Trial
+	result.MeasurementID = l.item.MeasurementID
+	delete(c.leases, id)
+	// results has room for every attempt of every work item, so that this does not block.
+	c.results <- result
+	if result.FailureReason != failureNone && c.retried[l.item.MeasurementID] < c.retries {
+		c.retried[l.item.MeasurementID]++
+		logger.Info(fmt.Sprintf("retry %s: attempt %d of %d", l.item.MeasurementID, c.retried[l.item.MeasurementID]+1, c.retries+1))
+		c.progress.plan(l.item.Scenario, 1)
+		c.queue = append(c.queue, l.item)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	c.remaining--
+	if c.remaining == 0 {
+		c.closeLocked()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newLeaseID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write response: %s", err))
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+// coordinatorTestHAR is the log of a HAR file which firefox writes for a loaded page.
+const coordinatorTestHAR = `{"pages":[{"id":"page_1","pageTimings":{"onContentLoad":800,"onLoad":1200}}],"entries":[]}`
+
+// startCoordinator serves a coordinator of the pages in every scenario of exp.
+func startCoordinator(t *testing.T, exp *experiment, records []utils.Record, leaseDuration time.Duration, retries int) (*httptest.Server, <-chan measurementResult) {
+	t.Helper()
+	scenarios, err := exp.scenarioList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan measurementResult, len(records)*len(scenarios)*exp.Trials*(retries+1))
+	c := newCoordinator(exp, newProgress(time.Now()), records, scenarios, map[journalKey]bool{}, leaseDuration, retries, results)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go c.watch(ctx)
+	server := httptest.NewServer(c.handler())
+	t.Cleanup(server.Close)
+	return server, results
+}
+
+func newTestWorker(t *testing.T, server *httptest.Server, name string) *worker {
+	rt := newFakeRuntime()
+	rt.setOutput(firefoxHARImageName, []byte(coordinatorTestHAR))
+	return &worker{
+		coordinator:  server.URL,
+		name:         name,
+		workDir:      t.TempDir(),
+		rt:           rt,
+		client:       server.Client(),
+		pollInterval: 10 * time.Millisecond,
+	}
+}
+
+func coordinatorTestExperiment(t *testing.T) *experiment {
+	exp := defaultExperiment(time.Now())
+	exp.Scenarios = []string{"without-cache-without-dane", "with-cache-with-dane"}
+	exp.Trials = 2
+	exp.Output = experimentOutput{Directory: t.TempDir(), SubDirName: "distributed"}
+	return exp
+}
+
+func TestCoordinatorWorkers(t *testing.T) {
+	exp := coordinatorTestExperiment(t)
+	records := []utils.Record{{Domain: "a.example"}, {Domain: "b.example"}, {Domain: "c.example"}}
+	server, results := startCoordinator(t, exp, records, time.Minute, 0)
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"worker-1", "worker-2", "worker-3"} {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			if err := w.run(context.Background(), 2); err != nil {
+				t.Errorf("%s: run() = %v", w.name, err)
+			}
+		}(newTestWorker(t, server, name))
+	}
+
+	var got []string
+	for result := range results {
+		if result.FailureReason != failureNone || result.PageLoadTime != 1200 {
+			t.Errorf("result = %+v, want page load time 1200", result)
+		}
+		got = append(got, result.MeasurementID)
+	}
+	wg.Wait()
+
+	// every measurement is completed exactly once.
+	sort.Strings(got)
+	if len(got) != 12 {
+		t.Fatalf("completed %d measurements, want 12: %q", len(got), got)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] == got[i-1] {
+			t.Errorf("%s is completed twice", got[i])
+		}
+	}
+
+	dir := filepath.Join(exp.resultSubDirectoryPath(), "b.example")
+	for _, name := range []string{
+		"b.example-with-cache-with-dane-trial-2.har",
+		"b.example-with-cache-with-dane-trial-2.csv",
+		"letsdane-b.example-with-cache-with-dane-trial-2.csv",
+		"firefox-b.example-without-cache-without-dane-trial-1.pcap",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("result is not uploaded: %v", err)
+		}
+	}
+}
+
+func TestCoordinatorLeaseExpires(t *testing.T) {
+	exp := coordinatorTestExperiment(t)
+	exp.Scenarios = []string{"without-cache-without-dane"}
+	exp.Trials = 1
+	server, results := startCoordinator(t, exp, []utils.Record{{Domain: "a.example"}}, 100*time.Millisecond, 0)
+
+	// a worker leases the only measurement and dies.
+	dead := newTestWorker(t, server, "dead")
+	var l leaseResponse
+	if err := dead.call(context.Background(), http.MethodPost, "/leases", leaseRequest{Worker: dead.name}, &l); err != nil || l.ID == "" {
+		t.Fatalf("lease = %+v, %v", l, err)
+	}
+	alive := newTestWorker(t, server, "alive")
+	if err := alive.run(context.Background(), 1); err != nil {
+		t.Fatalf("run() = %v", err)
+	}
+
+	var got []measurementResult
+	for result := range results {
+		got = append(got, result)
+	}
+	if len(got) != 1 || got[0].MeasurementID != "a.example-without-cache-without-dane" {
+		t.Fatalf("results = %+v, want the measurement completed by the other worker", got)
+	}
+
+	// the dead worker cannot complete the expired lease.
+	body, _ := json.Marshal(measurementResult{PageLoadTime: 1})
+	resp, err := server.Client().Post(server.URL+"/leases/"+l.ID+"/complete", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("complete of the expired lease = %s, want 410 Gone", resp.Status)
+	}
+}
+
+func TestCoordinatorRejectsFileName(t *testing.T) {
+	exp := coordinatorTestExperiment(t)
+	server, _ := startCoordinator(t, exp, []utils.Record{{Domain: "a.example"}}, time.Minute, 0)
+	w := newTestWorker(t, server, "worker")
+	var l leaseResponse
+	if err := w.call(context.Background(), http.MethodPost, "/leases", leaseRequest{Worker: w.name}, &l); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"..", ".hidden", "..%2Fmanifest.json"} {
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/leases/"+l.ID+"/files/"+name, bytes.NewReader([]byte("x")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNoContent {
+			t.Errorf("upload of %q is accepted", name)
+		}
+	}
+}
+
+func TestCoordinatorRetries(t *testing.T) {
+	exp := coordinatorTestExperiment(t)
+	exp.Scenarios = []string{"without-cache-without-dane"}
+	exp.Trials = 1
+	server, results := startCoordinator(t, exp, []utils.Record{{Domain: "a.example"}, {Domain: "b.example"}}, time.Minute, 2)
+
+	// firefox writes no HAR file for a.example until its third attempt.
+	w := newTestWorker(t, server, "worker")
+	rt := w.rt.(*fakeRuntime)
+	var mu sync.Mutex
+	attempts := 0
+	rt.onRun = func(spec ContainerSpec) {
+		if spec.Image != firefoxHARImageName {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		output := []byte(coordinatorTestHAR)
+		if strings.Contains(spec.Name, "a.example") {
+			attempts++
+			if attempts < 3 {
+				output = nil
+			}
+		}
+		rt.setOutput(firefoxHARImageName, output)
+	}
+	if err := w.run(context.Background(), 1); err != nil {
+		t.Fatalf("run() = %v", err)
+	}
+
+	// a.example is handed out again after b.example, and its failed attempts are sent to run as well.
+	var got []string
+	for result := range results {
+		got = append(got, fmt.Sprintf("%s %s", result.MeasurementID, result.FailureReason))
+	}
+	want := []string{
+		"a.example-without-cache-without-dane " + string(failureHARNotExported),
+		"b.example-without-cache-without-dane ",
+		"a.example-without-cache-without-dane " + string(failureHARNotExported),
+		"a.example-without-cache-without-dane ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %q, want %q", got, want)
+	}
+}
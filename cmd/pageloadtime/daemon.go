@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/yagikota/danewebperf/storage"
+	"github.com/yagikota/danewebperf/utils"
+)
+
+const (
+	// daemonRunSkipped means the run was not started because the previous run was still running.
+	daemonRunSkipped = "skipped"
+	// daemonRunTimedOut means the run was stopped at -max-runtime. It can be resumed like an interrupted one.
+	daemonRunTimedOut = "timed-out"
+)
+
+// errMaxRuntime stops a run of the daemon which reaches -max-runtime.
+var errMaxRuntime = errors.New("run reached the maximum runtime")
+
+// daemonCommand is `pageloadtime daemon`, which runs the experiment on a schedule to track the performance over time.
+// Each run is written under a measurement ID of its start time, and the status of the last runs is served over HTTP.
+//
+// go run . daemon -experiment experiments/all-scenarios.yaml -schedule "0 */6 * * *" -max-runtime 5h -status-addr :9300
+func daemonCommand(args []string) error {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	experimentPath := flags.String("experiment", "", "experiment definition file (.yaml, .yml or .json) to run on the schedule")
+	scheduleExpr := flags.String("schedule", "", "when to start the runs: an interval (e.g. 6h or @every 6h), @hourly, @daily, @weekly, @monthly or a cron expression (e.g. \"0 */6 * * *\") in the local time")
+	maxRuntime := flags.Duration("max-runtime", 0, "how long a run may take before it is stopped, e.g. 5h. if 0, a run is not stopped")
+	statusAddr := flags.String("status-addr", "", "address to serve /runs (JSON) with the status of the last runs, e.g. :9300. if empty, it is not served")
+	history := flags.Int("history", 20, "number of the last runs served on /runs")
+	dockerHost := flags.String("docker-host", os.Getenv("DOCKER_HOST"), "docker daemon socket. if empty, "+defaultDockerHost+" is used")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *experimentPath == "" {
+		return errors.New("-experiment is required")
+	}
+	if *scheduleExpr == "" {
+		return errors.New("-schedule is required")
+	}
+	if *maxRuntime < 0 {
+		return fmt.Errorf("-max-runtime must not be negative: %s", *maxRuntime)
+	}
+	if *history < 1 {
+		return fmt.Errorf("-history must be at least 1: %d", *history)
+	}
+	sched, err := parseSchedule(*scheduleExpr)
+	if err != nil {
+		return err
+	}
+
+	// the experiment is loaded again for each run, so that it can be edited between the runs.
+	// it is checked here to find a mistake before the first run.
+	exp, err := daemonExperiment(*experimentPath, time.Now())
+	if err != nil {
+		return err
+	}
+	var store storage.ResultStore
+	if exp.Output.Store.URL != "" {
+		store, err = storage.New(exp.Output.Store)
+		if err != nil {
+			return err
+		}
+	}
+	dockerRT, err := newDockerRuntime(*dockerHost)
+	if err != nil {
+		return err
+	}
+
+	d := &daemon{
+		schedule:   sched,
+		maxRuntime: *maxRuntime,
+		history:    *history,
+		experiment: func(start time.Time) (*experiment, error) {
+			return daemonExperiment(*experimentPath, start)
+		},
+		measure: func(ctx context.Context, exp *experiment, p *progress, start time.Time) error {
+			rt := &progressRuntime{ContainerRuntime: dockerRT, progress: p}
+			return run(ctx, rt, p, store, exp, runOptions{}, start)
+		},
+	}
+
+	// on SIGINT or SIGTERM, the running run is interrupted as pageloadtime is, and the daemon exits.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// stop restores the default behavior of the signals.
+		<-ctx.Done()
+		stop()
+	}()
+
+	if *statusAddr != "" {
+		server := &http.Server{Addr: *statusAddr, Handler: d.handler()}
+		go func() {
+			logger.Info(fmt.Sprintf("serve /runs on %s", *statusAddr))
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error(fmt.Sprintf("Failed to serve the status of the runs: %s", err))
+			}
+		}()
+		defer server.Close()
+	}
+	return d.loop(ctx)
+}
+
+// daemonExperiment loads the experiment of the run started at start. The measurement ID is the start time,
+// after the subDirName of the experiment if it has one, e.g. all-scenarios-2024-06-01-00-00-00.
+func daemonExperiment(path string, start time.Time) (*experiment, error) {
+	exp, err := loadExperiment(path, start)
+	if err != nil {
+		return nil, err
+	}
+	if timestamp := start.Format("2006-01-02-15-04-05"); exp.Output.SubDirName != timestamp {
+		exp.Output.SubDirName += "-" + timestamp
+	}
+	if err := exp.validate(); err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// daemonRun is the status of a run of the daemon, which is served on /runs.
+type daemonRun struct {
+	// MeasurementID is the result sub directory of the run. It is empty if the run was not started.
+	MeasurementID string    `json:"measurementID,omitempty"`
+	ScheduledAt   time.Time `json:"scheduledAt"`
+	// Status is running, finished, failed, interrupted, timed-out or skipped.
+	Status     string     `json:"status"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	// Progress is the progress of the measurements of the run, which is served while it is running.
+	Progress *progressStatus `json:"progress,omitempty"`
+
+	progress *progress
+}
+
+// daemon starts a run of the experiment at each time of the schedule, unless the previous run is still running.
+type daemon struct {
+	schedule schedule
+	// maxRuntime is how long a run may take. If 0, a run is not stopped.
+	maxRuntime time.Duration
+	// history is the number of the last runs to keep.
+	history int
+	// experiment loads the experiment of the run started at start, whose SubDirName is the measurement ID.
+	experiment func(start time.Time) (*experiment, error)
+	// measure runs the experiment and reports the progress to p.
+	measure func(ctx context.Context, exp *experiment, p *progress, start time.Time) error
+
+	mu sync.Mutex
+	// runs are the last runs, the oldest first.
+	runs    []*daemonRun
+	current *daemonRun
+	wg      sync.WaitGroup
+}
+
+// loop starts the runs on the schedule until ctx is done, and then waits for the running run to stop.
+func (d *daemon) loop(ctx context.Context) error {
+	defer d.wg.Wait()
+	for {
+		next := d.schedule.next(time.Now())
+		if next.IsZero() {
+			return errors.New("schedule has no next run")
+		}
+		logger.Info(fmt.Sprintf("next run at %s", next.Format(time.RFC3339)))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		d.trigger(ctx, next)
+	}
+}
+
+// trigger starts the run scheduled at scheduledAt in the background, or records it as skipped if a run is running.
+func (d *daemon) trigger(ctx context.Context, scheduledAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	r := &daemonRun{ScheduledAt: scheduledAt}
+	if d.current != nil {
+		r.Status = daemonRunSkipped
+		r.Error = fmt.Sprintf("%s is still running", d.current.MeasurementID)
+		logger.Warn(fmt.Sprintf("skip the run scheduled at %s: %s", scheduledAt.Format(time.RFC3339), r.Error))
+		d.recordLocked(r)
+		return
+	}
+
+	start := time.Now()
+	r.StartedAt = &start
+	exp, err := d.experiment(start)
+	if err != nil {
+		r.Status = utils.ManifestStatusFailed
+		r.Error = err.Error()
+		r.FinishedAt = &start
+		logger.Error(fmt.Sprintf("Failed to load the experiment of the run scheduled at %s: %s", scheduledAt.Format(time.RFC3339), err))
+		d.recordLocked(r)
+		return
+	}
+	r.MeasurementID = exp.Output.SubDirName
+	r.Status = utils.ManifestStatusRunning
+	r.progress = newProgress(start)
+	d.current = r
+	d.recordLocked(r)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.measureRun(ctx, r, exp, start)
+	}()
+}
+
+// measureRun runs the experiment of r and records how it ended.
+func (d *daemon) measureRun(ctx context.Context, r *daemonRun, exp *experiment, start time.Time) {
+	logger.Info(fmt.Sprintf("run %s started", r.MeasurementID))
+	// the run is canceled at the maximum runtime rather than given a deadline, so that the running measurements are
+	// aborted and their containers removed as on a signal, and the run can be resumed with -resume.
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if d.maxRuntime > 0 {
+		timer := time.AfterFunc(d.maxRuntime, func() { cancel(errMaxRuntime) })
+		defer timer.Stop()
+	}
+	err := d.measure(runCtx, exp, r.progress, start)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	r.FinishedAt = &now
+	d.current = nil
+	switch {
+	case err == nil:
+		r.Status = utils.ManifestStatusFinished
+	case errors.Is(context.Cause(runCtx), errMaxRuntime):
+		r.Status = daemonRunTimedOut
+	case ctx.Err() != nil:
+		r.Status = utils.ManifestStatusInterrupted
+	default:
+		r.Status = utils.ManifestStatusFailed
+	}
+	if err != nil {
+		r.Error = err.Error()
+		logger.Error(fmt.Sprintf("run %s %s: %s", r.MeasurementID, r.Status, err))
+		return
+	}
+	logger.Info(fmt.Sprintf("run %s finished in %s", r.MeasurementID, now.Sub(start).Round(time.Second)))
+}
+
+// recordLocked keeps r as the latest run and forgets the runs older than the history.
+func (d *daemon) recordLocked(r *daemonRun) {
+	d.runs = append(d.runs, r)
+	if len(d.runs) > d.history {
+		d.runs = slices.Clone(d.runs[len(d.runs)-d.history:])
+	}
+}
+
+// status returns the last runs, the latest first, with the progress of the running one.
+func (d *daemon) status(now time.Time) []daemonRun {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	runs := make([]daemonRun, 0, len(d.runs))
+	for i := len(d.runs) - 1; i >= 0; i-- {
+		r := *d.runs[i]
+		if r.Status == utils.ManifestStatusRunning {
+			status := r.progress.status(now)
+			r.Progress = &status
+		}
+		runs = append(runs, r)
+	}
+	return runs
+}
+
+// handler serves /runs in JSON.
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /runs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, d.status(time.Now()))
+	})
+	return mux
+}
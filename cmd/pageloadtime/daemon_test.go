@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+// newTestDaemon returns a daemon whose runs wait for release, or for ctx to be done.
+func newTestDaemon(release <-chan error) *daemon {
+	return &daemon{
+		schedule: intervalSchedule(time.Hour),
+		history:  2,
+		experiment: func(start time.Time) (*experiment, error) {
+			exp := defaultExperiment(start)
+			exp.Output.SubDirName = "run-" + start.Format(time.RFC3339Nano)
+			return exp, nil
+		},
+		measure: func(ctx context.Context, exp *experiment, p *progress, start time.Time) error {
+			p.plan(scenario{}, 1)
+			select {
+			case err := <-release:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+func TestDaemonSkipsRunWhileRunning(t *testing.T) {
+	release := make(chan error)
+	d := newTestDaemon(release)
+	ctx := context.Background()
+	scheduledAt := time.Now()
+
+	d.trigger(ctx, scheduledAt)
+	d.trigger(ctx, scheduledAt.Add(time.Hour))
+	runs := d.status(time.Now())
+	if len(runs) != 2 {
+		t.Fatalf("len(runs) = %d, want 2", len(runs))
+	}
+	if runs[0].Status != daemonRunSkipped || runs[0].MeasurementID != "" {
+		t.Errorf("second run = %+v, want skipped", runs[0])
+	}
+	if runs[1].Status != utils.ManifestStatusRunning || runs[1].Progress == nil {
+		t.Errorf("first run = %+v, want running with its progress", runs[1])
+	}
+
+	release <- nil
+	d.wg.Wait()
+	if got := d.status(time.Now())[1]; got.Status != utils.ManifestStatusFinished || got.FinishedAt == nil || got.Progress != nil {
+		t.Errorf("first run = %+v, want finished", got)
+	}
+
+	d.trigger(ctx, scheduledAt.Add(2*time.Hour))
+	runs = d.status(time.Now())
+	// the first run is forgotten with the history of 2.
+	if len(runs) != 2 || runs[1].Status != daemonRunSkipped {
+		t.Fatalf("runs = %+v, want the skipped and the third run", runs)
+	}
+	if runs[0].Status != utils.ManifestStatusRunning {
+		t.Errorf("third run = %+v, want running", runs[0])
+	}
+	release <- errors.New("docker is gone")
+	d.wg.Wait()
+	if got := d.status(time.Now())[0]; got.Status != utils.ManifestStatusFailed || got.Error != "docker is gone" {
+		t.Errorf("third run = %+v, want failed", got)
+	}
+}
+
+func TestDaemonMaxRuntime(t *testing.T) {
+	d := newTestDaemon(make(chan error))
+	d.maxRuntime = 10 * time.Millisecond
+
+	d.trigger(context.Background(), time.Now())
+	d.wg.Wait()
+	if got := d.status(time.Now())[0]; got.Status != daemonRunTimedOut || got.Error == "" {
+		t.Errorf("run = %+v, want timed-out", got)
+	}
+
+	// a signal interrupts the run before the maximum runtime.
+	d.maxRuntime = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	d.trigger(ctx, time.Now())
+	cancel()
+	d.wg.Wait()
+	if got := d.status(time.Now())[0]; got.Status != utils.ManifestStatusInterrupted {
+		t.Errorf("run = %+v, want interrupted", got)
+	}
+}
+
+func TestDaemonLoop(t *testing.T) {
+	release := make(chan error)
+	d := newTestDaemon(release)
+	d.schedule = intervalSchedule(20 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() { done <- d.loop(ctx) }()
+	// the first run is still running at the next times of the schedule.
+	for {
+		if runs := d.status(time.Now()); len(runs) == 2 && runs[0].Status == daemonRunSkipped {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("loop() = %v", err)
+	}
+	for _, r := range d.status(time.Now()) {
+		if r.Status == utils.ManifestStatusRunning {
+			t.Errorf("run = %+v is still running after loop returned", r)
+		}
+	}
+}
+
+func TestDaemonHandler(t *testing.T) {
+	d := newTestDaemon(make(chan error))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer d.wg.Wait()
+	defer cancel()
+	d.trigger(ctx, time.Now())
+	d.trigger(ctx, time.Now())
+
+	server := httptest.NewServer(d.handler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL + "/runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var runs []daemonRun
+	if err := json.NewDecoder(resp.Body).Decode(&runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Status != daemonRunSkipped || runs[1].Status != utils.ManifestStatusRunning {
+		t.Errorf("/runs = %+v", runs)
+	}
+}
+
+func TestDaemonExperiment(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	inputCSV := filepath.Join(dir, "domains.csv")
+	writeFile(t, inputCSV, "example.com\n")
+	named := filepath.Join(dir, "named.yaml")
+	writeFile(t, named, "input:\n  csv: "+inputCSV+"\noutput:\n  subDirName: all-scenarios\n")
+	unnamed := filepath.Join(dir, "unnamed.yaml")
+	writeFile(t, unnamed, "input:\n  csv: "+inputCSV+"\n")
+
+	exp, err := daemonExperiment(named, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := exp.Output.SubDirName, "all-scenarios-2024-06-01-00-00-00"; got != want {
+		t.Errorf("SubDirName = %q, want %q", got, want)
+	}
+	exp, err = daemonExperiment(unnamed, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := exp.Output.SubDirName, "2024-06-01-00-00-00"; got != want {
+		t.Errorf("SubDirName = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// dockerRuntime is ContainerRuntime backed by the Docker Engine API.
+// https://docs.docker.com/engine/api/
+type dockerRuntime struct {
+	client  *http.Client
+	baseURL string
+}
+
+// newDockerRuntime connects to dockerHost, e.g. unix:///var/run/docker.sock or tcp://127.0.0.1:2375.
+// If dockerHost is empty, the default unix socket is used.
+func newDockerRuntime(dockerHost string) (*dockerRuntime, error) {
+	if dockerHost == "" {
+		dockerHost = defaultDockerHost
+	}
+	u, err := url.Parse(dockerHost)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", dockerHost, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socketPath := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		}
+		return &dockerRuntime{
+			client:  &http.Client{Transport: transport},
+			baseURL: "http://docker",
+		}, nil
+	case "tcp", "http":
+		return &dockerRuntime{
+			client:  &http.Client{},
+			baseURL: "http://" + u.Host,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported docker host scheme: %s", u.Scheme)
+	}
+}
+
+// dockerAPIError is an error response of the Docker Engine API.
+type dockerAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *dockerAPIError) Error() string {
+	return fmt.Sprintf("docker api error (status %d): %s", e.StatusCode, e.Message)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *dockerAPIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// tarArchive is a request body which is sent as is, instead of JSON.
+type tarArchive []byte
+
+// request sends a request to the Docker Engine API and returns the response body.
+// body is sent as JSON, except for tarArchive.
+// 304 Not Modified (e.g. stopping a stopped container) is not treated as an error, like docker CLI.
+func (d *dockerRuntime) request(ctx context.Context, method, path string, query url.Values, body any) (io.ReadCloser, error) {
+	var reqBody io.Reader
+	contentType := "application/json"
+	switch body := body.(type) {
+	case nil:
+	case tarArchive:
+		reqBody = bytes.NewReader(body)
+		contentType = "application/x-tar"
+	default:
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(buf)
+	}
+
+	u := d.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	logger.Info(fmt.Sprintf("docker api: %s %s", method, path))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 400 {
+		defer res.Body.Close()
+		var msg struct {
+			Message string `json:"message"`
+		}
+		buf, _ := io.ReadAll(res.Body)
+		if err := json.Unmarshal(buf, &msg); err != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(buf))
+		}
+		return nil, &dockerAPIError{StatusCode: res.StatusCode, Message: msg.Message}
+	}
+	return res.Body, nil
+}
+
+// call sends a request and decodes the JSON response into out if out is not nil.
+func (d *dockerRuntime) call(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	resBody, err := d.request(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resBody.Close()
+	if out == nil {
+		_, err := io.Copy(io.Discard, resBody)
+		return err
+	}
+	return json.NewDecoder(resBody).Decode(out)
+}
+
+func (d *dockerRuntime) CreateNetwork(ctx context.Context, name string) error {
+	body := map[string]any{
+		"Name":           name,
+		"CheckDuplicate": true,
+	}
+	return d.call(ctx, http.MethodPost, "/networks/create", nil, body, nil)
+}
+
+func (d *dockerRuntime) RemoveNetwork(ctx context.Context, name string) error {
+	return d.call(ctx, http.MethodDelete, "/networks/"+url.PathEscape(name), nil, nil, nil)
+}
+
+type portBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
+}
+
+func (d *dockerRuntime) createContainer(ctx context.Context, spec ContainerSpec, autoRemove bool) error {
+	exposedPorts := make(map[string]struct{})
+	portBindings := make(map[string][]portBinding)
+	for _, port := range spec.Ports {
+		exposedPorts[port] = struct{}{}
+		// empty HostPort means a random port, which is the same as `docker run -p :53/udp`
+		portBindings[port] = []portBinding{{}}
+	}
+
+	body := map[string]any{
+		"Image":        spec.Image,
+		"Cmd":          spec.Cmd,
+		"Env":          spec.Env,
+		"ExposedPorts": exposedPorts,
+		"HostConfig": map[string]any{
+			"NetworkMode":  spec.Network,
+			"AutoRemove":   autoRemove,
+			"PortBindings": portBindings,
+			"CapAdd":       spec.CapAdd,
+		},
+	}
+	query := url.Values{"name": []string{spec.Name}}
+	if err := d.call(ctx, http.MethodPost, "/containers/create", query, body, nil); err != nil {
+		return err
+	}
+	if len(spec.Files) == 0 {
+		return nil
+	}
+	if err := d.copyFiles(ctx, spec); err != nil {
+		// the container is neither started nor returned to the caller, so nothing else removes it.
+		d.forceRemove(ctx, spec.Name)
+		return err
+	}
+	return nil
+}
+
+// forceRemove removes a container which failed to be set up, even if ctx was canceled meanwhile.
+// The error is only logged, so that the caller returns the error of the setup.
+func (d *dockerRuntime) forceRemove(ctx context.Context, name string) {
+	query := url.Values{"force": []string{"1"}}
+	if err := d.call(context.WithoutCancel(ctx), http.MethodDelete, "/containers/"+url.PathEscape(name), query, nil, nil); err != nil {
+		logger.Error(fmt.Sprintf("Failed to remove Docker container %s: %s", name, err))
+	}
+}
+
+// copyFiles writes the files of the spec into the created container.
+func (d *dockerRuntime) copyFiles(ctx context.Context, spec ContainerSpec) error {
+	archive, err := filesArchive(spec.Files)
+	if err != nil {
+		return err
+	}
+	// the files are extracted at the root of the container, which creates the missing directories.
+	return d.call(ctx, http.MethodPut, "/containers/"+url.PathEscape(spec.Name)+"/archive", url.Values{"path": []string{"/"}}, archive, nil)
+}
+
+// filesArchive packs the files into a tar archive whose paths are relative to the root, in the order of the paths.
+func filesArchive(files map[string][]byte) (tarArchive, error) {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("file path in the container must be absolute: %s", path)
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, path := range paths {
+		content := files[path]
+		header := &tar.Header{
+			Name:    strings.TrimPrefix(path, "/"),
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return tarArchive(buf.Bytes()), nil
+}
+
+func (d *dockerRuntime) startContainer(ctx context.Context, name string) error {
+	return d.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(name)+"/start", nil, nil, nil)
+}
+
+func (d *dockerRuntime) StartContainer(ctx context.Context, spec ContainerSpec) error {
+	if err := d.createContainer(ctx, spec, spec.AutoRemove); err != nil {
+		return err
+	}
+	if err := d.startContainer(ctx, spec.Name); err != nil {
+		// a container which is not started is not removed by AutoRemove, and the caller does not know of it.
+		d.forceRemove(ctx, spec.Name)
+		return err
+	}
+	return nil
+}
+
+func (d *dockerRuntime) RunContainer(ctx context.Context, spec ContainerSpec) ([]byte, error) {
+	// AutoRemove is handled here instead of the daemon, otherwise the logs are gone before reading them.
+	if err := d.createContainer(ctx, spec, false); err != nil {
+		return nil, err
+	}
+	if spec.AutoRemove {
+		defer func() {
+			cleanupCtx := context.WithoutCancel(ctx)
+			// the container is still running if ctx was canceled while waiting for it.
+			if ctx.Err() != nil {
+				if err := d.StopContainer(cleanupCtx, spec.Name); err != nil {
+					logger.Error(fmt.Sprintf("Failed to stop Docker container: %s", err))
+				}
+			}
+			if err := d.RemoveContainer(cleanupCtx, spec.Name); err != nil {
+				logger.Error(fmt.Sprintf("Failed to remove Docker container: %s", err))
+			}
+		}()
+	}
+	if err := d.startContainer(ctx, spec.Name); err != nil {
+		return nil, err
+	}
+
+	var waitResult struct {
+		StatusCode int `json:"StatusCode"`
+	}
+	if err := d.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(spec.Name)+"/wait", nil, nil, &waitResult); err != nil {
+		return nil, err
+	}
+
+	logs, err := d.request(ctx, http.MethodGet, "/containers/"+url.PathEscape(spec.Name)+"/logs", url.Values{"stdout": []string{"1"}, "stderr": []string{"1"}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer logs.Close()
+
+	var stdout, stderr bytes.Buffer
+	if err := demuxDockerStream(logs, &stdout, &stderr); err != nil {
+		return nil, err
+	}
+
+	if waitResult.StatusCode != 0 {
+		return nil, &ContainerExitError{Name: spec.Name, StatusCode: waitResult.StatusCode, Stderr: stderr.String()}
+	}
+	return stdout.Bytes(), nil
+}
+
+// demuxDockerStream splits the multiplexed stream of a container without TTY into stdout and stderr.
+// Each frame starts with 8 bytes header: [stream type, 0, 0, 0, size(big endian uint32)].
+func demuxDockerStream(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		var w io.Writer
+		switch header[0] {
+		case 0, 1:
+			w = stdout
+		case 2:
+			w = stderr
+		default:
+			return fmt.Errorf("unknown stream type: %d", header[0])
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *dockerRuntime) ContainerIP(ctx context.Context, name string) (string, error) {
+	var inspect struct {
+		NetworkSettings struct {
+			Networks map[string]struct {
+				IPAddress string `json:"IPAddress"`
+			} `json:"Networks"`
+		} `json:"NetworkSettings"`
+	}
+	if err := d.call(ctx, http.MethodGet, "/containers/"+url.PathEscape(name)+"/json", nil, nil, &inspect); err != nil {
+		return "", err
+	}
+
+	// same order as `{{range.NetworkSettings.Networks}}`, which iterates over sorted keys.
+	networks := make([]string, 0, len(inspect.NetworkSettings.Networks))
+	for network := range inspect.NetworkSettings.Networks {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+
+	var ip string
+	for _, network := range networks {
+		ip += inspect.NetworkSettings.Networks[network].IPAddress
+	}
+	return ip, nil
+}
+
+func (d *dockerRuntime) ExecDetached(ctx context.Context, name string, cmd []string) error {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	body := map[string]any{
+		"Cmd":          cmd,
+		"AttachStdout": false,
+		"AttachStderr": false,
+	}
+	if err := d.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(name)+"/exec", nil, body, &created); err != nil {
+		return err
+	}
+	return d.call(ctx, http.MethodPost, "/exec/"+url.PathEscape(created.ID)+"/start", nil, map[string]any{"Detach": true}, nil)
+}
+
+func (d *dockerRuntime) CopyFromContainer(ctx context.Context, name, srcPath, dstPath string) error {
+	archive, err := d.request(ctx, http.MethodGet, "/containers/"+url.PathEscape(name)+"/archive", url.Values{"path": []string{srcPath}}, nil)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	return extractSingleFile(archive, dstPath)
+}
+
+// extractSingleFile writes the first regular file in the tar stream to dstPath.
+func extractSingleFile(r io.Reader, dstPath string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("no regular file in archive")
+			}
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		file, err := os.Create(dstPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(file, tr)
+		return err
+	}
+}
+
+func (d *dockerRuntime) StopContainer(ctx context.Context, name string) error {
+	return d.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(name)+"/stop", nil, nil, nil)
+}
+
+func (d *dockerRuntime) RemoveContainer(ctx context.Context, name string) error {
+	return d.call(ctx, http.MethodDelete, "/containers/"+url.PathEscape(name), nil, nil, nil)
+}
+
+func (d *dockerRuntime) InspectImage(ctx context.Context, image string) (ImageInfo, error) {
+	var inspect struct {
+		ID          string   `json:"Id"`
+		RepoDigests []string `json:"RepoDigests"`
+		Created     string   `json:"Created"`
+		Config      struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	// the image name may contain "/", which is a part of the path of the API.
+	if err := d.call(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil, &inspect); err != nil {
+		return ImageInfo{}, err
+	}
+	return ImageInfo{
+		ID:          inspect.ID,
+		RepoDigests: inspect.RepoDigests,
+		Created:     inspect.Created,
+		Labels:      inspect.Config.Labels,
+	}, nil
+}
+
+func (d *dockerRuntime) ListContainers(ctx context.Context) ([]string, error) {
+	var containers []struct {
+		Names []string `json:"Names"`
+	}
+	if err := d.call(ctx, http.MethodGet, "/containers/json", url.Values{"all": []string{"1"}}, nil, &containers); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, c := range containers {
+		for _, name := range c.Names {
+			// the API returns the names with a leading slash, e.g. /unbound-example.com-with-cache-with-dane
+			names = append(names, strings.TrimPrefix(name, "/"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (d *dockerRuntime) ListNetworks(ctx context.Context) ([]string, error) {
+	var networks []struct {
+		Name string `json:"Name"`
+	}
+	if err := d.call(ctx, http.MethodGet, "/networks", nil, nil, &networks); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(networks))
+	for _, n := range networks {
+		names = append(names, n.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (d *dockerRuntime) ContainerStats(ctx context.Context, name string) (ContainerStats, error) {
+	var stats struct {
+		Read     time.Time `json:"read"`
+		CPUStats struct {
+			CPUUsage struct {
+				TotalUsage uint64 `json:"total_usage"`
+			} `json:"cpu_usage"`
+			SystemCPUUsage uint64 `json:"system_cpu_usage"`
+			OnlineCPUs     int    `json:"online_cpus"`
+		} `json:"cpu_stats"`
+		MemoryStats struct {
+			Usage uint64            `json:"usage"`
+			Limit uint64            `json:"limit"`
+			Stats map[string]uint64 `json:"stats"`
+		} `json:"memory_stats"`
+		Networks map[string]struct {
+			RxBytes uint64 `json:"rx_bytes"`
+			TxBytes uint64 `json:"tx_bytes"`
+		} `json:"networks"`
+	}
+	// one-shot returns the current usage at once instead of waiting for the second sample to fill precpu_stats.
+	query := url.Values{"stream": []string{"false"}, "one-shot": []string{"true"}}
+	if err := d.call(ctx, http.MethodGet, "/containers/"+url.PathEscape(name)+"/stats", query, nil, &stats); err != nil {
+		return ContainerStats{}, err
+	}
+
+	result := ContainerStats{
+		CPUUsage:       stats.CPUStats.CPUUsage.TotalUsage,
+		SystemCPUUsage: stats.CPUStats.SystemCPUUsage,
+		OnlineCPUs:     stats.CPUStats.OnlineCPUs,
+		MemoryUsage:    stats.MemoryStats.Usage,
+		MemoryLimit:    stats.MemoryStats.Limit,
+	}
+	// a stopped container has the zero time "0001-01-01T00:00:00Z".
+	if !stats.Read.IsZero() {
+		result.Read = stats.Read
+	}
+	// same as docker stats: the page cache is inactive_file with cgroup v2 and total_inactive_file with cgroup v1.
+	for _, key := range []string{"inactive_file", "total_inactive_file"} {
+		if cache, ok := stats.MemoryStats.Stats[key]; ok {
+			if cache < result.MemoryUsage {
+				result.MemoryUsage -= cache
+			}
+			break
+		}
+	}
+	for _, network := range stats.Networks {
+		result.NetworkRx += network.RxBytes
+		result.NetworkTx += network.TxBytes
+	}
+	return result, nil
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// frame encodes a frame of the multiplexed stream of a container.
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestDemuxDockerStream(t *testing.T) {
+	var stream []byte
+	stream = append(stream, frame(1, `{"log":`)...)
+	stream = append(stream, frame(2, "warning\n")...)
+	stream = append(stream, frame(1, `{}}`)...)
+
+	var stdout, stderr bytes.Buffer
+	if err := demuxDockerStream(bytes.NewReader(stream), &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != `{"log":{}}` {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+	if stderr.String() != "warning\n" {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+
+	if err := demuxDockerStream(bytes.NewReader(stream[:10]), &stdout, &stderr); err == nil {
+		t.Error("want error for truncated stream")
+	}
+}
+
+func newTestDockerRuntime(t *testing.T, handler http.Handler) *dockerRuntime {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	rt, err := newDockerRuntime("tcp://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rt
+}
+
+func TestDockerRuntimeRunContainer(t *testing.T) {
+	var created map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /containers/create", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") != "firefox-example.com" {
+			t.Errorf("name = %s", r.URL.Query().Get("name"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abc"}`))
+	})
+	mux.HandleFunc("POST /containers/firefox-example.com/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /containers/firefox-example.com/wait", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"StatusCode":0}`))
+	})
+	mux.HandleFunc("GET /containers/firefox-example.com/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(frame(1, `{"log":{}}`))
+		w.Write(frame(2, "done"))
+	})
+
+	rt := newTestDockerRuntime(t, mux)
+	got, err := rt.RunContainer(context.Background(), ContainerSpec{
+		Image:   firefoxHARImageName,
+		Name:    "firefox-example.com",
+		Network: "network-example.com",
+		Cmd:     []string{"https://example.com", "-ri", "172.18.0.2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"log":{}}` {
+		t.Errorf("stdout = %q", got)
+	}
+	if created["Image"] != firefoxHARImageName {
+		t.Errorf("image = %v", created["Image"])
+	}
+	hostConfig := created["HostConfig"].(map[string]any)
+	if hostConfig["NetworkMode"] != "network-example.com" {
+		t.Errorf("network = %v", hostConfig["NetworkMode"])
+	}
+}
+
+func TestDockerRuntimeRunContainerExitError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /containers/create", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abc"}`))
+	})
+	mux.HandleFunc("POST /containers/firefox/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /containers/firefox/wait", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"StatusCode":137}`))
+	})
+	mux.HandleFunc("GET /containers/firefox/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(frame(2, "killed"))
+	})
+
+	rt := newTestDockerRuntime(t, mux)
+	_, err := rt.RunContainer(context.Background(), ContainerSpec{Image: firefoxHARImageName, Name: "firefox"})
+
+	var exitErr *ContainerExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("error = %v, want ContainerExitError", err)
+	}
+	if exitErr.StatusCode != 137 || exitErr.Stderr != "killed" {
+		t.Errorf("exit error = %+v", exitErr)
+	}
+}
+
+func TestDockerRuntimeAPIError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /containers/unbound/stop", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+	mux.HandleFunc("DELETE /networks/network", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"network network not found"}`))
+	})
+
+	rt := newTestDockerRuntime(t, mux)
+	if err := rt.StopContainer(context.Background(), "unbound"); err != nil {
+		t.Errorf("StopContainer() error = %v, want nil for already stopped container", err)
+	}
+
+	err := rt.RemoveNetwork(context.Background(), "network")
+	if !isNotFound(err) {
+		t.Fatalf("RemoveNetwork() error = %v, want not found", err)
+	}
+	if !strings.Contains(err.Error(), "network network not found") {
+		t.Errorf("error message = %s", err)
+	}
+}
+
+func TestDockerRuntimeContainerIPAndCopy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/unbound/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"NetworkSettings":{"Networks":{"network-example.com":{"IPAddress":"172.18.0.2"}}}}`))
+	})
+	mux.HandleFunc("GET /containers/unbound/archive", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("path") != unboundPcapFilePath {
+			t.Errorf("path = %s", r.URL.Query().Get("path"))
+		}
+		tw := tar.NewWriter(w)
+		tw.WriteHeader(&tar.Header{Name: "unbound.pcap", Mode: 0644, Size: 4, Typeflag: tar.TypeReg})
+		tw.Write([]byte("pcap"))
+		tw.Close()
+	})
+
+	rt := newTestDockerRuntime(t, mux)
+	ip, err := rt.ContainerIP(context.Background(), "unbound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "172.18.0.2" {
+		t.Errorf("ip = %s", ip)
+	}
+
+	dst := filepath.Join(t.TempDir(), "unbound-example.com.pcap")
+	if err := rt.CopyFromContainer(context.Background(), "unbound", unboundPcapFilePath, dst); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "pcap" {
+		t.Errorf("copied file = %q", got)
+	}
+}
+
+func TestDockerRuntimeStartContainerWithFiles(t *testing.T) {
+	var calls []string
+	files := make(map[string]string)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /containers/create", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "create")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abc"}`))
+	})
+	mux.HandleFunc("PUT /containers/unbound/archive", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "archive")
+		if r.URL.Query().Get("path") != "/" || r.Header.Get("Content-Type") != "application/x-tar" {
+			t.Errorf("path = %s, content type = %s", r.URL.Query().Get("path"), r.Header.Get("Content-Type"))
+		}
+		tr := tar.NewReader(r.Body)
+		for {
+			header, err := tr.Next()
+			if err != nil {
+				break
+			}
+			var buf bytes.Buffer
+			buf.ReadFrom(tr)
+			files[header.Name] = buf.String()
+		}
+	})
+	mux.HandleFunc("POST /containers/unbound/start", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "start")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	rt := newTestDockerRuntime(t, mux)
+	err := rt.StartContainer(context.Background(), ContainerSpec{
+		Image: unboundImageName,
+		Name:  "unbound",
+		Files: map[string][]byte{unboundConfPath: []byte("server:\n")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the files are written before unbound reads them.
+	if want := []string{"create", "archive", "start"}; !slices.Equal(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	if files["usr/local/etc/unbound/unbound.conf"] != "server:\n" {
+		t.Errorf("files = %q", files)
+	}
+}
+
+func TestDockerRuntimeStartContainerWithFilesCleanup(t *testing.T) {
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /containers/create", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "create")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abc"}`))
+	})
+	mux.HandleFunc("PUT /containers/unbound/archive", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "archive")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"message":"no space left on device"}`))
+	})
+	mux.HandleFunc("DELETE /containers/unbound", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "remove force="+r.URL.Query().Get("force"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	rt := newTestDockerRuntime(t, mux)
+	err := rt.StartContainer(context.Background(), ContainerSpec{
+		Image: unboundImageName,
+		Name:  "unbound",
+		Files: map[string][]byte{unboundConfPath: []byte("server:\n")},
+	})
+	if err == nil || !strings.Contains(err.Error(), "no space left on device") {
+		t.Fatalf("StartContainer() error = %v, want the error of the archive", err)
+	}
+	// the created container is removed instead of being started.
+	if want := []string{"create", "archive", "remove force=1"}; !slices.Equal(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+
+	calls = nil
+	err = rt.StartContainer(context.Background(), ContainerSpec{
+		Image: unboundImageName,
+		Name:  "unbound",
+		Files: map[string][]byte{"relative/unbound.conf": []byte("server:\n")},
+	})
+	if err == nil {
+		t.Fatal("StartContainer() with a relative file path should fail")
+	}
+	if want := []string{"create", "remove force=1"}; !slices.Equal(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+
+	// the container is removed if it cannot be started, e.g. because its port is in use.
+	mux.HandleFunc("PUT /containers/letsdane/archive", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "archive")
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("POST /containers/letsdane/start", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "start")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"message":"port is already allocated"}`))
+	})
+	mux.HandleFunc("DELETE /containers/letsdane", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "remove force="+r.URL.Query().Get("force"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	calls = nil
+	err = rt.StartContainer(context.Background(), ContainerSpec{
+		Image:      letsdaneImageName,
+		Name:       "letsdane",
+		Files:      map[string][]byte{"/root/.letsdane/cert.crt": []byte("cert")},
+		AutoRemove: true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "port is already allocated") {
+		t.Fatalf("StartContainer() error = %v, want the error of the start", err)
+	}
+	if want := []string{"create", "archive", "start", "remove force=1"}; !slices.Equal(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+}
+
+func TestDockerRuntimeList(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("all") != "1" {
+			t.Errorf("all = %q, want stopped containers too", r.URL.Query().Get("all"))
+		}
+		w.Write([]byte(`[{"Names":["/unbound-example.com-with-cache-with-dane"]},{"Names":["/firefox-example.com-with-cache-with-dane"]}]`))
+	})
+	mux.HandleFunc("GET /networks", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"Name":"network-example.com-with-cache-with-dane"},{"Name":"bridge"}]`))
+	})
+
+	rt := newTestDockerRuntime(t, mux)
+	containers, err := rt.ListContainers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"firefox-example.com-with-cache-with-dane", "unbound-example.com-with-cache-with-dane"}; !slices.Equal(containers, want) {
+		t.Errorf("ListContainers() = %q, want %q", containers, want)
+	}
+	networks, err := rt.ListNetworks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bridge", "network-example.com-with-cache-with-dane"}; !slices.Equal(networks, want) {
+		t.Errorf("ListNetworks() = %q, want %q", networks, want)
+	}
+}
+
+func TestDockerRuntimeContainerStats(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/unbound/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("stream") != "false" {
+			t.Errorf("stream = %q, want false", r.URL.Query().Get("stream"))
+		}
+		w.Write([]byte(`{
+			"read": "2024-05-01T00:00:01Z",
+			"cpu_stats": {"cpu_usage": {"total_usage": 200}, "system_cpu_usage": 1000, "online_cpus": 4},
+			"memory_stats": {"usage": 5000, "limit": 10000, "stats": {"inactive_file": 1000}},
+			"networks": {"eth0": {"rx_bytes": 10, "tx_bytes": 20}, "eth1": {"rx_bytes": 1, "tx_bytes": 2}}
+		}`))
+	})
+	mux.HandleFunc("GET /containers/firefox/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"read": "0001-01-01T00:00:00Z"}`))
+	})
+
+	rt := newTestDockerRuntime(t, mux)
+	stats, err := rt.ContainerStats(context.Background(), "unbound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ContainerStats{
+		Read:           time.Date(2024, 5, 1, 0, 0, 1, 0, time.UTC),
+		CPUUsage:       200,
+		SystemCPUUsage: 1000,
+		OnlineCPUs:     4,
+		MemoryUsage:    4000,
+		MemoryLimit:    10000,
+		NetworkRx:      11,
+		NetworkTx:      22,
+	}
+	if !stats.Read.Equal(want.Read) {
+		t.Errorf("read = %s, want %s", stats.Read, want.Read)
+	}
+	stats.Read = want.Read
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	stopped, err := rt.ContainerStats(context.Background(), "firefox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stopped.Read.IsZero() {
+		t.Errorf("read = %s, want zero for a stopped container", stopped.Read)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// measurementOverhead is a rough time to create the network, start the containers and copy the results
+// of a measurement, which is added to the page load timeouts in the estimate of -dry-run.
+const measurementOverhead = 15 * time.Second
+
+// plannedMeasurement is a measurement which would be started by run.
+type plannedMeasurement struct {
+	// Index is the 1-based index of the page in the domain list.
+	Index         int
+	Website       string
+	Scenario      scenario
+	Trial         int
+	MeasurementID string
+	Network       string
+	// Containers are the names of the containers of the measurement, including the ones to fill the cache.
+	Containers []string
+	// HARPath is the HAR file of the measurement. The other results are written in the same directory.
+	HARPath string
+}
+
+// plannedImage is an image used by the scenarios and the result of inspecting it.
+type plannedImage struct {
+	// Role is the field of experimentImages, e.g. unbound.
+	Role string
+	Name string
+	ID   string
+	Err  error
+}
+
+// runPlan is what run would do for the experiment, which is printed by -dry-run.
+type runPlan struct {
+	Experiment *experiment
+	Scenarios  []scenario
+	// Domains is the number of pages from input.first to input.last, and ListSize is the number of pages in the list.
+	Domains      int
+	ListSize     int
+	Measurements []plannedMeasurement
+	// Finished is the number of measurements skipped because they are finished in the journal with -resume.
+	Finished int
+	// Estimate is the time of the run when every page load times out.
+	Estimate time.Duration
+	Images   []plannedImage
+	// ResultDirErr is not nil if the result sub directory cannot be written.
+	ResultDirErr error
+}
+
+// newRunPlan resolves the pages, the scenarios and the names of every measurement like run, and checks
+// that the images exist and the result sub directory is writable. It does not start any container.
+func newRunPlan(ctx context.Context, rt ContainerRuntime, exp *experiment, resume bool) (*runPlan, error) {
+	scenarios, err := exp.scenarioList()
+	if err != nil {
+		return nil, err
+	}
+	subsetDomainList, listSize, err := subsetDomains(exp)
+	if err != nil {
+		return nil, err
+	}
+
+	resultSubDirectoryPath := exp.resultSubDirectoryPath()
+	finished := make(map[journalKey]bool)
+	if resume {
+		finished, err = resumedMeasurements(filepath.Join(resultSubDirectoryPath, journalFileName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &runPlan{
+		Experiment: exp,
+		Scenarios:  scenarios,
+		Domains:    len(subsetDomainList),
+		ListSize:   listSize,
+	}
+	// the domains are dispatched in order to the first free goroutine, so the run ends when the busiest one ends.
+	busy := make([]time.Duration, exp.Concurrency)
+	for index, record := range subsetDomainList {
+		outPutDir := filepath.Join(resultSubDirectoryPath, record.Slug())
+		var domainTime time.Duration
+		for trial := 1; trial <= exp.Trials; trial++ {
+			for _, s := range scenarios {
+				if finished[journalKey{Domain: record.Slug(), Scenario: s.String(), Trial: trial}] {
+					plan.Finished++
+					continue
+				}
+				measurementID := trialMeasurementID(record, s, trial, exp.Trials)
+				opts := measurementCommandOptions(exp, record, s, measurementID, outPutDir)
+				plan.Measurements = append(plan.Measurements, plannedMeasurement{
+					Index:         exp.Input.First + index,
+					Website:       opts.HAROpts.Website,
+					Scenario:      s,
+					Trial:         trial,
+					MeasurementID: measurementID,
+					Network:       opts.HARDockerRunOpts.NetWork,
+					Containers:    plannedContainers(opts),
+					HARPath:       filepath.Join(outPutDir, measurementID+".har"),
+				})
+				domainTime += worstMeasurementTime(exp, s)
+			}
+		}
+		if domainTime == 0 {
+			continue
+		}
+		next := 0
+		for i := range busy {
+			if busy[i] < busy[next] {
+				next = i
+			}
+		}
+		busy[next] += domainTime
+	}
+	for _, d := range busy {
+		plan.Estimate = max(plan.Estimate, d)
+	}
+
+	images := experimentImagesOf(exp, scenarios)
+	roles := make([]string, 0, len(images))
+	for role := range images {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		image := plannedImage{Role: role, Name: images[role]}
+		info, err := rt.InspectImage(ctx, image.Name)
+		image.ID, image.Err = info.ID, err
+		plan.Images = append(plan.Images, image)
+	}
+
+	plan.ResultDirErr = checkWritable(resultSubDirectoryPath)
+	return plan, nil
+}
+
+// plannedContainers returns the names of the containers which collectHAR starts with the options.
+func plannedContainers(opts *commandOptions) []string {
+	containers := measurementContainers(opts)
+	if opts.Cache && opts.HAROpts.DANE {
+		containers = append(containers, opts.LetsdaneDockerRunOpts.ContainerName+"-fill-cache")
+	}
+	if opts.Cache && opts.HTTPProbeOpts == nil {
+		containers = append(containers, opts.HARDockerRunOpts.ContainerName+"-fill-cache")
+	}
+	return containers
+}
+
+// worstMeasurementTime is the time of a measurement in the scenario when every page load times out.
+// The page is loaded once more with the cache, to fill the cache, and with the repeat visit, to fill the cache of Firefox.
+func worstMeasurementTime(exp *experiment, s scenario) time.Duration {
+	timeout := time.Duration(exp.Firefox.TimeoutSeconds) * time.Second
+	if exp.Probe == probeHTTP {
+		timeout = time.Duration(exp.HTTPProbe.TimeoutSeconds) * time.Second
+	}
+	loads := 1
+	if s.Cache {
+		loads++
+	}
+	if s.RepeatVisit {
+		loads++
+	}
+	return time.Duration(loads)*timeout + measurementOverhead
+}
+
+// checkWritable checks that a file can be created in the directory, or in its nearest existing parent
+// if it does not exist yet, without creating the directory.
+func checkWritable(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+	file, err := os.CreateTemp(dir, ".pageloadtime-dry-run-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// problems returns what would make the run fail.
+func (p *runPlan) problems() []string {
+	var problems []string
+	for _, image := range p.Images {
+		if image.Err != nil {
+			problems = append(problems, fmt.Sprintf("image %s (%s) is not found: %s", image.Name, image.Role, image.Err))
+		}
+	}
+	if p.ResultDirErr != nil {
+		problems = append(problems, fmt.Sprintf("result directory %s is not writable: %s", p.Experiment.resultSubDirectoryPath(), p.ResultDirErr))
+	}
+	return problems
+}
+
+// write prints the plan for a human.
+func (p *runPlan) write(w io.Writer) error {
+	exp := p.Experiment
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	timeout := fmt.Sprintf("firefox.timeoutSeconds %d", exp.Firefox.TimeoutSeconds)
+	if exp.Probe == probeHTTP {
+		timeout = fmt.Sprintf("httpProbe.timeoutSeconds %d", exp.HTTPProbe.TimeoutSeconds)
+	}
+	fmt.Fprintf(tw, "input:\t%s (domains %d-%d of %d)\n", exp.Input.CSV, exp.Input.First, exp.Input.First+p.Domains-1, p.ListSize)
+	fmt.Fprintf(tw, "scenarios:\t%s\n", strings.Join(scenarioNames(p.Scenarios), ", "))
+	fmt.Fprintf(tw, "trials:\t%d\n", exp.Trials)
+	fmt.Fprintf(tw, "probe:\t%s (%s)\n", exp.Probe, timeout)
+	fmt.Fprintf(tw, "concurrency:\t%d\n", exp.Concurrency)
+	fmt.Fprintf(tw, "result directory:\t%s\n", exp.resultSubDirectoryPath())
+	if exp.Output.Store.URL != "" {
+		fmt.Fprintf(tw, "result store:\t%s\n", exp.Output.Store.URL)
+	}
+	fmt.Fprintf(tw, "measurements:\t%d (%d finished in the journal)\n", len(p.Measurements), p.Finished)
+	fmt.Fprintf(tw, "estimate:\tat most %s if every page load times out, with %s per measurement to run the containers\n", p.Estimate, measurementOverhead)
+	fmt.Fprintln(tw)
+
+	for _, image := range p.Images {
+		status := image.ID
+		if image.Err != nil {
+			status = "NOT FOUND: " + image.Err.Error()
+		}
+		fmt.Fprintf(tw, "image %s:\t%s\t%s\n", image.Role, image.Name, status)
+	}
+	status := "writable"
+	if p.ResultDirErr != nil {
+		status = "NOT WRITABLE: " + p.ResultDirErr.Error()
+	}
+	fmt.Fprintf(tw, "result directory:\t%s\n", status)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "#\twebsite\tscenario\ttrial\tnetwork\tcontainers\thar")
+	for _, m := range p.Measurements {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n", m.Index, m.Website, m.Scenario, m.Trial, m.Network, strings.Join(m.Containers, ","), m.HARPath)
+	}
+	return tw.Flush()
+}
+
+// dryRun prints the plan of the experiment to w. It returns an error if the run would fail.
+func dryRun(ctx context.Context, rt ContainerRuntime, exp *experiment, resume bool, w io.Writer) error {
+	plan, err := newRunPlan(ctx, rt, exp, resume)
+	if err != nil {
+		return err
+	}
+	if err := plan.write(w); err != nil {
+		return err
+	}
+	if problems := plan.problems(); len(problems) > 0 {
+		return errors.New("dry run found problems: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
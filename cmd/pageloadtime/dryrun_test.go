@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDryRun(t *testing.T) {
+	dir := t.TempDir()
+	inputCSV := filepath.Join(dir, "domains.csv")
+	writeFile(t, inputCSV, "a.example\nb.example\nc.example\n")
+
+	exp := defaultExperiment(time.Now())
+	exp.Input = experimentInput{CSV: inputCSV, First: 2, Last: 3}
+	exp.Scenarios = []string{"without-cache-without-dane", "with-cache-with-dane"}
+	exp.Trials = 2
+	exp.Concurrency = 2
+	exp.Output = experimentOutput{Directory: filepath.Join(dir, "result"), SubDirName: "tokyo-01"}
+
+	rt := newFakeRuntime()
+	plan, err := newRunPlan(context.Background(), rt, exp, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Measurements) != 8 {
+		t.Fatalf("planned %d measurements, want 8", len(plan.Measurements))
+	}
+	m := plan.Measurements[3]
+	if m.Index != 2 || m.Website != "https://b.example" || m.Trial != 2 || m.MeasurementID != "b.example-with-cache-with-dane-trial-2" {
+		t.Errorf("measurement = %+v", m)
+	}
+	wantContainers := []string{
+		"unbound-b.example-with-cache-with-dane-trial-2",
+		"letsdane-b.example-with-cache-with-dane-trial-2",
+		"firefox-b.example-with-cache-with-dane-trial-2",
+		"letsdane-b.example-with-cache-with-dane-trial-2-fill-cache",
+		"firefox-b.example-with-cache-with-dane-trial-2-fill-cache",
+	}
+	if m.Network != "network-b.example-with-cache-with-dane-trial-2" || !slices.Equal(m.Containers, wantContainers) {
+		t.Errorf("network = %s, containers = %q, want %q", m.Network, m.Containers, wantContainers)
+	}
+	if want := filepath.Join(dir, "result", "tokyo-01", "b.example", "b.example-with-cache-with-dane-trial-2.har"); m.HARPath != want {
+		t.Errorf("har = %s, want %s", m.HARPath, want)
+	}
+
+	// each domain takes 2 trials of (30s + 15s) and (2 * 30s + 15s) on its own goroutine.
+	if want := 240 * time.Second; plan.Estimate != want {
+		t.Errorf("estimate = %s, want %s", plan.Estimate, want)
+	}
+	if problems := plan.problems(); len(problems) != 0 {
+		t.Errorf("problems = %q", problems)
+	}
+	for _, call := range rt.Calls() {
+		if !strings.HasPrefix(call, "InspectImage ") {
+			t.Errorf("dry run called %s", call)
+		}
+	}
+	if _, err := os.Stat(exp.resultSubDirectoryPath()); !os.IsNotExist(err) {
+		t.Errorf("dry run created the result directory: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := plan.write(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"domains 2-3 of 3", "8 (0 finished in the journal)", "at most 4m0s", "firefox-b.example-with-cache-with-dane-trial-2-fill-cache"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestDryRunProblems(t *testing.T) {
+	dir := t.TempDir()
+	inputCSV := filepath.Join(dir, "domains.csv")
+	writeFile(t, inputCSV, "a.example\n")
+	// the result directory cannot be created under a file.
+	writeFile(t, filepath.Join(dir, "result"), "")
+
+	exp := defaultExperiment(time.Now())
+	exp.Input.CSV = inputCSV
+	exp.Scenarios = []string{"with-cache-with-dane"}
+	exp.Output = experimentOutput{Directory: filepath.Join(dir, "result"), SubDirName: "tokyo-01"}
+
+	rt := newFakeRuntime()
+	rt.failOn("InspectImage", exp.Images.Letsdane, errors.New("No such image"))
+	var out bytes.Buffer
+	err := dryRun(context.Background(), rt, exp, false, &out)
+	if err == nil {
+		t.Fatal("dryRun() = nil, want the missing image and the result directory")
+	}
+	for _, want := range []string{"image " + exp.Images.Letsdane + " (letsdane) is not found", "is not writable"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("dryRun() = %v, want %q", err, want)
+		}
+	}
+	if !strings.Contains(out.String(), "NOT FOUND") {
+		t.Errorf("plan does not show the missing image:\n%s", out.String())
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yagikota/danewebperf/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// experiment is the definition of a measurement run. It is loaded from a YAML or JSON file given by -experiment,
+// and the fields which are not in the file keep the default values of defaultExperiment.
+//
+// e.g.
+//
+//	input:
+//	  csv: ../../dataset/hall-of-flame-websites-tlsa-usage3.csv
+//	scenarios: [all]
+//	impairments: [none, rtt50]
+//	trials: 3
+//	concurrency: 20
+//	probe: firefox
+//	firefox:
+//	  timeoutSeconds: 60
+type experiment struct {
+	Input     experimentInput `json:"input" yaml:"input"`
+	Scenarios []string        `json:"scenarios" yaml:"scenarios"`
+	// Impairments are the names of the network impairment profiles to measure every scenario with.
+	// "none" is the network without impairment. If empty, only "none" is measured.
+	Impairments []string `json:"impairments" yaml:"impairments"`
+	// ImpairmentProfiles defines profiles in addition to builtinImpairments.
+	ImpairmentProfiles map[string]impairmentProfile `json:"impairmentProfiles" yaml:"impairmentProfiles"`
+	Trials             int                          `json:"trials" yaml:"trials"`
+	Concurrency        int                          `json:"concurrency" yaml:"concurrency"`
+	Images             experimentImages             `json:"images" yaml:"images"`
+	Unbound            experimentUnbound            `json:"unbound" yaml:"unbound"`
+	Letsdane           experimentLetsdane           `json:"letsdane" yaml:"letsdane"`
+	// Probe is how to load the page: probeFirefox or probeHTTP.
+	Probe     string              `json:"probe" yaml:"probe"`
+	Firefox   experimentFirefox   `json:"firefox" yaml:"firefox"`
+	HTTPProbe experimentHTTPProbe `json:"httpProbe" yaml:"httpProbe"`
+	Resources experimentResources `json:"resources" yaml:"resources"`
+	Output    experimentOutput    `json:"output" yaml:"output"`
+}
+
+type experimentInput struct {
+	// CSV is the domain list. The first column of each row is the domain.
+	CSV string `json:"csv" yaml:"csv"`
+	// First and Last are the 1-based range of the domain list to measure. Last -1 means the end of the list.
+	First int `json:"first" yaml:"first"`
+	Last  int `json:"last" yaml:"last"`
+}
+
+type experimentImages struct {
+	// Unbound runs with unbound.conf rendered from experimentUnbound in every scenario.
+	Unbound  string `json:"unbound" yaml:"unbound"`
+	Letsdane string `json:"letsdane" yaml:"letsdane"`
+	Firefox  string `json:"firefox" yaml:"firefox"`
+}
+
+type experimentUnbound struct {
+	// WithCache is the configuration of unbound in the scenarios with cache, and WithoutCache in the others.
+	WithCache    unboundConfig `json:"withCache" yaml:"withCache"`
+	WithoutCache unboundConfig `json:"withoutCache" yaml:"withoutCache"`
+}
+
+type experimentLetsdane struct {
+	// Args are passed to letsdane in addition to `-r [unbound ip]`, which is set by pageloadtime.
+	Args []string `json:"args" yaml:"args"`
+	// FillCacheArgs are used instead of Args for letsdane which fills the cache before the measurement.
+	FillCacheArgs []string `json:"fillCacheArgs" yaml:"fillCacheArgs"`
+	// ResolverModes are the resolvers of letsdane to measure every scenario with DANE with: stub or recursive.
+	// -skip-dnssec is added to or removed from Args and FillCacheArgs by the mode. If empty, Args decide the resolver.
+	ResolverModes []string `json:"resolverModes" yaml:"resolverModes"`
+}
+
+type experimentFirefox struct {
+	// TimeoutSeconds is the maximum time to wait for the page load.
+	TimeoutSeconds int `json:"timeoutSeconds" yaml:"timeoutSeconds"`
+	// Visits are the loads of the page to measure every scenario with: first or repeat.
+	// repeat loads the page twice in the same profile and measures the second load. If empty, only first is measured.
+	Visits []string `json:"visits" yaml:"visits"`
+}
+
+type experimentHTTPProbe struct {
+	// CACert is the certificate of letsdane, which the http probe trusts in addition to the system certificates.
+	CACert string `json:"caCert" yaml:"caCert"`
+	// TimeoutSeconds is the maximum time to load the page including the redirects.
+	TimeoutSeconds int `json:"timeoutSeconds" yaml:"timeoutSeconds"`
+}
+
+type experimentResources struct {
+	// IntervalMilliseconds is the interval of sampling the CPU, memory and network I/O of the containers while loading the page.
+	// 0 disables the sampling.
+	IntervalMilliseconds int `json:"intervalMilliseconds" yaml:"intervalMilliseconds"`
+	// SaturationPercent is the mean CPU usage of the host while loading the page from which the measurement is marked as host_saturated.
+	SaturationPercent float64 `json:"saturationPercent" yaml:"saturationPercent"`
+}
+
+type experimentOutput struct {
+	// Directory is the parent directory of the results of all runs.
+	Directory string `json:"directory" yaml:"directory"`
+	// SubDirName is the directory of this run under Directory. It is also the measurement ID in the result store.
+	SubDirName string `json:"subDirName" yaml:"subDirName"`
+	// Store is the result store where the result sub directory is uploaded after the run.
+	// If its URL is empty, the results are kept only in Directory.
+	Store storage.Config `json:"store" yaml:"store"`
+}
+
+// defaultExperiment is the same as running pageloadtime without any flags.
+func defaultExperiment(start time.Time) *experiment {
+	return &experiment{
+		Input: experimentInput{
+			CSV:   defaultInputCSV,
+			First: 1,
+			Last:  -1,
+		},
+		Scenarios:   []string{string(withoutCacheWithoutDane)},
+		Trials:      1,
+		Concurrency: 1,
+		Images: experimentImages{
+			Unbound:  unboundImageName,
+			Letsdane: letsdaneImageName,
+			Firefox:  firefoxHARImageName,
+		},
+		Unbound: experimentUnbound{
+			WithCache:    defaultUnboundWithCache,
+			WithoutCache: defaultUnboundWithoutCache,
+		},
+		Letsdane: experimentLetsdane{
+			Args:          []string{"-verbose", "-cert", "/root/.letsdane/cert.crt", "-key", "/root/.letsdane/cert.key", "-skip-dnssec"},
+			FillCacheArgs: []string{"-verbose", "-cert", "/root/.letsdane/cert.crt", "-key", "/root/.letsdane/cert.key"},
+		},
+		Probe: probeFirefox,
+		Firefox: experimentFirefox{
+			TimeoutSeconds: 30,
+		},
+		HTTPProbe: experimentHTTPProbe{
+			CACert:         defaultLetsdaneCACert,
+			TimeoutSeconds: 30,
+		},
+		Resources: experimentResources{
+			IntervalMilliseconds: 1000,
+			SaturationPercent:    90,
+		},
+		Output: experimentOutput{
+			Directory:  resultDirectoryPath,
+			SubDirName: start.Format("2006-01-02-15-04-05"),
+		},
+	}
+}
+
+// loadExperiment reads the experiment definition file on top of defaultExperiment.
+// The format is decided by the extension: .yaml, .yml or .json. Unknown fields are rejected to catch typos.
+func loadExperiment(path string, start time.Time) (*experiment, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	exp := defaultExperiment(start)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(buf))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(exp); err != nil {
+			return nil, fmt.Errorf("failed to parse experiment %s: %w", path, err)
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(buf))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(exp); err != nil {
+			return nil, fmt.Errorf("failed to parse experiment %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported experiment file extension %q: must be .yaml, .yml or .json", filepath.Ext(path))
+	}
+	return exp, nil
+}
+
+// validate checks all fields and returns every problem at once.
+func (e *experiment) validate() error {
+	var errs []error
+	addErr := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if e.Input.CSV == "" {
+		addErr("input.csv", "must not be empty")
+	} else if info, err := os.Stat(e.Input.CSV); err != nil {
+		addErr("input.csv", "cannot read %s: %s", e.Input.CSV, err)
+	} else if info.IsDir() {
+		addErr("input.csv", "%s is a directory", e.Input.CSV)
+	}
+	if e.Input.First < 1 {
+		addErr("input.first", "must be 1 or more, got %d", e.Input.First)
+	}
+	if e.Input.Last != -1 && e.Input.Last < e.Input.First {
+		addErr("input.last", "must be -1 or more than or equal to input.first (%d), got %d", e.Input.First, e.Input.Last)
+	}
+
+	if _, err := parseScenarios(strings.Join(e.Scenarios, ",")); err != nil {
+		addErr("scenarios", "%s", err)
+	}
+	if _, err := e.impairmentList(); err != nil {
+		addErr("impairments", "%s", err)
+	}
+	profileNames := make([]string, 0, len(e.ImpairmentProfiles))
+	for name := range e.ImpairmentProfiles {
+		profileNames = append(profileNames, name)
+	}
+	sort.Strings(profileNames)
+	for _, name := range profileNames {
+		if !impairmentName.MatchString(name) || name == noImpairment {
+			addErr("impairmentProfiles."+name, "name must consist of lower case letters and digits, and must not be %s", noImpairment)
+		}
+		if err := e.ImpairmentProfiles[name].validate(); err != nil {
+			addErr("impairmentProfiles."+name, "%s", err)
+		}
+	}
+	if e.Trials < 1 {
+		addErr("trials", "must be 1 or more, got %d", e.Trials)
+	}
+	if e.Concurrency < 1 {
+		addErr("concurrency", "must be 1 or more, got %d", e.Concurrency)
+	}
+
+	if e.Images.Unbound == "" {
+		addErr("images.unbound", "must not be empty")
+	}
+	if e.Images.Letsdane == "" {
+		addErr("images.letsdane", "must not be empty")
+	}
+	if e.Images.Firefox == "" {
+		addErr("images.firefox", "must not be empty")
+	}
+
+	errs = append(errs, e.Unbound.WithCache.validate("unbound.withCache")...)
+	errs = append(errs, e.Unbound.WithoutCache.validate("unbound.withoutCache")...)
+
+	if slices.Contains(e.Letsdane.Args, "-r") {
+		addErr("letsdane.args", "-r must not be set because it is the IP address of the unbound container")
+	}
+	if slices.Contains(e.Letsdane.FillCacheArgs, "-r") {
+		addErr("letsdane.fillCacheArgs", "-r must not be set because it is the IP address of the unbound container")
+	}
+	if modes, err := e.resolverModeList(); err != nil {
+		addErr("letsdane.resolverModes", "%s", err)
+	} else if slices.Contains(modes, resolverRecursive) {
+		// letsdane runs with -skip-dnssec against unbound without validation.
+		if scenarios, err := parseScenarios(strings.Join(e.Scenarios, ",")); err == nil && slices.ContainsFunc(scenarios, func(s scenario) bool { return s.DANE && s.WithoutDNSSEC }) {
+			addErr("letsdane.resolverModes", "%s cannot be measured in the scenarios without DNSSEC", resolverRecursive)
+		}
+	}
+
+	visitList, err := e.visitList()
+	if err != nil {
+		addErr("firefox.visits", "%s", err)
+	}
+	switch e.Probe {
+	case probeFirefox:
+		if e.Firefox.TimeoutSeconds < 1 {
+			addErr("firefox.timeoutSeconds", "must be 1 or more, got %d", e.Firefox.TimeoutSeconds)
+		}
+	case probeHTTP:
+		if e.HTTPProbe.CACert != "" {
+			if _, err := os.Stat(e.HTTPProbe.CACert); err != nil {
+				addErr("httpProbe.caCert", "cannot read %s: %s", e.HTTPProbe.CACert, err)
+			}
+		}
+		if e.HTTPProbe.TimeoutSeconds < 1 {
+			addErr("httpProbe.timeoutSeconds", "must be 1 or more, got %d", e.HTTPProbe.TimeoutSeconds)
+		}
+		// netem impairs the packets sent by the containers, but the http probe sends the requests without DANE from the host.
+		if impairments, err := e.impairmentList(); err == nil && (len(impairments) > 1 || impairments[0] != noImpairment) {
+			addErr("impairments", "must be %s with probe %s, because the requests are not sent from the containers", noImpairment, probeHTTP)
+		}
+		if slices.Contains(visitList, repeatVisit) {
+			addErr("firefox.visits", "must not be %s with probe %s, because the http probe has no browser cache", repeatVisit, probeHTTP)
+		}
+	default:
+		addErr("probe", "must be %s or %s, got %q", probeFirefox, probeHTTP, e.Probe)
+	}
+
+	if e.Resources.IntervalMilliseconds < 0 {
+		addErr("resources.intervalMilliseconds", "must be 0 or more, got %d", e.Resources.IntervalMilliseconds)
+	}
+	if e.Resources.SaturationPercent <= 0 || e.Resources.SaturationPercent > 100 {
+		addErr("resources.saturationPercent", "must be more than 0 and 100 or less, got %g", e.Resources.SaturationPercent)
+	}
+
+	if e.Output.Directory == "" {
+		addErr("output.directory", "must not be empty")
+	}
+	if e.Output.SubDirName == "" {
+		addErr("output.subDirName", "must not be empty")
+	} else if strings.ContainsRune(e.Output.SubDirName, filepath.Separator) || e.Output.SubDirName == "." || e.Output.SubDirName == ".." {
+		addErr("output.subDirName", "must be a directory name, got %q", e.Output.SubDirName)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid experiment:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// scenarioList returns the scenarios to measure. Every scenario is measured with each impairment in order,
+// every scenario with DANE with each resolver of letsdane, and every scenario with each visit of Firefox.
+func (e *experiment) scenarioList() ([]scenario, error) {
+	patterns, err := parseScenarios(strings.Join(e.Scenarios, ","))
+	if err != nil {
+		return nil, err
+	}
+	impairments, err := e.impairmentList()
+	if err != nil {
+		return nil, err
+	}
+	modes, err := e.resolverModeList()
+	if err != nil {
+		return nil, err
+	}
+	visitList, err := e.visitList()
+	if err != nil {
+		return nil, err
+	}
+
+	var scenarios []scenario
+	for _, impairment := range impairments {
+		for _, s := range patterns {
+			if impairment != noImpairment {
+				s.Impairment = impairment
+			}
+			resolvers := []resolverMode{""}
+			if s.DANE && len(modes) > 0 {
+				resolvers = modes
+			}
+			for _, mode := range resolvers {
+				s.Resolver = mode
+				for _, v := range visitList {
+					s.RepeatVisit = v == repeatVisit
+					scenarios = append(scenarios, s)
+				}
+			}
+		}
+	}
+	return scenarios, nil
+}
+
+// visitList returns the visits of Firefox to measure, which are known and not duplicated.
+func (e *experiment) visitList() ([]visit, error) {
+	if len(e.Firefox.Visits) == 0 {
+		return []visit{firstVisit}, nil
+	}
+	list := make([]visit, 0, len(e.Firefox.Visits))
+	for _, name := range e.Firefox.Visits {
+		v := visit(strings.TrimSpace(name))
+		if !slices.Contains(visits, v) {
+			return nil, fmt.Errorf("unknown visit %q: must be %s or %s", name, firstVisit, repeatVisit)
+		}
+		if slices.Contains(list, v) {
+			return nil, fmt.Errorf("visit %q is duplicated", name)
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// resolverModeList returns the resolvers of letsdane to measure, which are known and not duplicated.
+func (e *experiment) resolverModeList() ([]resolverMode, error) {
+	modes := make([]resolverMode, 0, len(e.Letsdane.ResolverModes))
+	for _, name := range e.Letsdane.ResolverModes {
+		mode := resolverMode(strings.TrimSpace(name))
+		if !slices.Contains(resolverModes, mode) {
+			return nil, fmt.Errorf("unknown resolver %q: must be %s or %s", name, resolverStub, resolverRecursive)
+		}
+		if slices.Contains(modes, mode) {
+			return nil, fmt.Errorf("resolver %q is duplicated", name)
+		}
+		modes = append(modes, mode)
+	}
+	return modes, nil
+}
+
+// impairmentList returns the names of the impairments to measure, which are defined and not duplicated.
+func (e *experiment) impairmentList() ([]string, error) {
+	if len(e.Impairments) == 0 {
+		return []string{noImpairment}, nil
+	}
+	seen := make(map[string]bool)
+	for _, name := range e.Impairments {
+		if _, ok := e.impairment(name); !ok && name != noImpairment {
+			return nil, fmt.Errorf("unknown impairment %q: must be %s, one of %s or defined in impairmentProfiles", name, noImpairment, strings.Join(builtinImpairmentNames(), ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("impairment %q is duplicated", name)
+		}
+		seen[name] = true
+	}
+	return e.Impairments, nil
+}
+
+// impairment returns the profile of the name. The profiles in the experiment take precedence over the built-in ones.
+func (e *experiment) impairment(name string) (impairmentProfile, bool) {
+	if profile, ok := e.ImpairmentProfiles[name]; ok {
+		return profile, true
+	}
+	profile, ok := builtinImpairments[name]
+	return profile, ok
+}
+
+// unboundConfig returns the configuration of unbound in the scenarios with or without cache.
+func (e *experiment) unboundConfig(cache bool) unboundConfig {
+	if cache {
+		return e.Unbound.WithCache
+	}
+	return e.Unbound.WithoutCache
+}
+
+// letsdaneArgs returns Args and FillCacheArgs of letsdane in the scenario, which follow the resolver of the scenario.
+// The scenarios without DNSSEC always use the stub resolver, because unbound does not validate.
+func (e *experiment) letsdaneArgs(s scenario) (args, fillCacheArgs []string) {
+	args, fillCacheArgs = e.Letsdane.Args, e.Letsdane.FillCacheArgs
+	switch {
+	case s.WithoutDNSSEC || s.Resolver == resolverStub:
+		return withSkipDNSSEC(args), withSkipDNSSEC(fillCacheArgs)
+	case s.Resolver == resolverRecursive:
+		return withoutSkipDNSSEC(args), withoutSkipDNSSEC(fillCacheArgs)
+	}
+	return args, fillCacheArgs
+}
+
+// resultSubDirectoryPath is the directory of the results of this run. e.g. ../../result/pageloadtime/tokyo-01
+func (e *experiment) resultSubDirectoryPath() string {
+	return filepath.Join(e.Output.Directory, e.Output.SubDirName)
+}
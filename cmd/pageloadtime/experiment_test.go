@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadExperiment(t *testing.T) {
+	dir := t.TempDir()
+	inputCSV := filepath.Join(dir, "domains.csv")
+	writeFile(t, inputCSV, "example.com\n")
+	start := time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	yamlPath := filepath.Join(dir, "experiment.yaml")
+	writeFile(t, yamlPath, `
+input:
+  csv: `+inputCSV+`
+scenarios: [without-cache-with-dane, with-cache-with-dane]
+trials: 3
+firefox:
+  timeoutSeconds: 60
+`)
+	jsonPath := filepath.Join(dir, "experiment.json")
+	writeFile(t, jsonPath, `{"input": {"csv": "`+inputCSV+`"}, "scenarios": ["without-cache-with-dane", "with-cache-with-dane"], "trials": 3, "firefox": {"timeoutSeconds": 60}}`)
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			exp, err := loadExperiment(path, start)
+			if err != nil {
+				t.Fatalf("loadExperiment() error = %v", err)
+			}
+			if err := exp.validate(); err != nil {
+				t.Fatalf("validate() error = %v", err)
+			}
+			scenarios, err := exp.scenarioList()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := scenarioNames(scenarios); !slices.Equal(names, []string{"without-cache-with-dane", "with-cache-with-dane"}) {
+				t.Errorf("scenarios = %q", names)
+			}
+			if exp.Trials != 3 || exp.Firefox.TimeoutSeconds != 60 {
+				t.Errorf("trials = %d, timeout = %d, want 3, 60", exp.Trials, exp.Firefox.TimeoutSeconds)
+			}
+			// the fields which are not in the file keep the defaults.
+			if exp.Concurrency != 1 || exp.Images.Letsdane != letsdaneImageName || exp.Output.SubDirName != "2024-04-01-09-00-00" {
+				t.Errorf("defaults are not kept: %+v", exp)
+			}
+		})
+	}
+}
+
+func TestLoadExperimentUnknownField(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"experiment.yaml": "trial: 3\n",
+		"experiment.json": `{"trial": 3}`,
+	} {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, content)
+		if _, err := loadExperiment(path, time.Now()); err == nil {
+			t.Errorf("loadExperiment(%s) error = nil, want unknown field error", name)
+		}
+	}
+
+	path := filepath.Join(dir, "experiment.toml")
+	writeFile(t, path, "trials = 3\n")
+	if _, err := loadExperiment(path, time.Now()); err == nil {
+		t.Error("loadExperiment() error = nil, want unsupported extension error")
+	}
+}
+
+func TestExperimentValidate(t *testing.T) {
+	exp := defaultExperiment(time.Now())
+	exp.Input.CSV = filepath.Join(t.TempDir(), "missing.csv")
+	exp.Input.First = 0
+	exp.Scenarios = []string{"with-cache"}
+	exp.Trials = 0
+	exp.Images.Firefox = ""
+	exp.Letsdane.Args = []string{"-r", "1.1.1.1"}
+	exp.Firefox.TimeoutSeconds = 0
+	exp.Output.SubDirName = "../other"
+
+	err := exp.validate()
+	if err == nil {
+		t.Fatal("validate() error = nil")
+	}
+	// every problem is reported at once.
+	for _, field := range []string{"input.csv", "input.first", "scenarios", "trials", "images.firefox", "letsdane.args", "firefox.timeoutSeconds", "output.subDirName"} {
+		if !strings.Contains(err.Error(), field+":") {
+			t.Errorf("validate() error does not report %s:\n%s", field, err)
+		}
+	}
+	for _, field := range []string{"concurrency", "images.letsdane", "letsdane.fillCacheArgs"} {
+		if strings.Contains(err.Error(), field+":") {
+			t.Errorf("validate() error reports valid field %s:\n%s", field, err)
+		}
+	}
+}
+
+func TestNewExperimentFlagsOverride(t *testing.T) {
+	dir := t.TempDir()
+	inputCSV := filepath.Join(dir, "domains.csv")
+	writeFile(t, inputCSV, "example.com\n")
+	path := filepath.Join(dir, "experiment.yaml")
+	writeFile(t, path, "input:\n  csv: "+inputCSV+"\nscenarios: [all]\ntrials: 3\nconcurrency: 10\n")
+
+	set := map[string]bool{"trials": true, "cache": true, "dane": true, "store": true}
+	flags := experimentFlags{cache: true, dane: true, trials: 5, concurrency: 1}
+	flags.store.URL = "s3://pageloadtime-results"
+	exp, err := newExperiment(path, time.Now(), set, flags)
+	if err != nil {
+		t.Fatalf("newExperiment() error = %v", err)
+	}
+	if !slices.Equal(exp.Scenarios, []string{"with-cache-with-dane"}) || exp.Trials != 5 || exp.Concurrency != 10 || exp.Output.Store.URL != "s3://pageloadtime-results" {
+		t.Errorf("newExperiment() = scenarios %q, trials %d, concurrency %d, store %s", exp.Scenarios, exp.Trials, exp.Concurrency, exp.Output.Store.URL)
+	}
+
+	set = map[string]bool{"scenarios": true, "cache": true}
+	if _, err := newExperiment(path, time.Now(), set, experimentFlags{cache: true, scenarios: "all"}); err == nil {
+		t.Error("newExperiment() error = nil, want conflict of -scenarios and -cache")
+	}
+}
+
+func TestExampleExperiments(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("experiments", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		exp, err := loadExperiment(path, time.Now())
+		if err != nil {
+			t.Errorf("loadExperiment(%s) error = %v", path, err)
+			continue
+		}
+		if err := exp.validate(); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
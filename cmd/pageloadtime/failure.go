@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/yagikota/danewebperf/cmd/pageloadtime/har"
+)
+
+// failureReason is the reason why a measurement did not get a valid page load time. It is empty if the measurement succeeded.
+type failureReason string
+
+const (
+	failureNone failureReason = ""
+
+	// failureContainer means a container or the network could not be created or started, e.g. unbound, letsdane or tcpdump.
+	failureContainer failureReason = "container-error"
+	// failureBrowserTimeout means the page load exceeded the page load timeout of Firefox.
+	failureBrowserTimeout failureReason = "browser-timeout"
+	// failureBrowserKilled means the Firefox container was killed, e.g. by the OOM killer (exit code 137).
+	failureBrowserKilled failureReason = "browser-killed"
+	// failureBrowserExit means pageload_measure.py exited with an error which is not classified.
+	failureBrowserExit failureReason = "browser-exit"
+	// failureHARNotExported means Firefox loaded the page but the HAR file was not exported in time.
+	failureHARNotExported failureReason = "har-not-exported"
+	// failureInvalidHAR means the output of Firefox is not a HAR file.
+	failureInvalidHAR failureReason = "invalid-har"
+
+	// failureDNSServfail means the resolver answered SERVFAIL, e.g. because of a bogus DNSSEC chain.
+	failureDNSServfail failureReason = "dns-servfail"
+	// failureDNSNotFound means the domain name could not be resolved.
+	failureDNSNotFound failureReason = "dns-not-found"
+	// failureDANEValidation means letsdane terminated the TLS handshake because the certificate did not match the TLSA records.
+	failureDANEValidation failureReason = "dane-validation-failed"
+	// failureTLS means the TLS handshake failed for a reason other than DANE.
+	failureTLS failureReason = "tls-error"
+	// failureConnection means the web server could not be reached.
+	failureConnection failureReason = "connection-error"
+	// failureProxyBadGateway means letsdane answered 502 Bad Gateway to the main document.
+	failureProxyBadGateway failureReason = "proxy-bad-gateway"
+	// failureHTTPError means the main document was answered with an HTTP error status.
+	failureHTTPError failureReason = "http-error"
+	// failureNoResponse means the main document got no response.
+	failureNoResponse failureReason = "no-response"
+	// failureNoPageLoad means the HAR file has no valid page load time for any other reason.
+	failureNoPageLoad failureReason = "no-page-load"
+
+	// failureProbeTimeout means the http probe did not finish loading the page in time.
+	failureProbeTimeout failureReason = "probe-timeout"
+	// failureProbeError means the request of the http probe failed with an error which is not classified.
+	failureProbeError failureReason = "probe-error"
+)
+
+// exit code of a container killed by SIGKILL
+const exitCodeKilled = 137
+
+// classifyFailure decides the failure reason of a measurement which did not get a valid page load time.
+// h is nil if the output of Firefox is not a HAR file.
+//
+// The more specific evidence is used first: the DANE validation result of letsdane for the website,
+// then the exit code and stderr of Firefox or the error of the http probe, and then the status of the main document in the HAR file.
+func classifyFailure(content HARFileContent, h *har.Har) failureReason {
+	var exitErr *ContainerExitError
+	var probeErr *httpProbeError
+	if content.Err != nil && !errors.As(content.Err, &exitErr) && !errors.As(content.Err, &probeErr) {
+		return failureContainer
+	}
+
+	host := websiteHost(content.Website)
+	if content.DANEValidationResultPath != "" {
+		if reason := letsdaneFailure(content.DANEValidationResultPath, host); reason != failureNone {
+			return reason
+		}
+	}
+
+	if exitErr != nil {
+		return browserExitFailure(exitErr)
+	}
+	if probeErr != nil {
+		return httpProbeFailure(probeErr)
+	}
+
+	if len(content.Content) == 0 {
+		return failureHARNotExported
+	}
+	if h == nil {
+		return failureInvalidHAR
+	}
+	return harEntryFailure(h)
+}
+
+func websiteHost(website string) string {
+	u, err := url.Parse(website)
+	if err != nil {
+		return website
+	}
+	return u.Hostname()
+}
+
+// letsdaneFailure classifies the error of letsdane for the host in the DANE validation result csv.
+// It returns failureNone if the host has no error or the file cannot be read.
+func letsdaneFailure(path, host string) failureReason {
+	file, err := os.Open(path)
+	if err != nil {
+		return failureNone
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		logger.Warn("Failed to read DANE validation result: " + err.Error())
+		return failureNone
+	}
+
+	// header: Host,DANE Validated,Error
+	for _, row := range rows {
+		if len(row) < 3 || row[0] != host || row[1] == "true" {
+			continue
+		}
+		if reason := letsdaneErrorReason(row[2]); reason != failureNone {
+			return reason
+		}
+	}
+	return failureNone
+}
+
+// letsdaneErrorReason classifies the error message written by letsdane.
+func letsdaneErrorReason(message string) failureReason {
+	switch {
+	case message == "", message == "tunnel established without DANE validation":
+		// the host has no TLSA record, which is not a failure.
+		return failureNone
+	case strings.Contains(message, "servfail"), strings.Contains(message, "bogus"), strings.Contains(message, "rcode"):
+		return failureDNSServfail
+	case strings.Contains(message, "no such host"):
+		return failureDNSNotFound
+	case strings.Contains(message, "dane authentication failed"):
+		return failureDANEValidation
+	case strings.HasPrefix(message, "tls:"):
+		return failureTLS
+	case strings.Contains(message, "could not reach"):
+		return failureConnection
+	}
+	return failureNone
+}
+
+// browserExitFailure classifies the failure of pageload_measure.py by the exit code and the exception in stderr.
+// Firefox shows an error page for network errors, and selenium reports it as about:neterror?e=[error].
+func browserExitFailure(exitErr *ContainerExitError) failureReason {
+	if exitErr.StatusCode == exitCodeKilled {
+		return failureBrowserKilled
+	}
+
+	stderr := exitErr.Stderr
+	switch {
+	case strings.Contains(stderr, "TimeoutException"):
+		return failureBrowserTimeout
+	case strings.Contains(stderr, "e=dnsNotFound"):
+		return failureDNSNotFound
+	case strings.Contains(stderr, "e=nssFailure"), strings.Contains(stderr, "e=nssBadCert"):
+		return failureTLS
+	case strings.Contains(stderr, "e=connectionFailure"), strings.Contains(stderr, "e=netReset"),
+		strings.Contains(stderr, "e=netTimeout"), strings.Contains(stderr, "e=proxyConnectFailure"):
+		return failureConnection
+	}
+	return failureBrowserExit
+}
+
+// harEntryFailure classifies the failure by the response status of the main document, which is the first entry of the HAR file.
+func harEntryFailure(h *har.Har) failureReason {
+	entries := h.Entries()
+	if len(entries) == 0 {
+		return failureNoResponse
+	}
+
+	status := entries[0].Response.Status
+	switch {
+	case status == 0:
+		return failureNoResponse
+	case status == 502:
+		return failureProxyBadGateway
+	case status >= 400:
+		return failureHTTPError
+	}
+	return failureNoPageLoad
+}
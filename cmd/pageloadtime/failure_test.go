@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yagikota/danewebperf/cmd/pageloadtime/har"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeLetsdaneCSV := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	servfail := writeLetsdaneCSV("servfail.csv", "Host,DANE Validated,Error\nexample.com,false,unbound: bogus: validation failure: dns lookup failed (rcode: servfail)\n")
+	daneFailed := writeLetsdaneCSV("dane.csv", "Host,DANE Validated,Error\ncdn.example.net,true,\nexample.com,false,tls: dane authentication failed\n")
+	noTLSA := writeLetsdaneCSV("notlsa.csv", "Host,DANE Validated,Error\nexample.com,false,tunnel established without DANE validation\n")
+	otherHost := writeLetsdaneCSV("other.csv", "Host,DANE Validated,Error\ncdn.example.net,false,tls: dane authentication failed\n")
+
+	harWithStatus := func(status int) *har.Har {
+		return &har.Har{Log: har.Log{Entries: []har.Entry{{Response: har.Response{Status: status}}}}}
+	}
+
+	tests := []struct {
+		name    string
+		content HARFileContent
+		har     *har.Har
+		want    failureReason
+	}{
+		{
+			name:    "container does not start",
+			content: HARFileContent{Err: errors.New("conflict")},
+			want:    failureContainer,
+		},
+		{
+			name:    "page load timeout",
+			content: HARFileContent{Err: &ContainerExitError{StatusCode: 1, Stderr: "selenium.common.exceptions.TimeoutException: Message: "}},
+			want:    failureBrowserTimeout,
+		},
+		{
+			name:    "firefox killed",
+			content: HARFileContent{Err: &ContainerExitError{StatusCode: 137}},
+			want:    failureBrowserKilled,
+		},
+		{
+			name:    "dns error page",
+			content: HARFileContent{Err: &ContainerExitError{StatusCode: 1, Stderr: "Reached error page: about:neterror?e=dnsNotFound&u=https%3A//example.com/"}},
+			want:    failureDNSNotFound,
+		},
+		{
+			name:    "unknown exception",
+			content: HARFileContent{Err: &ContainerExitError{StatusCode: 1, Stderr: "Traceback"}},
+			want:    failureBrowserExit,
+		},
+		{
+			name:    "letsdane servfail is preferred to the error page",
+			content: HARFileContent{Website: "https://example.com", DANEValidationResultPath: servfail, Err: &ContainerExitError{StatusCode: 1, Stderr: "about:neterror?e=proxyConnectFailure"}},
+			want:    failureDNSServfail,
+		},
+		{
+			name:    "dane handshake termination",
+			content: HARFileContent{Website: "https://example.com", DANEValidationResultPath: daneFailed, Err: &ContainerExitError{StatusCode: 1, Stderr: "about:neterror?e=nssFailure2"}},
+			want:    failureDANEValidation,
+		},
+		{
+			name:    "no TLSA record is not a failure of letsdane",
+			content: HARFileContent{Website: "https://example.com", DANEValidationResultPath: noTLSA, Err: &ContainerExitError{StatusCode: 1, Stderr: "about:neterror?e=nssFailure2"}},
+			want:    failureTLS,
+		},
+		{
+			name:    "failure of a subresource is ignored",
+			content: HARFileContent{Website: "https://example.com", DANEValidationResultPath: otherHost, Content: []byte("{}")},
+			har:     harWithStatus(200),
+			want:    failureNoPageLoad,
+		},
+		{
+			name:    "missing letsdane result",
+			content: HARFileContent{Website: "https://example.com", DANEValidationResultPath: filepath.Join(dir, "missing.csv")},
+			want:    failureHARNotExported,
+		},
+		{
+			name:    "invalid HAR",
+			content: HARFileContent{Content: []byte("Traceback")},
+			want:    failureInvalidHAR,
+		},
+		{
+			name:    "letsdane 502",
+			content: HARFileContent{Content: []byte("{}")},
+			har:     harWithStatus(502),
+			want:    failureProxyBadGateway,
+		},
+		{
+			name:    "http error",
+			content: HARFileContent{Content: []byte("{}")},
+			har:     harWithStatus(404),
+			want:    failureHTTPError,
+		},
+		{
+			name:    "no response",
+			content: HARFileContent{Content: []byte("{}")},
+			har:     &har.Har{},
+			want:    failureNoResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyFailure(tt.content, tt.har); got != tt.want {
+				t.Errorf("classifyFailure() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// measurementResourceName matches the names of the networks and containers created by measurementCommandOptions.
+//
+// e.g. network-example.com-with-cache-with-dane, unbound-example.com-with-cache-without-dane-without-dnssec, letsdane-example.com-without-cache-with-dane-rtt50-trial-2-fill-cache
+var measurementResourceName = regexp.MustCompile(`^(network|unbound|letsdane|firefox)-.+-(with|without)-cache-(with|without)-dane(-without-dnssec)?(-(stub|recursive)-resolver)?(-repeat-visit)?(-[a-z0-9]+)?(-trial-[0-9]+)?(-fill-cache)?$`)
+
+// gcCommand is `pageloadtime gc`, which removes the containers and networks left behind by a killed pageloadtime.
+// It must not be run while pageloadtime is running, because the resources of the running measurements are also removed.
+//
+// go run . gc -dry-run
+func gcCommand(args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	dockerHost := flags.String("docker-host", os.Getenv("DOCKER_HOST"), "docker daemon socket. if empty, "+defaultDockerHost+" is used")
+	dryRun := flags.Bool("dry-run", false, "only print the containers and networks to remove")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	rt, err := newDockerRuntime(*dockerHost)
+	if err != nil {
+		return err
+	}
+	removed, err := gc(context.Background(), rt, *dryRun)
+	logger.Info(fmt.Sprintf("gc: removed %d containers and networks", len(removed)))
+	return err
+}
+
+// gc removes the orphaned containers and then the orphaned networks, which cannot be removed while containers are attached.
+// It returns the removed resources, e.g. "container unbound-example.com-with-cache-with-dane".
+// It continues on errors and returns all of them at the end.
+func gc(ctx context.Context, rt ContainerRuntime, dryRun bool) ([]string, error) {
+	var removed []string
+	var errs []error
+
+	containers, err := rt.ListContainers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	for _, name := range containers {
+		if !measurementResourceName.MatchString(name) {
+			continue
+		}
+		logger.Info(fmt.Sprintf("remove container: %s", name))
+		if dryRun {
+			removed = append(removed, "container "+name)
+			continue
+		}
+		// the container may be running. stopping a stopped container is not an error, and unbound is removed by stopping it.
+		if err := rt.StopContainer(ctx, name); err != nil && !isNotFound(err) {
+			logger.Error(fmt.Sprintf("Failed to stop Docker container: %s", err))
+		}
+		if err := rt.RemoveContainer(ctx, name); err != nil && !isNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to remove container %s: %w", name, err))
+			continue
+		}
+		removed = append(removed, "container "+name)
+	}
+
+	networks, err := rt.ListNetworks(ctx)
+	if err != nil {
+		return removed, errors.Join(append(errs, fmt.Errorf("failed to list networks: %w", err))...)
+	}
+	for _, name := range networks {
+		if !measurementResourceName.MatchString(name) {
+			continue
+		}
+		logger.Info(fmt.Sprintf("remove network: %s", name))
+		if dryRun {
+			removed = append(removed, "network "+name)
+			continue
+		}
+		if err := rt.RemoveNetwork(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove network %s: %w", name, err))
+			continue
+		}
+		removed = append(removed, "network "+name)
+	}
+	return removed, errors.Join(errs...)
+}
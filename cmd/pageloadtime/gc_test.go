@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestGC(t *testing.T) {
+	newRuntime := func() *fakeRuntime {
+		rt := newFakeRuntime()
+		ctx := context.Background()
+		// the resources left behind by a killed pageloadtime and the ones of other users.
+		for _, network := range []string{"network-example.com-with-cache-with-dane-trial-2", "bridge", "network-example"} {
+			rt.CreateNetwork(ctx, network)
+		}
+		rt.StartContainer(ctx, ContainerSpec{Name: "unbound-example.com-with-cache-with-dane-trial-2", Network: "network-example.com-with-cache-with-dane-trial-2", AutoRemove: true})
+		rt.StartContainer(ctx, ContainerSpec{Name: "letsdane-example.com-with-cache-with-dane-without-dnssec-rtt50-trial-2-fill-cache", Network: "network-example.com-with-cache-with-dane-trial-2"})
+		rt.StartContainer(ctx, ContainerSpec{Name: "firefox-example.com-with-cache-with-dane-trial-2", Network: "network-example.com-with-cache-with-dane-trial-2"})
+		rt.StopContainer(ctx, "firefox-example.com-with-cache-with-dane-trial-2")
+		rt.StartContainer(ctx, ContainerSpec{Name: "firefox-dev", Network: "bridge"})
+		return rt
+	}
+	want := []string{
+		"container firefox-example.com-with-cache-with-dane-trial-2",
+		"container letsdane-example.com-with-cache-with-dane-without-dnssec-rtt50-trial-2-fill-cache",
+		"container unbound-example.com-with-cache-with-dane-trial-2",
+		"network network-example.com-with-cache-with-dane-trial-2",
+	}
+
+	rt := newRuntime()
+	removed, err := gc(context.Background(), rt, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(removed, want) {
+		t.Errorf("gc(dry run) = %q, want %q", removed, want)
+	}
+	if leftovers := rt.Leftovers(); len(leftovers) != 7 {
+		t.Errorf("gc(dry run) removed resources: leftovers = %q", leftovers)
+	}
+
+	rt = newRuntime()
+	removed, err = gc(context.Background(), rt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(removed, want) {
+		t.Errorf("gc() = %q, want %q", removed, want)
+	}
+	if leftovers, want := rt.Leftovers(), []string{"container firefox-dev", "network bridge", "network network-example"}; !slices.Equal(leftovers, want) {
+		t.Errorf("leftovers = %q, want %q", leftovers, want)
+	}
+}
@@ -380,6 +380,9 @@ type Timings struct {
 	Receive int `json:"receive"`
 	// ssl [number, optional] (new in 1.2) - Time required for SSL/TLS negotiation. If this field is defined then the time is also included in the connect field (to ensure backward compatibility with HAR 1.1). Use -1 if the timing does not apply to the current request.
 	Ssl int `json:"ssl"`
+	// _proxyConnect [number, custom] - Time of the CONNECT request to the proxy, which is also included in the connect field.
+	// It is written only by the http probe of pageloadtime.
+	ProxyConnect int `json:"_proxyConnect,omitempty"`
 	// comment [string, optional] (new in 1.2) - A comment provided by the user or the application.
 	Comment string `json:"comment"`
 }
@@ -413,58 +416,68 @@ type Transaction struct {
 	Sending         string
 	Waiting         string
 	Receiving       string
+	ProxyConnect    string
 }
 
 func (h *Har) ConvertCSVFormat() CSVFormat {
 	var records []Record
 	for _, entry := range h.Log.Entries {
-		u, err := url.Parse(entry.Request.URL)
+		record, err := h.ConvertEntry(entry)
 		if err != nil {
 			log.Println(err)
 			continue
 		}
-		domain := u.Hostname()
-
-		pathSegments := strings.Split(u.Path, "/")
-		file := pathSegments[len(pathSegments)-1]
-		if file == "" {
-			file = "/"
-		}
-
-		queued := int(entry.StartedDateTime.Sub(h.StartedDateTimeOfFirstPage()).Milliseconds())
-
-		started := queued + entry.Timings.Blocked
-
-		downloaded := queued + entry.Time
-
-		record := Record{
-			Status:                  strconv.Itoa(entry.Response.Status),
-			Method:                  entry.Request.Method,
-			Domain:                  domain,
-			File:                    file,
-			MIMEType:                entry.Response.Content.MimeType,
-			CompressedSize:          strconv.Itoa(entry.Response.BodySize),
-			UnCompressedSize:        strconv.Itoa(entry.Response.Content.Size),
-			PageLoadStartedDateTime: h.StartedDateTimeOfFirstPage().Format("2006-01-02 15:04:05.000"),
-			Transaction: Transaction{
-				StartedDateTime: entry.StartedDateTime.Format("2006-01-02 15:04:05.000"),
-				Queued:          strconv.Itoa(queued),
-				Started:         strconv.Itoa(started),
-				Downloaded:      strconv.Itoa(downloaded),
-				Blocked:         strconv.Itoa(entry.Timings.Blocked),
-				DNSResolution:   strconv.Itoa(entry.Timings.DNS),
-				Connecting:      strconv.Itoa(entry.Timings.Connect),
-				TLSSetup:        strconv.Itoa(entry.Timings.Ssl),
-				Sending:         strconv.Itoa(entry.Timings.Send),
-				Waiting:         strconv.Itoa(entry.Timings.Wait),
-				Receiving:       strconv.Itoa(entry.Timings.Receive),
-			},
-		}
 		records = append(records, record)
 	}
 	return CSVFormat{Records: records}
 }
 
+// ConvertEntry converts the entry to a record of the csv. The times of the record are relative to the first page.
+func (h *Har) ConvertEntry(entry Entry) (Record, error) {
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return Record{}, err
+	}
+	domain := u.Hostname()
+
+	pathSegments := strings.Split(u.Path, "/")
+	file := pathSegments[len(pathSegments)-1]
+	if file == "" {
+		file = "/"
+	}
+
+	queued := int(entry.StartedDateTime.Sub(h.StartedDateTimeOfFirstPage()).Milliseconds())
+
+	started := queued + entry.Timings.Blocked
+
+	downloaded := queued + entry.Time
+
+	return Record{
+		Status:                  strconv.Itoa(entry.Response.Status),
+		Method:                  entry.Request.Method,
+		Domain:                  domain,
+		File:                    file,
+		MIMEType:                entry.Response.Content.MimeType,
+		CompressedSize:          strconv.Itoa(entry.Response.BodySize),
+		UnCompressedSize:        strconv.Itoa(entry.Response.Content.Size),
+		PageLoadStartedDateTime: h.StartedDateTimeOfFirstPage().Format("2006-01-02 15:04:05.000"),
+		Transaction: Transaction{
+			StartedDateTime: entry.StartedDateTime.Format("2006-01-02 15:04:05.000"),
+			Queued:          strconv.Itoa(queued),
+			Started:         strconv.Itoa(started),
+			Downloaded:      strconv.Itoa(downloaded),
+			Blocked:         strconv.Itoa(entry.Timings.Blocked),
+			DNSResolution:   strconv.Itoa(entry.Timings.DNS),
+			Connecting:      strconv.Itoa(entry.Timings.Connect),
+			TLSSetup:        strconv.Itoa(entry.Timings.Ssl),
+			Sending:         strconv.Itoa(entry.Timings.Send),
+			Waiting:         strconv.Itoa(entry.Timings.Wait),
+			Receiving:       strconv.Itoa(entry.Timings.Receive),
+			ProxyConnect:    strconv.Itoa(entry.Timings.ProxyConnect),
+		},
+	}, nil
+}
+
 func (har CSVFormat) SaveAsCSV(filePath string) error {
 	file, err := os.Create(filePath)
 	if err != nil {
@@ -495,6 +508,7 @@ func (har CSVFormat) SaveAsCSV(filePath string) error {
 		"Sending(ms)",
 		"Waiting(ms)",
 		"Receiving(ms)",
+		"ProxyConnect(ms)",
 	}); err != nil {
 		return err
 	}
@@ -520,6 +534,7 @@ func (har CSVFormat) SaveAsCSV(filePath string) error {
 			record.Transaction.Sending,
 			record.Transaction.Waiting,
 			record.Transaction.Receiving,
+			record.Transaction.ProxyConnect,
 		}
 		if err := writer.Write(record); err != nil {
 			return err
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// noImpairment is the name of the network without impairment. Its measurements have no impairment suffix.
+const noImpairment = "none"
+
+// impairmentProfile is a network impairment applied with tc netem in the unbound, letsdane and firefox-har containers.
+// Only the packets sent to outside of the Docker network are impaired, e.g. DNS queries from unbound to authoritative servers
+// and HTTPS requests to the websites, so the impairment is applied once per round trip.
+//
+// e.g. 50ms RTT and 1% loss
+//
+//	delay: 50ms
+//	loss: 1
+type impairmentProfile struct {
+	// Delay is added to the round trip time to outside of the Docker network, e.g. 50ms.
+	Delay string `json:"delay,omitempty" yaml:"delay"`
+	// Jitter is the variation of Delay, e.g. 5ms.
+	Jitter string `json:"jitter,omitempty" yaml:"jitter"`
+	// Loss is the percentage of packets dropped, e.g. 1 for 1%.
+	Loss float64 `json:"loss,omitempty" yaml:"loss"`
+	// Rate limits the bandwidth of the packets sent by the containers, e.g. 10mbit.
+	// It does not limit the responses, which would need an ifb device on the host.
+	Rate string `json:"rate,omitempty" yaml:"rate"`
+}
+
+// builtinImpairments are the profiles which can be used without defining them in the experiment file.
+var builtinImpairments = map[string]impairmentProfile{
+	"rtt25":      {Delay: "25ms"},
+	"rtt50":      {Delay: "50ms"},
+	"rtt100":     {Delay: "100ms"},
+	"rtt200":     {Delay: "200ms"},
+	"loss1":      {Loss: 1},
+	"rtt50loss1": {Delay: "50ms", Loss: 1},
+}
+
+// impairmentName is a part of the measurement ID and the container names, so that it must not contain "-".
+var impairmentName = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// tc accepts rates like 10mbit, 1gbit or 500kbps.
+var netemRate = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?([kmgt]?bit|[kmgt]?bps)$`)
+
+func (p impairmentProfile) validate() error {
+	var errs []string
+	if p.Delay != "" {
+		if d, err := time.ParseDuration(p.Delay); err != nil || d < 0 {
+			errs = append(errs, fmt.Sprintf("delay must be a duration like 50ms, got %q", p.Delay))
+		}
+	}
+	if p.Jitter != "" {
+		if d, err := time.ParseDuration(p.Jitter); err != nil || d < 0 {
+			errs = append(errs, fmt.Sprintf("jitter must be a duration like 5ms, got %q", p.Jitter))
+		} else if p.Delay == "" {
+			errs = append(errs, "jitter needs delay")
+		}
+	}
+	if p.Loss < 0 || p.Loss > 100 {
+		errs = append(errs, fmt.Sprintf("loss must be from 0 to 100, got %g", p.Loss))
+	}
+	if p.Rate != "" && !netemRate.MatchString(p.Rate) {
+		errs = append(errs, fmt.Sprintf("rate must be like 10mbit, got %q", p.Rate))
+	}
+	if p == (impairmentProfile{}) {
+		errs = append(errs, "at least one of delay, loss and rate must be set")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// netem returns the parameters of tc netem, e.g. "delay 50ms 5ms loss 1%". The profile must be valid.
+func (p impairmentProfile) netem() string {
+	var params []string
+	if p.Delay != "" {
+		params = append(params, "delay", netemTime(p.Delay))
+		if p.Jitter != "" {
+			params = append(params, netemTime(p.Jitter))
+		}
+	}
+	if p.Loss > 0 {
+		params = append(params, "loss", strconv.FormatFloat(p.Loss, 'f', -1, 64)+"%")
+	}
+	if p.Rate != "" {
+		params = append(params, "rate", p.Rate)
+	}
+	return strings.Join(params, " ")
+}
+
+// netemTime converts a duration of Go into the time of tc, which does not accept units like 1m30s.
+func netemTime(s string) string {
+	d, _ := time.ParseDuration(s)
+	return strconv.FormatInt(d.Microseconds(), 10) + "us"
+}
+
+func builtinImpairmentNames() []string {
+	names := make([]string, 0, len(builtinImpairments))
+	for name := range builtinImpairments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+func TestImpairmentProfileNetem(t *testing.T) {
+	tests := []struct {
+		profile impairmentProfile
+		want    string
+	}{
+		{impairmentProfile{Delay: "50ms"}, "delay 50000us"},
+		{impairmentProfile{Delay: "100ms", Jitter: "1.5ms", Loss: 0.5}, "delay 100000us 1500us loss 0.5%"},
+		{impairmentProfile{Loss: 1, Rate: "10mbit"}, "loss 1% rate 10mbit"},
+	}
+	for _, tt := range tests {
+		if err := tt.profile.validate(); err != nil {
+			t.Errorf("validate(%+v) error = %v", tt.profile, err)
+		}
+		if got := tt.profile.netem(); got != tt.want {
+			t.Errorf("netem(%+v) = %q, want %q", tt.profile, got, tt.want)
+		}
+	}
+	for name, profile := range builtinImpairments {
+		if err := profile.validate(); err != nil || !impairmentName.MatchString(name) {
+			t.Errorf("builtin %s is invalid: %v", name, err)
+		}
+	}
+}
+
+func TestImpairmentProfileValidate(t *testing.T) {
+	for _, profile := range []impairmentProfile{
+		{},
+		{Delay: "50"},
+		{Delay: "-1ms"},
+		{Jitter: "5ms"},
+		{Loss: 101},
+		{Rate: "10 mbit"},
+	} {
+		if err := profile.validate(); err == nil {
+			t.Errorf("validate(%+v) error = nil", profile)
+		}
+	}
+}
+
+func TestExperimentImpairments(t *testing.T) {
+	exp := defaultExperiment(time.Now())
+	exp.Scenarios = []string{"without-cache-without-dane", "with-cache-with-dane"}
+	exp.Impairments = []string{"none", "rtt50", "slow"}
+	exp.ImpairmentProfiles = map[string]impairmentProfile{"slow": {Rate: "1mbit"}}
+
+	scenarios, err := exp.scenarioList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"without-cache-without-dane",
+		"with-cache-with-dane",
+		"without-cache-without-dane-rtt50",
+		"with-cache-with-dane-rtt50",
+		"without-cache-without-dane-slow",
+		"with-cache-with-dane-slow",
+	}
+	if got := scenarioNames(scenarios); !slices.Equal(got, want) {
+		t.Errorf("scenarioList() = %q, want %q", got, want)
+	}
+
+	exp.Impairments = []string{"rtt50", "rtt50", "unknown"}
+	exp.ImpairmentProfiles = map[string]impairmentProfile{"none": {Delay: "1ms"}, "bad-name": {Loss: 200}}
+	err = exp.validate()
+	if err == nil {
+		t.Fatal("validate() error = nil")
+	}
+	for _, field := range []string{"impairments", "impairmentProfiles.none", "impairmentProfiles.bad-name"} {
+		if !strings.Contains(err.Error(), field+":") {
+			t.Errorf("validate() error does not report %s:\n%s", field, err)
+		}
+	}
+}
+
+func TestCollectHARImpairment(t *testing.T) {
+	exp := defaultExperiment(time.Now())
+	rt := newFakeRuntime()
+	var firefox ContainerSpec
+	rt.onRun = func(spec ContainerSpec) {
+		firefox = spec
+	}
+
+	record := utils.Record{Domain: "example.com"}
+	s := scenario{Cache: false, DANE: false, Impairment: "loss1"}
+	opts := measurementCommandOptions(exp, record, s, trialMeasurementID(record, s, 1, 1), t.TempDir())
+	if _, err := collectHAR(context.Background(), rt, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(firefox.Env, []string{"NETEM=loss 1%"}) || !slices.Equal(firefox.CapAdd, []string{"NET_ADMIN"}) {
+		t.Errorf("firefox env = %q, cap add = %q", firefox.Env, firefox.CapAdd)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+// journalFileName is the file in the result sub directory which records the outcome of each measurement as it happens.
+// Each line is a JSON object, so that a run killed while writing loses at most the last line.
+const journalFileName = "journal.jsonl"
+
+type journalEntry struct {
+	Domain   string `json:"domain"`
+	Scenario string `json:"scenario"`
+	Cache    bool   `json:"cache"`
+	Dane     bool   `json:"dane"`
+	// WithoutDNSSEC is true if DNSSEC validation was disabled in unbound.
+	WithoutDNSSEC bool `json:"withoutDNSSEC,omitempty"`
+	// Resolver is the resolver of letsdane, stub or recursive. It is empty if letsdane.args decided it.
+	Resolver string `json:"resolver,omitempty"`
+	// RepeatVisit is true if the second load of the page in the same Firefox profile was measured.
+	RepeatVisit bool `json:"repeatVisit,omitempty"`
+	// Impairment is the name of the network impairment profile. It is empty without impairment.
+	Impairment string `json:"impairment,omitempty"`
+	Trial      int    `json:"trial"`
+	// PageLoadTime is empty if the measurement failed.
+	PageLoadTime  string `json:"pageLoadTime"`
+	FailureReason string `json:"failureReason,omitempty"`
+	// HostSaturated is true if the CPU of the host was saturated while loading the page.
+	HostSaturated bool `json:"hostSaturated,omitempty"`
+	// Attempt is the attempt of a measurement retried by -retry-from, starting from 2. It is empty for the first attempt.
+	Attempt    int       `json:"attempt,omitempty"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// journalKey identifies a measurement of a page in a run. Domain is the slug of the page, which is the domain for a domain list with only domains.
+type journalKey struct {
+	Domain   string
+	Scenario string
+	Trial    int
+}
+
+func (e journalEntry) key() journalKey {
+	return journalKey{Domain: e.Domain, Scenario: e.Scenario, Trial: e.Trial}
+}
+
+type journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openJournal opens the journal file to append entries. The existing entries are kept.
+// If the last line is broken because the process was killed while writing it, the line is terminated,
+// so that it does not corrupt the next entry.
+func openJournal(path string) (*journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if last[0] != '\n' {
+			if _, err := file.Write([]byte{'\n'}); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+	}
+	return &journal{file: file}, nil
+}
+
+// append writes the entry and flushes it to the disk.
+func (j *journal) append(entry journalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *journal) Close() error {
+	return j.file.Close()
+}
+
+// readJournal reads all entries of the journal file.
+// Broken lines, e.g. the last line written when the process was killed, are skipped.
+func readJournal(path string) ([]journalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.Warn(fmt.Sprintf("skip broken line %d of journal %s: %s", lineNumber, path, err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// finishedMeasurements returns the measurements recorded in the journal regardless of their outcome.
+func finishedMeasurements(entries []journalEntry) map[journalKey]bool {
+	finished := make(map[journalKey]bool)
+	for _, entry := range entries {
+		finished[entry.key()] = true
+	}
+	return finished
+}
+
+// journalPageLoadTimeRecords rebuilds the page load time of the domains, scenarios and trials of this run from the journal.
+// If a measurement is recorded more than once, the last entry is used.
+// The domain of an entry is the slug of the page, and its URL and tags are taken from the domain list.
+func journalPageLoadTimeRecords(entries []journalEntry, domainList utils.DomainList, scenarios []scenario, trials int) []utils.PageLoadTimeRecord {
+	domains := make(map[string]utils.Record)
+	for _, record := range domainList {
+		domains[record.Slug()] = record
+	}
+	scenarioNames := make(map[string]bool)
+	for _, s := range scenarios {
+		scenarioNames[s.String()] = true
+	}
+
+	latest := make(map[journalKey]journalEntry)
+	var keys []journalKey
+	for _, entry := range entries {
+		if _, ok := domains[entry.Domain]; !ok || !scenarioNames[entry.Scenario] || entry.Trial < 1 || entry.Trial > trials {
+			continue
+		}
+		if _, ok := latest[entry.key()]; !ok {
+			keys = append(keys, entry.key())
+		}
+		latest[entry.key()] = entry
+	}
+
+	records := make([]utils.PageLoadTimeRecord, 0, len(keys))
+	for _, key := range keys {
+		entry := latest[key]
+		record := domains[entry.Domain]
+		records = append(records, utils.PageLoadTimeRecord{
+			Domain:        entry.Domain,
+			URL:           record.TargetURL(),
+			Tags:          strings.Join(record.Tags, ";"),
+			PageLoadTime:  entry.PageLoadTime,
+			Cache:         entry.Cache,
+			Dane:          entry.Dane,
+			WithoutDNSSEC: entry.WithoutDNSSEC,
+			Resolver:      entry.Resolver,
+			RepeatVisit:   entry.RepeatVisit,
+			Impairment:    entry.Impairment,
+			Trial:         entry.Trial,
+			FailureReason: entry.FailureReason,
+			HostSaturated: entry.HostSaturated,
+			Attempt:       entry.Attempt,
+		})
+	}
+	return records
+}
+
+// pendingMeasurements returns the number of measurements of the page which are not finished yet.
+func pendingMeasurements(record utils.Record, scenarios []scenario, trials int, finished map[journalKey]bool) int {
+	pending := 0
+	for trial := 1; trial <= trials; trial++ {
+		for _, s := range scenarios {
+			if !finished[journalKey{Domain: record.Slug(), Scenario: s.String(), Trial: trial}] {
+				pending++
+			}
+		}
+	}
+	return pending
+}
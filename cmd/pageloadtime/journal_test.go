@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), journalFileName)
+	withCacheWithDane := scenario{Cache: true, DANE: true}
+
+	j, err := openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []journalEntry{
+		{Domain: "a.example", Scenario: withCacheWithDane.String(), Cache: true, Dane: true, Trial: 1, PageLoadTime: "100", FinishedAt: time.Now()},
+		{Domain: "b.example", Scenario: withCacheWithDane.String(), Cache: true, Dane: true, Trial: 1, PageLoadTime: "", FinishedAt: time.Now()},
+	}
+	for _, entry := range entries {
+		if err := j.append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the process is killed while writing the next entry.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"domain":"c.example","scen`)
+	file.Close()
+
+	// resuming appends to the existing journal.
+	j, err = openJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.append(journalEntry{Domain: "c.example", Scenario: withCacheWithDane.String(), Cache: true, Dane: true, Trial: 1, PageLoadTime: "300"}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	got, err := readJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("len(entries) = %d, want 3", len(got))
+	}
+	if got[2].Domain != "c.example" || got[2].PageLoadTime != "300" {
+		t.Errorf("entry after the broken line = %+v", got[2])
+	}
+
+	finished := finishedMeasurements(got)
+	if !finished[journalKey{Domain: "b.example", Scenario: withCacheWithDane.String(), Trial: 1}] {
+		t.Error("failed measurement should be finished")
+	}
+	if pending := pendingMeasurements(utils.Record{Domain: "a.example"}, allScenarios, 1, finished); pending != 3 {
+		t.Errorf("pending measurements = %d, want 3", pending)
+	}
+	if pending := pendingMeasurements(utils.Record{Domain: "a.example"}, []scenario{withCacheWithDane}, 1, finished); pending != 0 {
+		t.Errorf("pending measurements = %d, want 0", pending)
+	}
+}
+
+func TestJournalPageLoadTimeRecords(t *testing.T) {
+	withCacheWithDane := scenario{Cache: true, DANE: true}
+	withoutCacheWithoutDane := scenario{Cache: false, DANE: false}
+	entries := []journalEntry{
+		{Domain: "a.example", Scenario: withCacheWithDane.String(), Cache: true, Dane: true, Trial: 1, PageLoadTime: ""},
+		{Domain: "a.example", Scenario: withoutCacheWithoutDane.String(), Cache: false, Dane: false, Trial: 1, PageLoadTime: "200"},
+		// measured again without -resume
+		{Domain: "a.example", Scenario: withCacheWithDane.String(), Cache: true, Dane: true, Trial: 1, PageLoadTime: "100"},
+		// out of this run
+		{Domain: "z.example", Scenario: withCacheWithDane.String(), Cache: true, Dane: true, Trial: 1, PageLoadTime: "100"},
+		{Domain: "a.example", Scenario: withCacheWithDane.String(), Cache: true, Dane: true, Trial: 2, PageLoadTime: "100"},
+	}
+
+	got := journalPageLoadTimeRecords(entries, utils.DomainList{{Domain: "a.example"}}, []scenario{withCacheWithDane}, 1)
+	want := []utils.PageLoadTimeRecord{
+		{Domain: "a.example", URL: "https://a.example", PageLoadTime: "100", Cache: true, Dane: true, Trial: 1},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("journalPageLoadTimeRecords() = %+v, want %+v", got, want)
+	}
+}
@@ -1,21 +1,27 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/yagikota/danewebperf/cmd/pageloadtime/har"
+	"github.com/yagikota/danewebperf/storage"
 	"github.com/yagikota/danewebperf/utils"
 )
 
@@ -28,12 +34,13 @@ const (
 	resultDirectoryPath = "./../../result/pageloadtime"
 	// input csv
 	defaultInputCSV = "./../../dataset/test/test-data.csv"
+	// the certificate of letsdane, which the http probe trusts
+	defaultLetsdaneCACert = "./../../docker/firefox/letsdane/ca/cert.crt"
 
 	// these docker image should be built before running this program.
-	unboundWithCacheImageName    = "unbound:with-cache"
-	unboundWithoutCacheImageName = "unbound:without-cache"
-	letsdaneImageName            = "letsdane:latest"
-	firefoxHARImageName          = "firefox:latest"
+	unboundImageName    = "unbound:latest"
+	letsdaneImageName   = "letsdane:latest"
+	firefoxHARImageName = "firefox:latest"
 
 	// pcap file path in the docker container
 	firefoxPcapFilePath  = "/captured/firefox.pcap"
@@ -48,12 +55,29 @@ const (
 	withCacheWithoutDane    measurementPattern = "with-cache-without-dane"    // Cache enabled, no DANE
 	withoutCacheWithDane    measurementPattern = "without-cache-with-dane"    // No cache, DANE enabled
 	withCacheWithDane       measurementPattern = "with-cache-with-dane"       // Cache and DANE enabled
+
+	// Measurement patterns with DNSSEC validation disabled in unbound
+	withoutCacheWithoutDaneWithoutDNSSEC measurementPattern = "without-cache-without-dane-without-dnssec" // No cache, no DANE, no validation
+	withCacheWithoutDaneWithoutDNSSEC    measurementPattern = "with-cache-without-dane-without-dnssec"    // Cache enabled, no DANE, no validation
+	withoutCacheWithDaneWithoutDNSSEC    measurementPattern = "without-cache-with-dane-without-dnssec"    // No cache, DANE enabled, no validation
+	withCacheWithDaneWithoutDNSSEC       measurementPattern = "with-cache-with-dane-without-dnssec"       // Cache and DANE enabled, no validation
 )
 
 type dockerRunOptions struct {
 	ImageName     string
 	NetWork       string
 	ContainerName string
+	// Netem is the parameters of tc netem applied in the container, e.g. "delay 50000us loss 1%". If empty, the network is not impaired.
+	Netem string
+}
+
+// applyNetem makes the entrypoint of the container impair the network with tc netem, which needs NET_ADMIN.
+func (o *dockerRunOptions) applyNetem(spec *ContainerSpec) {
+	if o.Netem == "" {
+		return
+	}
+	spec.Env = append(spec.Env, "NETEM="+o.Netem)
+	spec.CapAdd = append(spec.CapAdd, "NET_ADMIN")
 }
 
 func newDockerRunOptions(imageName, network, containerName string) *dockerRunOptions {
@@ -70,26 +94,58 @@ type fireFoxHAROptions struct {
 	ProxyHost     string
 	DANE          bool
 	FillCacheOnly bool
+	// Timeout is the page load timeout of Firefox in seconds. If 0, the default of pageload_measure.py is used.
+	Timeout int
+	// RepeatVisit loads the page twice in the same profile and returns the HAR file of the second load.
+	RepeatVisit bool
 }
 
-func newFireFoxHAROptions(website, resolverIP, proxyHost string, dane bool) *fireFoxHAROptions {
+func newFireFoxHAROptions(website, resolverIP, proxyHost string, dane bool, timeout int) *fireFoxHAROptions {
 	return &fireFoxHAROptions{
 		Website:       website,
 		ResolverIP:    resolverIP,
 		ProxyHost:     proxyHost,
 		DANE:          dane,
 		FillCacheOnly: false,
+		Timeout:       timeout,
 	}
 }
 
 type LetsdaneOptions struct {
-	ResolverIP string
+	ResolverIP    string
+	Args          []string
+	FillCacheArgs []string
 }
 
-func newLetsdaneOptions(resolverIP string) *LetsdaneOptions {
+func newLetsdaneOptions(resolverIP string, args, fillCacheArgs []string) *LetsdaneOptions {
 	return &LetsdaneOptions{
-		ResolverIP: resolverIP,
+		ResolverIP:    resolverIP,
+		Args:          args,
+		FillCacheArgs: fillCacheArgs,
+	}
+}
+
+// withSkipDNSSEC returns args of letsdane with -skip-dnssec, which makes letsdane trust the AD bit of the resolver
+// instead of validating the answers with libunbound.
+func withSkipDNSSEC(args []string) []string {
+	if slices.Contains(args, "-skip-dnssec") {
+		return args
+	}
+	return append(slices.Clone(args), "-skip-dnssec")
+}
+
+// withoutSkipDNSSEC returns args of letsdane without -skip-dnssec, which makes letsdane validate the answers
+// with libunbound forwarding to the resolver.
+func withoutSkipDNSSEC(args []string) []string {
+	return slices.DeleteFunc(slices.Clone(args), func(arg string) bool { return arg == "-skip-dnssec" })
+}
+
+// letsdaneResolver returns the resolver which letsdane uses with args.
+func letsdaneResolver(args []string) resolverMode {
+	if slices.Contains(args, "-skip-dnssec") {
+		return resolverStub
 	}
+	return resolverRecursive
 }
 
 type PcapOptions struct {
@@ -125,6 +181,12 @@ type commandOptions struct {
 	PcapOpts                 *PcapOptions
 	DANEValidationResultOpts *DANEValidationResultOpts
 	Cache                    bool
+	// UnboundConfig is rendered into unbound.conf of the unbound container.
+	UnboundConfig unboundConfig
+	// HTTPProbeOpts is nil if the page is loaded with Firefox.
+	HTTPProbeOpts *httpProbeOptions
+	// ResourceOpts is nil if the resource usage is not sampled.
+	ResourceOpts *resourceOptions
 }
 
 func newCommandOptions(letsdaneDockerRunOpts *dockerRunOptions, letsdaneOpts *LetsdaneOptions, HARDockerRunOpts *dockerRunOptions, HAROpts *fireFoxHAROptions, unboundDockerOpts *dockerRunOptions, pcapOpts *PcapOptions, DANEValidationResultOpts *DANEValidationResultOpts, cache bool) *commandOptions {
@@ -143,291 +205,206 @@ func newCommandOptions(letsdaneDockerRunOpts *dockerRunOptions, letsdaneOpts *Le
 // createNetwork creates docker network for measurement.
 //
 // original command: docker network create [network name]
-func createDockerNetwork(network string) error {
+func createDockerNetwork(ctx context.Context, rt ContainerRuntime, network string) error {
 	if network == "" {
 		logger.Warn("network name is empty")
 		return nil
 	}
 
-	cmd := exec.Command("docker", "network", "create", network)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
-
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
-		return err
-	}
-
-	logger.Info(fmt.Sprintf("Stdout: %s", stdout.String()))
-	return nil
+	logger.Info(fmt.Sprintf("create network: %s", network))
+	return rt.CreateNetwork(ctx, network)
 }
 
 // removeDockerNetwork removes docker network after finishing measurement.
 //
 // original command: docker network rm [network name]
-func removeDockerNetwork(network string) error {
-	cmd := exec.Command("docker", "network", "rm", network)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
-
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
-		return err
-	}
-
-	logger.Info(fmt.Sprintf("Stdout: %s", stdout.String()))
-	return nil
+func removeDockerNetwork(ctx context.Context, rt ContainerRuntime, network string) error {
+	return rt.RemoveNetwork(ctx, network)
 }
 
 // getContainerIP get container ip address from container name
 //
 // original command: docker inspect -f '{{range.NetworkSettings.Networks}}{{.IPAddress}}{{end}}' [container name]
-func getContainerIP(containerName string) (string, error) {
-	cmd := exec.Command("docker", "inspect", "-f", "{{range.NetworkSettings.Networks}}{{.IPAddress}}{{end}}", containerName)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
-
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+func getContainerIP(ctx context.Context, rt ContainerRuntime, containerName string) (string, error) {
+	ip, err := rt.ContainerIP(ctx, containerName)
 	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
 		return "", err
 	}
 
-	logger.Info(fmt.Sprintf("Stdout: %s", stdout.String()))
-	return strings.TrimSpace(stdout.String()), nil
+	logger.Info(fmt.Sprintf("container ip: %s %s", containerName, ip))
+	return ip, nil
 }
 
-func runUnboundContainer(opts *commandOptions) error {
-	dockerCmd := []string{"docker", "run", "--rm", "--network", opts.UnboundDockerRunOpts.NetWork, "--name", opts.UnboundDockerRunOpts.ContainerName, "-d", "-p", ":53/udp", "-p", ":53/tcp", opts.UnboundDockerRunOpts.ImageName}
-	cmd := exec.Command(dockerCmd[0], dockerCmd[1:]...)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
-
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+// runUnboundContainer executes unbound docker container, which is full-service resolver for letsdane and firefox-har.
+// unbound.conf is rendered from opts.UnboundConfig and copied into the container before it starts.
+//
+// original command: docker run --rm --network [network name] --name [container name] -d -p :53/udp -p :53/tcp [image name]
+func runUnboundContainer(ctx context.Context, rt ContainerRuntime, opts *commandOptions) error {
+	conf, err := opts.UnboundConfig.render()
 	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
-		return err
+		return fmt.Errorf("failed to render unbound.conf: %w", err)
 	}
-
-	logger.Info(fmt.Sprintf("Stdout: %s", stdout.String()))
-	return nil
+	spec := ContainerSpec{
+		Image:      opts.UnboundDockerRunOpts.ImageName,
+		Name:       opts.UnboundDockerRunOpts.ContainerName,
+		Network:    opts.UnboundDockerRunOpts.NetWork,
+		Ports:      []string{"53/udp", "53/tcp"},
+		AutoRemove: true,
+		Files:      map[string][]byte{unboundConfPath: conf},
+	}
+	opts.UnboundDockerRunOpts.applyNetem(&spec)
+	logger.Info(fmt.Sprintf("run container: %s", spec.Name))
+	return rt.StartContainer(ctx, spec)
 }
 
 // runLetsdaneContainer executes letsdane docker container, which is proxy server for firefox-har.
 //
-// original command: docker run --rm --network=[network name] --name [container name] -d [image name] -verbose -r [resolver ip] -cert /root/.letsdane/cert.crt -key /root/.letsdane/cert.key
-func runLetsdaneContainer(opts *commandOptions) error {
-	dockerCmd := []string{"docker", "run", "--network", opts.LetsdaneDockerRunOpts.NetWork, "--name", opts.LetsdaneDockerRunOpts.ContainerName, "-d", opts.LetsdaneDockerRunOpts.ImageName}
-	letsdaneCmd := []string{"-verbose", "-r", opts.LetsdaneOptions.ResolverIP, "-cert", "/root/.letsdane/cert.crt", "-key", "/root/.letsdane/cert.key", "-skip-dnssec"}
-	cmd := exec.Command(dockerCmd[0], append(dockerCmd[1:], letsdaneCmd...)...)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
-
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
-		return err
+// original command: docker run --rm --network=[network name] --name [container name] -d [image name] -r [resolver ip] [letsdane args]
+func runLetsdaneContainer(ctx context.Context, rt ContainerRuntime, opts *commandOptions) error {
+	spec := ContainerSpec{
+		Image:   opts.LetsdaneDockerRunOpts.ImageName,
+		Name:    opts.LetsdaneDockerRunOpts.ContainerName,
+		Network: opts.LetsdaneDockerRunOpts.NetWork,
+		Cmd:     append([]string{"-r", opts.LetsdaneOptions.ResolverIP}, opts.LetsdaneOptions.Args...),
 	}
-
-	logger.Info(fmt.Sprintf("Stdout: %s", stdout.String()))
-	return nil
+	opts.LetsdaneDockerRunOpts.applyNetem(&spec)
+	logger.Info(fmt.Sprintf("run container: %s %s", spec.Name, strings.Join(spec.Cmd, " ")))
+	return rt.StartContainer(ctx, spec)
 }
 
-func runLetsdaneContainerForFillCache(opts *commandOptions) error {
-	dockerCmd := []string{"docker", "run", "--network", opts.LetsdaneDockerRunOpts.NetWork, "--name", opts.LetsdaneDockerRunOpts.ContainerName + "-fill-cache", "-d", opts.LetsdaneDockerRunOpts.ImageName}
-	letsdaneCmd := []string{"-verbose", "-r", opts.LetsdaneOptions.ResolverIP, "-cert", "/root/.letsdane/cert.crt", "-key", "/root/.letsdane/cert.key"}
-	cmd := exec.Command(dockerCmd[0], append(dockerCmd[1:], letsdaneCmd...)...)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
-
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
-		return err
+func runLetsdaneContainerForFillCache(ctx context.Context, rt ContainerRuntime, opts *commandOptions) error {
+	spec := ContainerSpec{
+		Image:   opts.LetsdaneDockerRunOpts.ImageName,
+		Name:    opts.LetsdaneDockerRunOpts.ContainerName + "-fill-cache",
+		Network: opts.LetsdaneDockerRunOpts.NetWork,
+		Cmd:     append([]string{"-r", opts.LetsdaneOptions.ResolverIP}, opts.LetsdaneOptions.FillCacheArgs...),
 	}
-
-	logger.Info(fmt.Sprintf("Stdout: %s", stdout.String()))
-	return nil
+	opts.LetsdaneDockerRunOpts.applyNetem(&spec)
+	logger.Info(fmt.Sprintf("run container: %s %s", spec.Name, strings.Join(spec.Cmd, " ")))
+	return rt.StartContainer(ctx, spec)
 }
 
-func startCapturePackets(containerName, pcapFilePath string) error {
-	cmd := exec.Command("docker", "exec", "-d", containerName, "tcpdump", "-i", "any", "-w", pcapFilePath)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
+// startCapturePackets starts tcpdump in the container in the background.
+//
+// original command: docker exec -d [container name] tcpdump -i any -w [pcap file path]
+func startCapturePackets(ctx context.Context, rt ContainerRuntime, containerName, pcapFilePath string) error {
+	logger.Info(fmt.Sprintf("start capturing packets: %s %s", containerName, pcapFilePath))
+	return rt.ExecDetached(ctx, containerName, []string{"tcpdump", "-i", "any", "-w", pcapFilePath})
+}
 
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Start()
-	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
-		return err
+// fireFoxHARCmd builds the arguments of pageload_measure.py.
+func fireFoxHARCmd(opts *fireFoxHAROptions, proxyHost string) []string {
+	cmd := []string{opts.Website}
+	if opts.DANE {
+		cmd = append(cmd, "-ph", proxyHost)
+		cmd = append(cmd, "--dane")
+	} else {
+		cmd = append(cmd, "-ri", opts.ResolverIP)
 	}
-
-	logger.Info(fmt.Sprintf("Stdout: %s", stdout.String()))
-	return nil
+	if opts.Timeout > 0 {
+		cmd = append(cmd, "--timeout", strconv.Itoa(opts.Timeout))
+	}
+	return cmd
 }
 
 // runFireFoxHAR executes firefox-har docker container, which runs Firefox and generates HAR file.
 //
 // original command: docker run --rm --network=[network name] --name [container name] [image name] https://www.torproject.org letsdane-www.torproject.org --dane
-func runFireFoxHAR(opts *commandOptions) ([]byte, error) {
-	dockerCmd := []string{"docker", "run", "--network", opts.HARDockerRunOpts.NetWork, "--name", opts.HARDockerRunOpts.ContainerName, opts.HARDockerRunOpts.ImageName}
-	firefoxHARCmd := []string{opts.HAROpts.Website}
-	if opts.HAROpts.DANE {
-		firefoxHARCmd = append(firefoxHARCmd, "-ph", opts.HAROpts.ProxyHost)
-		firefoxHARCmd = append(firefoxHARCmd, "--dane")
-	} else {
-		firefoxHARCmd = append(firefoxHARCmd, "-ri", opts.HAROpts.ResolverIP)
-	}
-
+func runFireFoxHAR(ctx context.Context, rt ContainerRuntime, opts *commandOptions) ([]byte, error) {
+	cmd := fireFoxHARCmd(opts.HAROpts, opts.HAROpts.ProxyHost)
 	if opts.HAROpts.FillCacheOnly {
-		firefoxHARCmd = append(firefoxHARCmd, "--fill_cache_only")
+		cmd = append(cmd, "--fill_cache_only")
 	}
-
-	cmd := exec.Command(dockerCmd[0], append(dockerCmd[1:], firefoxHARCmd...)...)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
-
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
-		return nil, err
+	if opts.HAROpts.RepeatVisit {
+		cmd = append(cmd, "--repeat_visit")
 	}
 
-	return stdout.Bytes(), nil
-}
-
-func runFireFoxHARForFillCache(opts *commandOptions) ([]byte, error) {
-	dockerCmd := []string{"docker", "run", "--rm", "--network", opts.HARDockerRunOpts.NetWork, "--name", opts.HARDockerRunOpts.ContainerName + "-fill-cache", opts.HARDockerRunOpts.ImageName}
-	firefoxHARCmd := []string{opts.HAROpts.Website}
-	if opts.HAROpts.DANE {
-		firefoxHARCmd = append(firefoxHARCmd, "-ph", opts.HAROpts.ProxyHost+"-fill-cache")
-		firefoxHARCmd = append(firefoxHARCmd, "--dane")
-	} else {
-		firefoxHARCmd = append(firefoxHARCmd, "-ri", opts.HAROpts.ResolverIP)
+	spec := ContainerSpec{
+		Image:   opts.HARDockerRunOpts.ImageName,
+		Name:    opts.HARDockerRunOpts.ContainerName,
+		Network: opts.HARDockerRunOpts.NetWork,
+		Cmd:     cmd,
 	}
+	opts.HARDockerRunOpts.applyNetem(&spec)
+	logger.Info(fmt.Sprintf("run container: %s %s", spec.Name, strings.Join(spec.Cmd, " ")))
 
-	firefoxHARCmd = append(firefoxHARCmd, "--fill_cache_only")
-
-	cmd := exec.Command(dockerCmd[0], append(dockerCmd[1:], firefoxHARCmd...)...)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
-
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	result, err := rt.RunContainer(ctx, spec)
 	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
+		var exitErr *ContainerExitError
+		if errors.As(err, &exitErr) {
+			logger.Error(fmt.Sprintf("Stderr: %s", exitErr.Stderr))
+		}
 		return nil, err
 	}
-
-	return stdout.Bytes(), nil
+	return result, nil
 }
 
-func removeContainer(containerName string) error {
-	cmd := exec.Command("docker", "rm", containerName)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
+func runFireFoxHARForFillCache(ctx context.Context, rt ContainerRuntime, opts *commandOptions) ([]byte, error) {
+	cmd := fireFoxHARCmd(opts.HAROpts, opts.HAROpts.ProxyHost+"-fill-cache")
+	cmd = append(cmd, "--fill_cache_only")
 
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
-		return err
+	spec := ContainerSpec{
+		Image:      opts.HARDockerRunOpts.ImageName,
+		Name:       opts.HARDockerRunOpts.ContainerName + "-fill-cache",
+		Network:    opts.HARDockerRunOpts.NetWork,
+		Cmd:        cmd,
+		AutoRemove: true,
 	}
+	opts.HARDockerRunOpts.applyNetem(&spec)
+	logger.Info(fmt.Sprintf("run container: %s %s", spec.Name, strings.Join(spec.Cmd, " ")))
 
-	logger.Info(fmt.Sprintf("Stdout: %s", stdout.String()))
-	return nil
-}
-
-func dockerCopy(containerName, srcPath, dstPath string) error {
-	cmd := exec.Command("docker", "cp", containerName+":"+srcPath, dstPath)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
-
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	result, err := rt.RunContainer(ctx, spec)
 	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
-		return err
+		var exitErr *ContainerExitError
+		if errors.As(err, &exitErr) {
+			logger.Error(fmt.Sprintf("Stderr: %s", exitErr.Stderr))
+		}
+		return nil, err
 	}
-
-	logger.Info(fmt.Sprintf("Stdout: %s", stdout.String()))
-	return nil
+	return result, nil
 }
 
-func stopContainer(containerName string) error {
-	cmd := exec.Command("docker", "stop", containerName)
-	logger.Info(fmt.Sprintf("command: %s", cmd.String()))
+func removeContainer(ctx context.Context, rt ContainerRuntime, containerName string) error {
+	return rt.RemoveContainer(ctx, containerName)
+}
 
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		logger.Error(fmt.Sprintf("Stderr: %s", stderr.String()))
-		return err
-	}
+func dockerCopy(ctx context.Context, rt ContainerRuntime, containerName, srcPath, dstPath string) error {
+	return rt.CopyFromContainer(ctx, containerName, srcPath, dstPath)
+}
 
-	logger.Info(fmt.Sprintf("Stdout: %s", stdout.String()))
-	return nil
+func stopContainer(ctx context.Context, rt ContainerRuntime, containerName string) error {
+	return rt.StopContainer(ctx, containerName)
 }
 
-func collectHAR(opts *commandOptions) ([]byte, error) {
+func collectHAR(ctx context.Context, rt ContainerRuntime, opts *commandOptions) ([]byte, error) {
+	// the containers and the network are removed with cleanupCtx, which is not canceled with ctx,
+	// so that nothing is left behind when the measurement is aborted by a signal.
+	cleanupCtx := context.WithoutCancel(ctx)
+
 	// 1. Create Docker network
-	if err := createDockerNetwork(opts.HARDockerRunOpts.NetWork); err != nil {
+	if err := createDockerNetwork(ctx, rt, opts.HARDockerRunOpts.NetWork); err != nil {
 		return nil, err
 	}
 	defer func() {
 		logger.Info(fmt.Sprintf("remove network: %s", opts.HARDockerRunOpts.NetWork))
-		if removeErr := removeDockerNetwork(opts.HARDockerRunOpts.NetWork); removeErr != nil {
+		if removeErr := removeDockerNetwork(cleanupCtx, rt, opts.HARDockerRunOpts.NetWork); removeErr != nil {
 			logger.Error(fmt.Sprintf("Failed to remove Docker network: %s", removeErr))
 		}
 	}()
 
 	// 2. Run unbound
-	if err := runUnboundContainer(opts); err != nil {
+	if err := runUnboundContainer(ctx, rt, opts); err != nil {
 		return nil, err
 	}
 	defer func() {
 		logger.Info(fmt.Sprintf("stop container: %s", opts.UnboundDockerRunOpts.ContainerName))
-		if stopErr := stopContainer(opts.UnboundDockerRunOpts.ContainerName); stopErr != nil {
+		if stopErr := stopContainer(cleanupCtx, rt, opts.UnboundDockerRunOpts.ContainerName); stopErr != nil {
 			logger.Error(fmt.Sprintf("Failed to stop Docker container: %s", stopErr))
 		}
 	}()
 
 	// Get the IP address of the unbound
-	unboundIP, err := getContainerIP(opts.UnboundDockerRunOpts.ContainerName)
+	unboundIP, err := getContainerIP(ctx, rt, opts.UnboundDockerRunOpts.ContainerName)
 	if err != nil {
 		return nil, err
 	}
@@ -435,90 +412,120 @@ func collectHAR(opts *commandOptions) ([]byte, error) {
 	if opts.HAROpts.DANE {
 		opts.LetsdaneOptions.ResolverIP = unboundIP
 	}
+	if opts.HTTPProbeOpts != nil {
+		opts.HTTPProbeOpts.ResolverIP = unboundIP
+	}
 
 	// 3. fill cache before measuring page load time if cache is enabled
 	if opts.Cache {
 		if opts.HAROpts.DANE {
-			if err := runLetsdaneContainerForFillCache(opts); err != nil {
+			if err := runLetsdaneContainerForFillCache(ctx, rt, opts); err != nil {
 				return nil, err
 			}
 			defer func() {
-				if stopErr := stopContainer(opts.LetsdaneDockerRunOpts.ContainerName + "-fill-cache"); stopErr != nil {
+				if stopErr := stopContainer(cleanupCtx, rt, opts.LetsdaneDockerRunOpts.ContainerName+"-fill-cache"); stopErr != nil {
 					logger.Error(fmt.Sprintf("Failed to stop Docker container: %s", stopErr))
 				}
-				if err := removeContainer(opts.LetsdaneDockerRunOpts.ContainerName + "-fill-cache"); err != nil {
+				if err := removeContainer(cleanupCtx, rt, opts.LetsdaneDockerRunOpts.ContainerName+"-fill-cache"); err != nil {
 					logger.Error(fmt.Sprintf("Failed to remove Docker container: %s", err))
 				}
 			}()
 		}
 
-		if _, err := runFireFoxHARForFillCache(opts); err != nil {
+		if opts.HTTPProbeOpts != nil {
+			if _, err := runHTTPProbe(ctx, rt, opts, true); err != nil {
+				logger.Info(fmt.Sprintf("ignore this error when filling cache: %s", err))
+			}
+		} else if _, err := runFireFoxHARForFillCache(ctx, rt, opts); err != nil {
 			logger.Info(fmt.Sprintf("ignore this error when filling cache: %s", err))
 		}
 
 		logger.Info(fmt.Sprintf("finish filling cache: %s", opts.HAROpts.Website))
 	}
+	// the error of filling cache is ignored, but not the abort of the measurement.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// the resource usage is sampled from here until the page is loaded, so that it does not include filling cache.
+	sampler := startResourceSampler(ctx, rt, opts.ResourceOpts, measurementContainers(opts), opts.PcapOpts.ResultDirPath, opts.PcapOpts.PcapSuffix)
+	defer sampler.finish()
 
-	if err := startCapturePackets(opts.UnboundDockerRunOpts.ContainerName, unboundPcapFilePath); err != nil {
+	if err := startCapturePackets(ctx, rt, opts.UnboundDockerRunOpts.ContainerName, unboundPcapFilePath); err != nil {
 		logger.Error(fmt.Sprintf("Failed to start capturing packets in the unbound Docker container: %s", err))
 		return nil, err
 	}
 	defer func() {
 		outputFileName := "unbound" + opts.PcapOpts.PcapSuffix + ".pcap"
 		logger.Info(fmt.Sprintf("copy pcap file: %s", outputFileName))
-		if err := dockerCopy(opts.UnboundDockerRunOpts.ContainerName, unboundPcapFilePath, filepath.Join("./", opts.PcapOpts.ResultDirPath, outputFileName)); err != nil {
+		if err := dockerCopy(cleanupCtx, rt, opts.UnboundDockerRunOpts.ContainerName, unboundPcapFilePath, filepath.Join(opts.PcapOpts.ResultDirPath, outputFileName)); err != nil {
 			logger.Error(fmt.Sprintf("Failed to copy pcap file: %s", err))
 		}
 	}()
 
 	// 4. Run letsdane if DANE is enabled
 	if opts.HAROpts.DANE {
-		if err := runLetsdaneContainer(opts); err != nil {
+		if err := runLetsdaneContainer(ctx, rt, opts); err != nil {
 			return nil, err
 		}
 		defer func() {
 			// Stop and remove the letsdane Docker container
 			logger.Info(fmt.Sprintf("stop container: %s", opts.LetsdaneDockerRunOpts.ContainerName))
-			if stopErr := stopContainer(opts.LetsdaneDockerRunOpts.ContainerName); stopErr != nil {
+			if stopErr := stopContainer(cleanupCtx, rt, opts.LetsdaneDockerRunOpts.ContainerName); stopErr != nil {
 				logger.Error(fmt.Sprintf("Failed to stop Docker container: %s", stopErr))
 			}
 			logger.Info(fmt.Sprintf("remove container: %s", opts.LetsdaneDockerRunOpts.ContainerName))
-			if err := removeContainer(opts.LetsdaneDockerRunOpts.ContainerName); err != nil {
+			if err := removeContainer(cleanupCtx, rt, opts.LetsdaneDockerRunOpts.ContainerName); err != nil {
 				logger.Error(fmt.Sprintf("Failed to remove Docker container: %s", err))
 			}
 		}()
-		if err := startCapturePackets(opts.LetsdaneDockerRunOpts.ContainerName, letsdanePcapFilePath); err != nil {
+		if err := startCapturePackets(ctx, rt, opts.LetsdaneDockerRunOpts.ContainerName, letsdanePcapFilePath); err != nil {
 			logger.Error(fmt.Sprintf("Failed to start capturing packets in the letsdane Docker container: %s", err))
 			return nil, err
 		}
 		defer func() {
 			outputFileName := "letsdane" + opts.PcapOpts.PcapSuffix + ".pcap"
 			logger.Info(fmt.Sprintf("copy pcap file: %s", outputFileName))
-			if err := dockerCopy(opts.LetsdaneDockerRunOpts.ContainerName, letsdanePcapFilePath, filepath.Join("./", opts.PcapOpts.ResultDirPath, outputFileName)); err != nil {
+			if err := dockerCopy(cleanupCtx, rt, opts.LetsdaneDockerRunOpts.ContainerName, letsdanePcapFilePath, filepath.Join(opts.PcapOpts.ResultDirPath, outputFileName)); err != nil {
 				logger.Error(fmt.Sprintf("Failed to copy pcap file: %s", err))
 			}
 		}()
 		defer func() {
 			outputFileName := "letsdane" + opts.DANEValidationResultOpts.ResultFileSuffix + ".csv"
 			logger.Info(fmt.Sprintf("copy DANE validation result file: %s", outputFileName))
-			if err := dockerCopy(opts.LetsdaneDockerRunOpts.ContainerName, letsdaneDANEValidationResultFilePath, filepath.Join("./", opts.DANEValidationResultOpts.ResultDirPath, outputFileName)); err != nil {
+			if err := dockerCopy(cleanupCtx, rt, opts.LetsdaneDockerRunOpts.ContainerName, letsdaneDANEValidationResultFilePath, filepath.Join(opts.DANEValidationResultOpts.ResultDirPath, outputFileName)); err != nil {
 				logger.Error(fmt.Sprintf("Failed to copy DANE validation result file: %s", err))
 			}
 		}()
 	}
 
-	result, err := runFireFoxHAR(opts)
+	// the http probe runs in pageloadtime, so there is no Firefox container to remove.
+	if opts.HTTPProbeOpts != nil {
+		result, err := runHTTPProbe(ctx, rt, opts, false)
+		sampler.finish()
+		return result, err
+	}
+
+	result, err := runFireFoxHAR(ctx, rt, opts)
+	sampler.finish()
 	// copy pcap file and remove container regardless of whether the measurement was successful or not.
 	defer func() {
+		// Firefox is still running if the measurement was aborted.
+		if ctx.Err() != nil {
+			logger.Info(fmt.Sprintf("stop container: %s", opts.HARDockerRunOpts.ContainerName))
+			if stopErr := stopContainer(cleanupCtx, rt, opts.HARDockerRunOpts.ContainerName); stopErr != nil {
+				logger.Error(fmt.Sprintf("Failed to stop Docker container: %s", stopErr))
+			}
+		}
 		logger.Info(fmt.Sprintf("remove container: %s", opts.HARDockerRunOpts.ContainerName))
-		if err := removeContainer(opts.HARDockerRunOpts.ContainerName); err != nil {
+		if err := removeContainer(cleanupCtx, rt, opts.HARDockerRunOpts.ContainerName); err != nil {
 			logger.Error(fmt.Sprintf("Failed to remove Docker container: %s", err))
 		}
 	}()
 	defer func() {
 		outputFileName := "firefox" + opts.PcapOpts.PcapSuffix + ".pcap"
 		logger.Info(fmt.Sprintf("copy pcap file: %s", outputFileName))
-		if err := dockerCopy(opts.HARDockerRunOpts.ContainerName, firefoxPcapFilePath, filepath.Join("./", opts.PcapOpts.ResultDirPath, outputFileName)); err != nil {
+		if err := dockerCopy(cleanupCtx, rt, opts.HARDockerRunOpts.ContainerName, firefoxPcapFilePath, filepath.Join(opts.PcapOpts.ResultDirPath, outputFileName)); err != nil {
 			logger.Error(fmt.Sprintf("Failed to copy pcap file: %s", err))
 		}
 	}()
@@ -526,84 +533,555 @@ func collectHAR(opts *commandOptions) ([]byte, error) {
 	return result, err
 }
 
-func measurementPatternSuffix(cache, dane bool) string {
-	var suffix string
-	if !cache && !dane {
-		suffix = "-" + string(withoutCacheWithoutDane)
+// measurementContainers returns the names of the containers which load the page in the measurement.
+func measurementContainers(opts *commandOptions) []string {
+	containers := []string{opts.UnboundDockerRunOpts.ContainerName}
+	if opts.HAROpts.DANE {
+		containers = append(containers, opts.LetsdaneDockerRunOpts.ContainerName)
 	}
-	if cache && !dane {
-		suffix = "-" + string(withCacheWithoutDane)
+	if opts.HTTPProbeOpts == nil {
+		containers = append(containers, opts.HARDockerRunOpts.ContainerName)
 	}
-	if !cache && dane {
-		suffix = "-" + string(withoutCacheWithDane)
+	return containers
+}
+
+// measurementPatternSuffix returns the measurement pattern with a leading "-". withoutDNSSEC is the pattern with DNSSEC validation disabled in unbound.
+func measurementPatternSuffix(cache, dane, withoutDNSSEC bool) string {
+	var pattern measurementPattern
+	switch {
+	case !cache && !dane:
+		pattern = withoutCacheWithoutDane
+	case cache && !dane:
+		pattern = withCacheWithoutDane
+	case !cache && dane:
+		pattern = withoutCacheWithDane
+	default:
+		pattern = withCacheWithDane
 	}
-	if cache && dane {
-		suffix = "-" + string(withCacheWithDane)
+	if withoutDNSSEC {
+		switch pattern {
+		case withoutCacheWithoutDane:
+			pattern = withoutCacheWithoutDaneWithoutDNSSEC
+		case withCacheWithoutDane:
+			pattern = withCacheWithoutDaneWithoutDNSSEC
+		case withoutCacheWithDane:
+			pattern = withoutCacheWithDaneWithoutDNSSEC
+		case withCacheWithDane:
+			pattern = withCacheWithDaneWithoutDNSSEC
+		}
 	}
-	return suffix
+	return "-" + string(pattern)
 }
 
-func generateMeasurementID(record utils.Record, cache, dane bool) string {
-	return record.Domain + measurementPatternSuffix(cache, dane)
+// generateMeasurementID returns the ID of the measurement of the page in the scenario, which starts with the slug of the page.
+//
+// e.g. example.com-with-cache-with-dane, example.com-with-cache-with-dane-rtt50 with an impairment
+// or example.com_news-with-cache-with-dane for https://example.com/news
+func generateMeasurementID(record utils.Record, s scenario) string {
+	return record.Slug() + "-" + s.String()
 }
 
-func unboundDockerImage(cache bool) string {
-	if cache {
-		return unboundWithCacheImageName
+// trialMeasurementID appends the trial index to the measurement ID when a domain is measured more than once in a scenario.
+//
+// e.g. example.com-with-cache-with-dane-trial-2
+func trialMeasurementID(record utils.Record, s scenario, trial, trials int) string {
+	measurementID := generateMeasurementID(record, s)
+	if trials > 1 {
+		measurementID += "-trial-" + strconv.Itoa(trial)
 	}
-	return unboundWithoutCacheImageName
+	return measurementID
+}
+
+// measurementCommandOptions builds the options of collectHAR for the domain.
+// Every container and network name contains the measurement ID, so that measurements can run in parallel.
+func measurementCommandOptions(exp *experiment, record utils.Record, s scenario, measurementID, outPutDir string) *commandOptions {
+	// this resolver IP is overwritten by the IP address of the unbound Docker container.
+	var resolverIP string
+	network := strings.Join([]string{"network", measurementID}, "-")
+	unboundContainerName := strings.Join([]string{"unbound", measurementID}, "-")
+	unboundDockerOpts := newDockerRunOptions(exp.Images.Unbound, network, unboundContainerName)
+
+	var proxyHost string
+	var letsdaneDockerOpts *dockerRunOptions
+	var letsdaneOpts *LetsdaneOptions
+	if s.DANE {
+		letsdaneContainerName := strings.Join([]string{"letsdane", measurementID}, "-")
+		letsdaneDockerOpts = newDockerRunOptions(exp.Images.Letsdane, network, letsdaneContainerName)
+		args, fillCacheArgs := exp.letsdaneArgs(s)
+		letsdaneOpts = newLetsdaneOptions(resolverIP, args, fillCacheArgs)
+		proxyHost = letsdaneContainerName
+	}
+	firefoxHARContainerName := strings.Join([]string{"firefox", measurementID}, "-")
+	HARDockerOpts := newDockerRunOptions(exp.Images.Firefox, network, firefoxHARContainerName)
+	// every container impairs the packets to outside of the network, which are sent by unbound, letsdane and firefox.
+	if profile, ok := exp.impairment(s.Impairment); ok {
+		for _, o := range []*dockerRunOptions{unboundDockerOpts, letsdaneDockerOpts, HARDockerOpts} {
+			if o != nil {
+				o.Netem = profile.netem()
+			}
+		}
+	}
+	HAROpts := newFireFoxHAROptions(record.TargetURL(), resolverIP, proxyHost, s.DANE, exp.Firefox.TimeoutSeconds)
+	HAROpts.RepeatVisit = s.RepeatVisit
+	pcapSuffix := "-" + measurementID
+	pcapOpts := newPcapOptions(outPutDir, pcapSuffix)
+
+	DANEValidationResultSuffix := "-" + measurementID
+	DANEValidationResultOpts := NewDANEValidationResultOpts(outPutDir, DANEValidationResultSuffix)
+
+	opts := newCommandOptions(letsdaneDockerOpts, letsdaneOpts, HARDockerOpts, HAROpts, unboundDockerOpts, pcapOpts, DANEValidationResultOpts, s.Cache)
+	opts.UnboundConfig = exp.unboundConfig(s.Cache)
+	if s.WithoutDNSSEC {
+		opts.UnboundConfig.DNSSECValidation = false
+	}
+	if exp.Probe == probeHTTP {
+		opts.HTTPProbeOpts = &httpProbeOptions{
+			Website:    HAROpts.Website,
+			CACertPath: exp.HTTPProbe.CACert,
+			Timeout:    time.Duration(exp.HTTPProbe.TimeoutSeconds) * time.Second,
+		}
+	}
+	if exp.Resources.IntervalMilliseconds > 0 {
+		opts.ResourceOpts = &resourceOptions{
+			Interval:          time.Duration(exp.Resources.IntervalMilliseconds) * time.Millisecond,
+			SaturationPercent: exp.Resources.SaturationPercent,
+		}
+	}
+	return opts
 }
 
 type HARFileContent struct {
 	Directory string
 	FileName  string
 	Content   []byte
-	Domain    string
+	// Domain is the slug of the page. See utils.Record.Slug.
+	Domain   string
+	Scenario scenario
+	Trial    int
+	Website  string
+	// Err is the error of collectHAR.
+	Err error
+	// DANEValidationResultPath is the DANE validation result of letsdane. It is empty without DANE.
+	DANEValidationResultPath string
+	// HostSaturated is true if the CPU of the host was saturated while loading the page.
+	HostSaturated bool
+}
+
+// saveHARContent saves the HAR file and its csv, and returns the page load time of the first page.
+// If the HAR file is empty or has no valid page load time, it returns the failure reason.
+func saveHARContent(content HARFileContent) (int, failureReason) {
+	if len(content.Content) == 0 {
+		logger.Info(fmt.Sprintf("Har file is empty: %s", content.FileName))
+		return 0, classifyFailure(content, nil)
+	}
+
+	var harLog har.Log
+	if err := json.Unmarshal(content.Content, &harLog); err != nil {
+		logger.Error(fmt.Sprintf("Failed to unmarshal HAR file: %s", err))
+		return 0, classifyFailure(content, nil)
+	}
+	har := har.Har{
+		Log: harLog,
+	}
+	// drop each response content because it is too large size
+	har.DropEachResponseContent()
+
+	if !har.ValidPageLoadTime() {
+		logger.Warn(fmt.Sprintf("Fail to get pageload time from HAR file: %s", content.FileName))
+		return 0, classifyFailure(content, &har)
+	}
+
+	logger.Info(fmt.Sprintf("success to get pageload time from HAR file: %s", content.FileName))
+
+	// export as har file
+	if err := har.Save(filepath.Join(content.Directory, content.FileName)); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save HAR file as har: %s", err))
+	}
+	// save as csv
+	csvHar := har.ConvertCSVFormat()
+	if err := csvHar.SaveAsCSV(filepath.Join(content.Directory, strings.Join([]string{strings.TrimSuffix(content.FileName, filepath.Ext(content.FileName)), "csv"}, "."))); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save HAR file as csv: %s", err))
+	}
+
+	return har.OnLoadOfFirstPage(), failureNone
+}
+
+// sortPageLoadTimeRecords sorts records by domain, then by the order of scenarios and then by trial.
+func sortPageLoadTimeRecords(records []utils.PageLoadTimeRecord, scenarios []scenario) {
+	order := make(map[scenario]int)
+	for i, s := range scenarios {
+		order[s] = i
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Domain != records[j].Domain {
+			return records[i].Domain < records[j].Domain
+		}
+		si := order[recordScenario(records[i])]
+		sj := order[recordScenario(records[j])]
+		if si != sj {
+			return si < sj
+		}
+		return records[i].Trial < records[j].Trial
+	})
+}
+
+// recordScenario returns the scenario in which the record was measured.
+func recordScenario(record utils.PageLoadTimeRecord) scenario {
+	return scenario{Cache: record.Cache, DANE: record.Dane, WithoutDNSSEC: record.WithoutDNSSEC, Resolver: resolverMode(record.Resolver), RepeatVisit: record.RepeatVisit, Impairment: record.Impairment}
+}
+
+// scenarioPageLoadTimeRecords returns the records of the scenario.
+func scenarioPageLoadTimeRecords(records []utils.PageLoadTimeRecord, s scenario) []utils.PageLoadTimeRecord {
+	var filtered []utils.PageLoadTimeRecord
+	for _, record := range records {
+		if recordScenario(record) == s {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+// experimentFlags are the flags which override the values of the experiment file.
+type experimentFlags struct {
+	cache       bool
+	dane        bool
+	scenarios   string
+	impairments string
+	resolvers   string
+	visits      string
+	probe       string
+	inputCSV    string
+	first       int
+	last        int
+	trials      int
+	concurrency int
+	subDirName  string
+	store       storage.Config
+}
+
+// newExperiment builds the experiment from the file given by -experiment, or from the defaults if it is empty.
+// The flags set explicitly on the command line, whose names are in set, override the values of the file.
+func newExperiment(path string, start time.Time, set map[string]bool, flags experimentFlags) (*experiment, error) {
+	exp := defaultExperiment(start)
+	if path != "" {
+		var err error
+		exp, err = loadExperiment(path, start)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if set["scenarios"] && (set["cache"] || set["dane"]) {
+		return nil, errors.New("-scenarios cannot be used with -cache or -dane")
+	}
+	if set["cache"] || set["dane"] {
+		exp.Scenarios = []string{scenario{Cache: flags.cache, DANE: flags.dane}.String()}
+	}
+	if set["scenarios"] {
+		exp.Scenarios = strings.Split(flags.scenarios, ",")
+	}
+	if set["inputCSV"] {
+		exp.Input.CSV = flags.inputCSV
+	}
+	if set["first"] {
+		exp.Input.First = flags.first
+	}
+	if set["last"] {
+		exp.Input.Last = flags.last
+	}
+	if set["impairments"] {
+		exp.Impairments = strings.Split(flags.impairments, ",")
+	}
+	if set["letsdane-resolvers"] {
+		exp.Letsdane.ResolverModes = strings.Split(flags.resolvers, ",")
+	}
+	if set["visits"] {
+		exp.Firefox.Visits = strings.Split(flags.visits, ",")
+	}
+	if set["probe"] {
+		exp.Probe = flags.probe
+	}
+	if set["trials"] {
+		exp.Trials = flags.trials
+	}
+	if set["concurrency"] {
+		exp.Concurrency = flags.concurrency
+	}
+	if set["subdirname"] {
+		exp.Output.SubDirName = flags.subDirName
+	}
+	if set["store"] {
+		exp.Output.Store.URL = flags.store.URL
+	}
+	if set["s3-endpoint"] {
+		exp.Output.Store.Endpoint = flags.store.Endpoint
+	}
+	if set["s3-region"] {
+		exp.Output.Store.Region = flags.store.Region
+	}
+	if set["aws-profile"] {
+		exp.Output.Store.Profile = flags.store.Profile
+	}
+
+	if err := exp.validate(); err != nil {
+		return nil, err
+	}
+	return exp, nil
 }
 
 // go run main.go -website example.com -cache -timeout 30 -dane -measurementID 1 -first 1 -last 100 -concurrency 10
+// go run main.go -scenarios all -trials 5 -first 1 -last 100 -concurrency 10
+// go run main.go -experiment experiments/all-scenarios.yaml
+// go run main.go -experiment experiments/all-scenarios.yaml -dry-run
+// go run main.go gc -dry-run
+// go run main.go -experiment experiments/all-scenarios.yaml -coordinator-addr :9200
+// go run main.go worker -coordinator http://10.0.0.1:9200 -concurrency 10
+// go run main.go -experiment experiments/all-scenarios.yaml -retry-from ../../result/pageloadtime/all-scenarios/pageloadtime-scenarios.csv -retries 2
+// go run main.go daemon -experiment experiments/all-scenarios.yaml -schedule "0 */6 * * *" -max-runtime 5h -status-addr :9300
 func main() {
 	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		if err := gcCommand(os.Args[2:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		if err := workerCommand(os.Args[2:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "daemon" {
+		if err := daemonCommand(os.Args[2:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	start := time.Now()
-	cache := flag.Bool("cache", false, "Enable DNS cache")
-	dane := flag.Bool("dane", false, "Enable DANE")
-	first := flag.Int("first", 1, "first index of Domain list")
-	last := flag.Int("last", -1, "last index of Domain list. if -1, last index is last index of Domain list")
-	subDirName := flag.String("subdirname", start.Format("2006-01-02-15-04-05"), "sub directory name")
-	inputCSV := flag.String("inputCSV", defaultInputCSV, "input CSV path")
-	concurrency := flag.Int("concurrency", 1, "number of goroutines to run at once")
+	var flags experimentFlags
+	experimentPath := flag.String("experiment", "", "experiment definition file (.yaml, .yml or .json). flags set explicitly override its values")
+	flag.BoolVar(&flags.cache, "cache", false, "Enable DNS cache")
+	flag.BoolVar(&flags.dane, "dane", false, "Enable DANE")
+	flag.StringVar(&flags.scenarios, "scenarios", "", "comma separated measurement patterns measured back-to-back for each domain (e.g. without-cache-without-dane,with-cache-with-dane-without-dnssec), all or all-without-dnssec. if empty, -cache and -dane are used")
+	flag.StringVar(&flags.resolvers, "letsdane-resolvers", "", "comma separated resolvers of letsdane (stub,recursive) to measure each scenario with DANE with. if empty, letsdane.args of the experiment decide it")
+	flag.StringVar(&flags.visits, "visits", "", "comma separated visits of Firefox (first,repeat) to measure each scenario with. repeat loads the page twice in the same profile and measures the second load. if empty, only first is measured")
+	flag.StringVar(&flags.impairments, "impairments", "", "comma separated network impairment profiles (e.g. none,rtt50,loss1) to measure each scenario with. if empty, the network is not impaired")
+	flag.StringVar(&flags.probe, "probe", probeFirefox, "how to load the page: firefox (Firefox with Selenium) or http (net/http of pageloadtime, which records the timings of each request without a browser)")
+	flag.IntVar(&flags.first, "first", 1, "first index of Domain list")
+	flag.IntVar(&flags.last, "last", -1, "last index of Domain list. if -1, last index is last index of Domain list")
+	flag.StringVar(&flags.subDirName, "subdirname", start.Format("2006-01-02-15-04-05"), "sub directory name")
+	flag.StringVar(&flags.inputCSV, "inputCSV", defaultInputCSV, "input CSV path")
+	flag.IntVar(&flags.concurrency, "concurrency", 1, "number of goroutines to run at once")
+	flag.IntVar(&flags.trials, "trials", 1, "number of trials of each scenario for each domain")
+	flags.store.RegisterFlags(flag.CommandLine)
+	resume := flag.Bool("resume", false, "skip measurements recorded in the journal of -subdirname and rebuild the result from it")
+	dockerHost := flag.String("docker-host", os.Getenv("DOCKER_HOST"), "docker daemon socket. if empty, "+defaultDockerHost+" is used")
+	metricsAddr := flag.String("metrics-addr", "", "address to serve /metrics (Prometheus) and /status (JSON) during the measurement, e.g. :9100. if empty, they are not served")
+	coordinatorAddr := flag.String("coordinator-addr", "", "address to hand out the measurements to the workers (pageloadtime worker) over HTTP instead of running them here, e.g. :9200")
+	leaseDuration := flag.Duration("lease", defaultLeaseDuration, "how long a worker holds a measurement without renewing the lease before it is handed out to another worker")
+	retryFrom := flag.String("retry-from", "", "pageloadtime-*.csv of a previous run. only its rows without a page load time are measured again in its result directory, and the CSV files are rebuilt with the new results")
+	retries := flag.Int("retries", 1, "how many times each failed measurement of -retry-from is measured again at most. it stops at the first success")
+	retryReasons := flag.String("retry-reasons", "", "comma separated failure reasons (e.g. browser-timeout,container-error) of the rows of -retry-from to measure again. if empty, every failed row is measured again")
+	dryRunFlag := flag.Bool("dry-run", false, "print the plan of the measurement and check the images and the result directory without starting containers")
 	flag.Parse()
 
-	logger.Info(fmt.Sprintf("measurement started at %s", start.Format("2006-01-02-15-04-05")))
-
-	domainList, err := utils.ReadDomainListCSV(*inputCSV)
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	exp, err := newExperiment(*experimentPath, start, set, flags)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	if *leaseDuration <= 0 {
+		log.Fatalln("-lease must be positive")
+	}
+	var retry *retryPlan
+	if *retryFrom != "" {
+		if *resume || *dryRunFlag {
+			log.Fatalln("-retry-from cannot be used with -resume or -dry-run")
+		}
+		var reasons []string
+		if *retryReasons != "" {
+			reasons = strings.Split(*retryReasons, ",")
+		}
+		retry, err = newRetryPlan(*retryFrom, reasons, *retries)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := retry.apply(exp); err != nil {
+			log.Fatalln(err)
+		}
+	}
 
-	if *last == -1 {
-		*last = len(domainList)
+	// open the result store before the measurement to find a wrong URL early.
+	var store storage.ResultStore
+	if exp.Output.Store.URL != "" {
+		store, err = storage.New(exp.Output.Store)
+		if err != nil {
+			log.Fatalln(err)
+		}
 	}
-	subsetDomainList := domainList[*first-1 : *last]
 
-	// create directory for this measurement
-	resultSubDirectoryPath := filepath.Join(resultDirectoryPath, *subDirName)
+	dockerRT, err := newDockerRuntime(*dockerHost)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-	if err := os.MkdirAll(resultSubDirectoryPath, 0755); err != nil {
-		if !os.IsExist(err) {
+	if *dryRunFlag {
+		if err := dryRun(context.Background(), dockerRT, exp, *resume, os.Stdout); err != nil {
 			log.Fatalln(err)
 		}
+		return
 	}
 
+	p := newProgress(start)
+	rt := &progressRuntime{ContainerRuntime: dockerRT, progress: p}
+	if *metricsAddr != "" {
+		server := &http.Server{Addr: *metricsAddr, Handler: p.handler()}
+		go func() {
+			logger.Info(fmt.Sprintf("serve /metrics and /status on %s", *metricsAddr))
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error(fmt.Sprintf("Failed to serve metrics: %s", err))
+			}
+		}()
+		defer server.Close()
+	}
+
+	// on SIGINT or SIGTERM, the running measurements are aborted and their containers and networks are removed.
+	// the second signal terminates pageloadtime immediately, which may leave them behind (see pageloadtime gc).
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// stop restores the default behavior of the signals.
+		<-ctx.Done()
+		stop()
+	}()
+
+	opts := runOptions{Resume: *resume, CoordinatorAddr: *coordinatorAddr, LeaseDuration: *leaseDuration, Retry: retry}
+	if err := run(ctx, rt, p, store, exp, opts, start); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// subsetDomains reads the domain list of the experiment and returns its range from input.first to input.last,
+// and the number of domains in the whole list.
+func subsetDomains(exp *experiment) ([]utils.Record, int, error) {
+	dataset, err := utils.ReadDataset(exp.Input.CSV)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, rejected := range dataset.Rejected {
+		logger.Warn(fmt.Sprintf("skip %s of %s", rejected, exp.Input.CSV))
+	}
+	domainList := dataset.Records
+
+	last := exp.Input.Last
+	if last == -1 || last > len(domainList) {
+		last = len(domainList)
+	}
+	if exp.Input.First > last {
+		return nil, 0, fmt.Errorf("input.first %d is out of the domain list of %d domains", exp.Input.First, len(domainList))
+	}
+	return domainList[exp.Input.First-1 : last], len(domainList), nil
+}
+
+// resumedMeasurements returns the measurements finished in the journal. A missing journal has none.
+func resumedMeasurements(journalPath string) (map[journalKey]bool, error) {
+	entries, err := readJournal(journalPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	finished := finishedMeasurements(entries)
+	logger.Info(fmt.Sprintf("resume from %s: %d measurements are already finished", journalPath, len(finished)))
+	return finished, nil
+}
+
+// measurementResult is the outcome of a measurement, which is journaled by run.
+// It is sent by the workers to the coordinator as JSON.
+type measurementResult struct {
+	// Domain is the slug of the page. See utils.Record.Slug.
+	Domain        string   `json:"domain"`
+	Scenario      scenario `json:"scenario"`
+	Trial         int      `json:"trial"`
+	MeasurementID string   `json:"measurementID"`
+	// Aborted is true if the measurement was aborted by a signal. It is measured again with -resume.
+	Aborted       bool          `json:"aborted,omitempty"`
+	PageLoadTime  int           `json:"pageLoadTime"`
+	FailureReason failureReason `json:"failureReason,omitempty"`
+	HostSaturated bool          `json:"hostSaturated,omitempty"`
+}
+
+// measure runs a measurement of the page in the scenario and saves its HAR file into outPutDir,
+// where collectHAR also writes the pcap files and the other results.
+func measure(ctx context.Context, rt ContainerRuntime, exp *experiment, record utils.Record, s scenario, trial int, outPutDir string) measurementResult {
+	measurementID := trialMeasurementID(record, s, trial, exp.Trials)
+	opts := measurementCommandOptions(exp, record, s, measurementID, outPutDir)
+
+	// collect HAR file
+	content, err := collectHAR(ctx, rt, opts)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to collect HAR file: %s", err))
+	}
+
+	result := measurementResult{Domain: record.Slug(), Scenario: s, Trial: trial, MeasurementID: measurementID}
+	if errors.Is(err, context.Canceled) {
+		result.Aborted = true
+		return result
+	}
+
+	outPutFileName := strings.Join([]string{measurementID, "har"}, ".") // example.com-with-cache-with-dane.har or example.com-with-cache-with-dane-trial-1.har
+
+	harContent := HARFileContent{
+		Directory: outPutDir,
+		FileName:  outPutFileName,
+		Content:   content,
+		Domain:    record.Slug(),
+		Scenario:  s,
+		Trial:     trial,
+		Website:   opts.HAROpts.Website,
+		Err:       err,
+	}
+	if opts.ResourceOpts != nil {
+		harContent.HostSaturated = opts.ResourceOpts.Saturated
+	}
+	if s.DANE {
+		harContent.DANEValidationResultPath = filepath.Join(opts.DANEValidationResultOpts.ResultDirPath, "letsdane"+opts.DANEValidationResultOpts.ResultFileSuffix+".csv")
+	}
+
+	result.HostSaturated = harContent.HostSaturated
+	result.PageLoadTime, result.FailureReason = saveHARContent(harContent)
+	return result
+}
+
+// measureLocally runs the measurements which are not finished with exp.Concurrency goroutines, and sends their results.
+// results is closed when all of them end.
+func measureLocally(ctx context.Context, rt ContainerRuntime, p *progress, exp *experiment, subsetDomainList []utils.Record, scenarios []scenario, finished map[journalKey]bool, results chan<- measurementResult) {
+	defer close(results)
+
 	// execute in parallel
 	logger.Info("start measuring page load time")
 
+	resultSubDirectoryPath := exp.resultSubDirectoryPath()
+	trials := exp.Trials
 	var wg sync.WaitGroup
-	sem := make(chan struct{}, *concurrency)
-	harContentChan := make(chan HARFileContent, len(subsetDomainList))
+	defer wg.Wait()
+	sem := make(chan struct{}, exp.Concurrency)
 	for index, record := range subsetDomainList {
-		sem <- struct{}{}
+		if pendingMeasurements(record, scenarios, trials, finished) == 0 {
+			logger.Info(fmt.Sprintf("skip finished domain %d: %s", index+1, record.TargetURL()))
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			logger.Info(fmt.Sprintf("stop starting measurements at domain %d: %s", index+1, record.TargetURL()))
+			return
+		}
 		wg.Add(1)
 
 		go func(index int, record utils.Record) {
@@ -612,116 +1090,269 @@ func main() {
 				wg.Done()
 			}()
 
-			outPutDir := filepath.Join(resultSubDirectoryPath, record.Domain) // ../../result/pageloadtime/1/example.com/
+			outPutDir := filepath.Join(resultSubDirectoryPath, record.Slug()) // ../../result/pageloadtime/1/example.com/
 			if err := os.MkdirAll(outPutDir, 0755); err != nil {
 				if !os.IsExist(err) {
-					logger.Error("Failed to create directory:", err)
+					logger.Error(fmt.Sprintf("Failed to create directory: %s", err))
 				}
 			}
 
-			// this resolver IP is overwritten by the IP address of the unbound Docker container.
-			var resolverIP string
-			network := strings.Join([]string{"network", generateMeasurementID(record, *cache, *dane)}, "-")
-			unboundContainerName := strings.Join([]string{"unbound", generateMeasurementID(record, *cache, *dane)}, "-")
-			unboundDockerOpts := newDockerRunOptions(unboundDockerImage(*cache), network, unboundContainerName)
-
-			var proxyHost string
-			var letsdaneDockerOpts *dockerRunOptions
-			var letsdaneOpts *LetsdaneOptions
-			if *dane {
-				letsdaneContainerName := strings.Join([]string{"letsdane", generateMeasurementID(record, *cache, *dane)}, "-")
-				letsdaneDockerOpts = newDockerRunOptions(letsdaneImageName, network, letsdaneContainerName)
-				letsdaneOpts = newLetsdaneOptions(resolverIP)
-				proxyHost = letsdaneContainerName
+			// all scenarios of the domain are measured back-to-back to avoid temporal bias between scenarios.
+			// with several trials, every trial measures all scenarios once.
+			for trial := 1; trial <= trials; trial++ {
+				for _, s := range scenarios {
+					if finished[journalKey{Domain: record.Slug(), Scenario: s.String(), Trial: trial}] {
+						continue
+					}
+					if ctx.Err() != nil {
+						return
+					}
+					p.begin(s)
+					results <- measure(ctx, rt, exp, record, s, trial, outPutDir)
+				}
 			}
-			firefoxHARContainerName := strings.Join([]string{"firefox", generateMeasurementID(record, *cache, *dane)}, "-")
-			HARDockerOpts := newDockerRunOptions(firefoxHARImageName, network, firefoxHARContainerName)
-			HAROpts := newFireFoxHAROptions("https://"+record.Domain, resolverIP, proxyHost, *dane)
-			pcapSuffix := "-" + generateMeasurementID(record, *cache, *dane)
-			pcapOpts := newPcapOptions(outPutDir, pcapSuffix)
+			logger.Info(fmt.Sprintf("finish measuring page load time for %d: %s", index+1, record.TargetURL()))
 
-			DANEValidationResultSuffix := "-" + generateMeasurementID(record, *cache, *dane)
-			DANEValidationResultOpts := NewDANEValidationResultOpts(outPutDir, DANEValidationResultSuffix)
+		}(index, record)
+	}
+}
 
-			opts := newCommandOptions(letsdaneDockerOpts, letsdaneOpts, HARDockerOpts, HAROpts, unboundDockerOpts, pcapOpts, DANEValidationResultOpts, *cache)
+// roundResult is the outcome of the measurements of a round.
+type roundResult struct {
+	// success and failed are the measurement IDs, and failed ones are followed by the failure reason.
+	success, failed []string
+	failedKeys      map[journalKey]bool
+}
 
-			// collect HAR file
-			content, err := collectHAR(opts)
-			if err != nil {
-				logger.Error(fmt.Sprintf("Failed to collect HAR file: %s", err))
+// measureRound runs the measurements which are not finished, here or by the workers, and journals their results.
+// attempts are the attempts of the measurements retried by -retry-from, which are counted up and journaled.
+// stop stops the coordinator, which tells the workers that there are no more measurements until it is called.
+func measureRound(ctx context.Context, rt ContainerRuntime, p *progress, exp *experiment, subsetDomainList []utils.Record, scenarios []scenario, finished map[journalKey]bool, opts runOptions, measurementJournal *journal, attempts map[journalKey]int) (r roundResult, stop func(), err error) {
+	trials := exp.Trials
+	for _, record := range subsetDomainList {
+		for trial := 1; trial <= trials; trial++ {
+			for _, s := range scenarios {
+				if !finished[journalKey{Domain: record.Slug(), Scenario: s.String(), Trial: trial}] {
+					p.plan(s, 1)
+				}
 			}
+		}
+	}
 
-			outPutFileName := strings.Join([]string{generateMeasurementID(record, *cache, *dane), "har"}, ".") // example.com-with-cache-with-dane.har
+	stop = func() {}
+	// the coordinator retries the failed measurements itself, so that the workers keep running until all retries are done.
+	retries := 0
+	if opts.CoordinatorAddr != "" && opts.Retry != nil {
+		retries = opts.Retry.Budget - 1
+	}
+	results := make(chan measurementResult, len(subsetDomainList)*len(scenarios)*trials*(retries+1))
+	if opts.CoordinatorAddr != "" {
+		// the measurements are run by the workers, which upload their results to the result sub directory.
+		c := newCoordinator(exp, p, subsetDomainList, scenarios, finished, opts.LeaseDuration, retries, results)
+		stop, err = c.serve(ctx, opts.CoordinatorAddr)
+		if err != nil {
+			return r, nil, err
+		}
+	} else {
+		go measureLocally(ctx, rt, p, exp, subsetDomainList, scenarios, finished, results)
+	}
+
+	r.failedKeys = make(map[journalKey]bool)
+	// a measurement retried by the coordinator counts as failed only if its last attempt failed.
+	failures := make(map[journalKey]string)
+	var failureOrder []journalKey
+	for result := range results {
+		// an aborted measurement is not journaled, so that it is measured again with -resume.
+		if result.Aborted {
+			logger.Info(fmt.Sprintf("aborted: %s", result.MeasurementID))
+			p.abort(result.Scenario)
+			continue
+		}
+
+		entry := journalEntry{
+			Domain:        result.Domain,
+			Scenario:      result.Scenario.String(),
+			Cache:         result.Scenario.Cache,
+			Dane:          result.Scenario.DANE,
+			WithoutDNSSEC: result.Scenario.WithoutDNSSEC,
+			Resolver:      string(result.Scenario.Resolver),
+			RepeatVisit:   result.Scenario.RepeatVisit,
+			Impairment:    result.Scenario.Impairment,
+			Trial:         result.Trial,
+			HostSaturated: result.HostSaturated,
+		}
+		key := entry.key()
+		if attempt, ok := attempts[key]; ok {
+			entry.Attempt = attempt + 1
+			attempts[key] = entry.Attempt
+		}
 
-			harContent := HARFileContent{
-				Directory: outPutDir,
-				FileName:  outPutFileName,
-				Content:   content,
-				Domain:    record.Domain,
+		p.finish(result.Scenario, result.FailureReason, time.Duration(result.PageLoadTime)*time.Millisecond)
+		if result.FailureReason == failureNone {
+			r.success = append(r.success, result.MeasurementID)
+			delete(r.failedKeys, key)
+			entry.PageLoadTime = strconv.Itoa(result.PageLoadTime)
+		} else {
+			if _, ok := failures[key]; !ok {
+				failureOrder = append(failureOrder, key)
 			}
+			failures[key] = result.MeasurementID + " (" + string(result.FailureReason) + ")"
+			r.failedKeys[key] = true
+			entry.FailureReason = string(result.FailureReason)
+		}
+
+		entry.FinishedAt = time.Now()
+		if err := measurementJournal.append(entry); err != nil {
+			logger.Error(fmt.Sprintf("Failed to write journal: %s", err))
+		}
+	}
+	for _, key := range failureOrder {
+		if r.failedKeys[key] {
+			r.failed = append(r.failed, failures[key])
+		}
+	}
+	return r, stop, nil
+}
 
-			harContentChan <- harContent
-			logger.Info(fmt.Sprintf("finish measuring page load time for %d: %s", index+1, record.Domain))
+// runOptions are how run runs the experiment, which are not part of the experiment.
+type runOptions struct {
+	// Resume skips the measurements finished in the journal.
+	Resume bool
+	// CoordinatorAddr is the address to hand out the measurements to the workers (pageloadtime worker).
+	// If empty, the measurements are run here.
+	CoordinatorAddr string
+	// LeaseDuration is how long a worker holds a measurement without renewing the lease before it is handed out again.
+	LeaseDuration time.Duration
+	// Retry measures only the failed measurements of a previous run in its result sub directory. See -retry-from.
+	Retry *retryPlan
+}
 
-		}(index, record)
+// run measures the page load time of the experiment and writes the results into its result sub directory.
+// The progress of the measurements is reported to p. If store is not nil, the result sub directory is uploaded to it at the end.
+func run(ctx context.Context, rt ContainerRuntime, p *progress, store storage.ResultStore, exp *experiment, opts runOptions, start time.Time) (err error) {
+	scenarios, err := exp.scenarioList()
+	if err != nil {
+		return err
 	}
+	var subsetDomainList []utils.Record
+	if opts.Retry != nil {
+		// the pages and scenarios are the ones of the retried run.
+		scenarios, subsetDomainList = opts.Retry.Scenarios, opts.Retry.Domains
+	} else {
+		subsetDomainList, _, err = subsetDomains(exp)
+		if err != nil {
+			return err
+		}
+	}
+	trials := exp.Trials
 
-	go func() {
-		defer close(harContentChan)
-		wg.Wait()
-	}()
+	logger.Info(fmt.Sprintf("measurement started at %s", start.Format("2006-01-02-15-04-05")))
+	logger.Info(fmt.Sprintf("scenarios: %s, trials: %d", strings.Join(scenarioNames(scenarios), ", "), trials))
 
-	successResult := make([]string, 0)
-	failedResult := make([]string, 0)
-	domainPageLoadTimeMap := make(map[string]string)
-	// write HAR file
-	for content := range harContentChan {
-		if len(content.Content) == 0 {
-			logger.Info(fmt.Sprintf("Har file is empty: %s", content.FileName))
-			failedResult = append(failedResult, content.Domain)
-			domainPageLoadTimeMap[content.Domain] = ""
-			continue
+	// create directory for this measurement
+	resultSubDirectoryPath := exp.resultSubDirectoryPath()
+
+	if err := os.MkdirAll(resultSubDirectoryPath, 0755); err != nil {
+		if !os.IsExist(err) {
+			return err
 		}
+	}
 
-		var harLog har.Log
-		if err := json.Unmarshal(content.Content, &harLog); err != nil {
-			logger.Error(fmt.Sprintf("Failed to unmarshal HAR file: %s", err))
-			failedResult = append(failedResult, content.Domain)
-			domainPageLoadTimeMap[content.Domain] = ""
-			continue
+	// the journal records the outcome of each measurement as it happens, so that an interrupted run can be resumed.
+	journalPath := filepath.Join(resultSubDirectoryPath, journalFileName)
+	finished := make(map[journalKey]bool)
+	if opts.Resume {
+		finished, err = resumedMeasurements(journalPath)
+		if err != nil {
+			return err
 		}
-		har := har.Har{
-			Log: harLog,
+	}
+	measurementJournal, err := openJournal(journalPath)
+	if err != nil {
+		return err
+	}
+	defer measurementJournal.Close()
+	attempts := make(map[journalKey]int)
+	if opts.Retry != nil {
+		if err := opts.Retry.seedJournal(journalPath, measurementJournal); err != nil {
+			return fmt.Errorf("failed to write journal: %w", err)
 		}
-		// drop each response content because it is too large size
-		har.DropEachResponseContent()
+		finished = opts.Retry.finished()
+		attempts = opts.Retry.attempts()
+		logger.Info(fmt.Sprintf("retry %d failed measurements of %s up to %d times", len(attempts), opts.Retry.Path, opts.Retry.Budget))
+	}
 
-		if !har.ValidPageLoadTime() {
-			logger.Warn(fmt.Sprintf("Fail to get pageload time from HAR file: %s", content.FileName))
-			failedResult = append(failedResult, content.Domain)
-			domainPageLoadTimeMap[content.Domain] = ""
-			continue
+	// the manifest is written before the measurement, so that an interrupted run can be told from a finished one.
+	manifest := newManifest(ctx, rt, exp, scenarios, start)
+	if err := utils.WriteManifest(manifestPath(exp), manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	defer func() {
+		if err == nil {
+			return
 		}
+		finishManifest(&manifest, p.status(time.Now()), len(subsetDomainList), err, time.Now())
+		if writeErr := utils.WriteManifest(manifestPath(exp), manifest); writeErr != nil {
+			logger.Error(fmt.Sprintf("Failed to write manifest: %s", writeErr))
+		}
+	}()
 
-		logger.Info(fmt.Sprintf("success to get pageload time from HAR file: %s", content.FileName))
-		successResult = append(successResult, strings.TrimSuffix(content.FileName, filepath.Ext(content.FileName)))
-		domainPageLoadTimeMap[content.Domain] = strconv.Itoa(har.OnLoadOfFirstPage())
-
-		// export as har file
-		if err := har.Save(filepath.Join(content.Directory, content.FileName)); err != nil {
-			logger.Error(fmt.Sprintf("Failed to save HAR file as har: %s", err))
+	var successResult, failedResult []string
+	for round := 1; ; round++ {
+		r, stop, err := measureRound(ctx, rt, p, exp, subsetDomainList, scenarios, finished, opts, measurementJournal, attempts)
+		if err != nil {
+			return err
+		}
+		// the workers polling for more measurements are told that there are no more until run returns.
+		// There is only one round with the coordinator, which retries the failed measurements itself.
+		defer stop()
+		successResult = append(successResult, r.success...)
+		if opts.Retry == nil || opts.CoordinatorAddr != "" || round >= opts.Retry.Budget || len(r.failedKeys) == 0 || ctx.Err() != nil {
+			failedResult = append(failedResult, r.failed...)
+			break
 		}
-		// save as csv
-		csvHar := har.ConvertCSVFormat()
-		if err := csvHar.SaveAsCSV(filepath.Join(content.Directory, strings.Join([]string{strings.TrimSuffix(content.FileName, filepath.Ext(content.FileName)), "csv"}, "."))); err != nil {
-			logger.Error(fmt.Sprintf("Failed to save HAR file as csv: %s", err))
+		// only the measurements which failed again are measured in the next round.
+		logger.Info(fmt.Sprintf("retry %d measurements which failed again: round %d of %d", len(r.failedKeys), round+1, opts.Retry.Budget))
+		finished = make(map[journalKey]bool)
+		for _, record := range subsetDomainList {
+			for trial := 1; trial <= trials; trial++ {
+				for _, s := range scenarios {
+					key := journalKey{Domain: record.Slug(), Scenario: s.String(), Trial: trial}
+					finished[key] = !r.failedKeys[key]
+				}
+			}
 		}
 	}
 
+	// rebuild the result from the journal, which also contains the measurements finished before resuming.
+	entries, err := readJournal(journalPath)
+	if err != nil {
+		return err
+	}
+	pageLoadTimeRecords := journalPageLoadTimeRecords(entries, subsetDomainList, scenarios, trials)
+	sortPageLoadTimeRecords(pageLoadTimeRecords, scenarios)
+
 	// write page load time into csv
-	pageLoadCSVFile := filepath.Join(resultSubDirectoryPath, "pageloadtime"+measurementPatternSuffix(*cache, *dane)+".csv")
-	if err := utils.WritePageLoadTimeCSV(pageLoadCSVFile, domainPageLoadTimeMap, *cache, *dane); err != nil {
-		logger.Error(fmt.Sprintf("Failed to write page load time into csv: %s", err))
+	for _, s := range scenarios {
+		records := scenarioPageLoadTimeRecords(pageLoadTimeRecords, s)
+		pageLoadCSVFile := filepath.Join(resultSubDirectoryPath, "pageloadtime-"+s.String()+".csv")
+		if err := utils.WritePageLoadTimeRecordsCSV(pageLoadCSVFile, records); err != nil {
+			logger.Error(fmt.Sprintf("Failed to write page load time into csv: %s", err))
+		}
+
+		if trials > 1 {
+			summaryCSVFile := filepath.Join(resultSubDirectoryPath, "pageloadtime-"+s.String()+"-summary.csv")
+			if err := utils.WritePageLoadTimeSummaryCSV(summaryCSVFile, summarizePageLoadTime(records)); err != nil {
+				logger.Error(fmt.Sprintf("Failed to write summary of page load time into csv: %s", err))
+			}
+		}
+	}
+	// write page load time of all scenarios into one table
+	if len(scenarios) > 1 {
+		pageLoadCSVFile := filepath.Join(resultSubDirectoryPath, "pageloadtime-scenarios.csv")
+		if err := utils.WritePageLoadTimeRecordsCSV(pageLoadCSVFile, pageLoadTimeRecords); err != nil {
+			logger.Error(fmt.Sprintf("Failed to write page load time into csv: %s", err))
+		}
 	}
 
 	logger.Info("finish measuring page load time")
@@ -733,7 +1364,31 @@ func main() {
 		logger.Info(fmt.Sprintf("failed: %s", result))
 	}
 
-	logger.Info(fmt.Sprintf("all: %d success: %d, failed: %d", len(subsetDomainList), len(successResult), len(failedResult)))
+	logger.Info(fmt.Sprintf("all: %d success: %d, failed: %d, skipped: %d", len(successResult)+len(failedResult), len(successResult), len(failedResult), len(pageLoadTimeRecords)-len(successResult)-len(failedResult)))
+
+	// the results of the finished measurements are written above, but the interrupted run is neither finished nor uploaded.
+	if err := ctx.Err(); err != nil {
+		if opts.Retry != nil {
+			return fmt.Errorf("measurement was interrupted, run again with -retry-from %s to continue: %w", opts.Retry.Path, err)
+		}
+		return fmt.Errorf("measurement was interrupted, run again with -subdirname %s -resume to continue: %w", exp.Output.SubDirName, err)
+	}
+
+	// the manifest is finished before uploading, so that the analyzers find the uploaded results as finished.
+	finishManifest(&manifest, p.status(time.Now()), len(subsetDomainList), nil, time.Now())
+	if err := utils.WriteManifest(manifestPath(exp), manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if store != nil {
+		logger.Info(fmt.Sprintf("upload results to %s", exp.Output.Store.URL))
+		uploaded, err := storage.UploadDir(ctx, store, exp.Output.SubDirName, resultSubDirectoryPath)
+		if err != nil {
+			return fmt.Errorf("failed to upload results: %w", err)
+		}
+		logger.Info(fmt.Sprintf("uploaded %d files to %s", uploaded, exp.Output.Store.URL))
+	}
 
 	logger.Info(fmt.Sprintf("elapsed time: %s", time.Since(start).String()))
+	return nil
 }
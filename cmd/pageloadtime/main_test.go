@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+func TestMain(m *testing.M) {
+	logger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+func TestCollectHAR(t *testing.T) {
+	tests := []struct {
+		name      string
+		cache     bool
+		dane      bool
+		wantCalls []string
+		wantFiles []string
+	}{
+		{
+			name:  "without cache without dane",
+			cache: false,
+			dane:  false,
+			wantCalls: []string{
+				"CreateNetwork network-example.com-without-cache-without-dane",
+				"StartContainer unbound-example.com-without-cache-without-dane",
+				"ContainerIP unbound-example.com-without-cache-without-dane",
+				"ExecDetached unbound-example.com-without-cache-without-dane",
+				"RunContainer firefox-example.com-without-cache-without-dane",
+				"CopyFromContainer firefox-example.com-without-cache-without-dane",
+				"RemoveContainer firefox-example.com-without-cache-without-dane",
+				"CopyFromContainer unbound-example.com-without-cache-without-dane",
+				"StopContainer unbound-example.com-without-cache-without-dane",
+				"RemoveNetwork network-example.com-without-cache-without-dane",
+			},
+			wantFiles: []string{
+				"firefox-example.com-without-cache-without-dane.pcap",
+				"resources-example.com-without-cache-without-dane-summary.csv",
+				"resources-example.com-without-cache-without-dane.csv",
+				"unbound-example.com-without-cache-without-dane.pcap",
+			},
+		},
+		{
+			name:  "with cache with dane",
+			cache: true,
+			dane:  true,
+			wantCalls: []string{
+				"CreateNetwork network-example.com-with-cache-with-dane",
+				"StartContainer unbound-example.com-with-cache-with-dane",
+				"ContainerIP unbound-example.com-with-cache-with-dane",
+				"StartContainer letsdane-example.com-with-cache-with-dane-fill-cache",
+				"RunContainer firefox-example.com-with-cache-with-dane-fill-cache",
+				"ExecDetached unbound-example.com-with-cache-with-dane",
+				"StartContainer letsdane-example.com-with-cache-with-dane",
+				"ExecDetached letsdane-example.com-with-cache-with-dane",
+				"RunContainer firefox-example.com-with-cache-with-dane",
+				"CopyFromContainer firefox-example.com-with-cache-with-dane",
+				"RemoveContainer firefox-example.com-with-cache-with-dane",
+				"CopyFromContainer letsdane-example.com-with-cache-with-dane",
+				"CopyFromContainer letsdane-example.com-with-cache-with-dane",
+				"StopContainer letsdane-example.com-with-cache-with-dane",
+				"RemoveContainer letsdane-example.com-with-cache-with-dane",
+				"CopyFromContainer unbound-example.com-with-cache-with-dane",
+				"StopContainer letsdane-example.com-with-cache-with-dane-fill-cache",
+				"RemoveContainer letsdane-example.com-with-cache-with-dane-fill-cache",
+				"StopContainer unbound-example.com-with-cache-with-dane",
+				"RemoveNetwork network-example.com-with-cache-with-dane",
+			},
+			wantFiles: []string{
+				"firefox-example.com-with-cache-with-dane.pcap",
+				"letsdane-example.com-with-cache-with-dane.csv",
+				"letsdane-example.com-with-cache-with-dane.pcap",
+				"resources-example.com-with-cache-with-dane-summary.csv",
+				"resources-example.com-with-cache-with-dane.csv",
+				"unbound-example.com-with-cache-with-dane.pcap",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			exp := defaultExperiment(time.Now())
+			rt := newFakeRuntime()
+			rt.setOutput(firefoxHARImageName, []byte(`{"log":{}}`))
+
+			record := utils.Record{Domain: "example.com"}
+			s := scenario{Cache: tt.cache, DANE: tt.dane}
+			opts := measurementCommandOptions(exp, record, s, trialMeasurementID(record, s, 1, 1), dir)
+			got, err := collectHAR(context.Background(), rt, opts)
+			if err != nil {
+				t.Fatalf("collectHAR() error = %v", err)
+			}
+			if string(got) != `{"log":{}}` {
+				t.Errorf("collectHAR() = %q, want HAR of firefox", got)
+			}
+			if calls := rt.Calls(); !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", calls, tt.wantCalls)
+			}
+			if leftovers := rt.Leftovers(); len(leftovers) != 0 {
+				t.Errorf("leftovers = %q, want none", leftovers)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			for _, entry := range entries {
+				files = append(files, entry.Name())
+			}
+			if !slices.Equal(files, tt.wantFiles) {
+				t.Errorf("files = %q, want %q", files, tt.wantFiles)
+			}
+			if opts.HAROpts.ResolverIP == "" {
+				t.Error("resolver IP is not set from the unbound container")
+			}
+		})
+	}
+}
+
+func TestCollectHARCleanupOnFailure(t *testing.T) {
+	errFail := errors.New("fail")
+	tests := []struct {
+		name   string
+		method string
+		target string
+	}{
+		{name: "unbound does not start", method: "StartContainer", target: "unbound-example.com-without-cache-with-dane"},
+		{name: "letsdane does not start", method: "StartContainer", target: "letsdane-example.com-without-cache-with-dane"},
+		{name: "tcpdump does not start", method: "ExecDetached", target: "letsdane-example.com-without-cache-with-dane"},
+		{name: "firefox fails", method: "RunContainer", target: "firefox-example.com-without-cache-with-dane"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := defaultExperiment(time.Now())
+			rt := newFakeRuntime()
+			rt.failOn(tt.method, tt.target, errFail)
+
+			record := utils.Record{Domain: "example.com"}
+			s := scenario{Cache: false, DANE: true}
+			opts := measurementCommandOptions(exp, record, s, trialMeasurementID(record, s, 1, 1), t.TempDir())
+			if _, err := collectHAR(context.Background(), rt, opts); !errors.Is(err, errFail) {
+				t.Fatalf("collectHAR() error = %v, want %v", err, errFail)
+			}
+			if leftovers := rt.Leftovers(); len(leftovers) != 0 {
+				t.Errorf("leftovers = %q, want none", leftovers)
+			}
+		})
+	}
+}
+
+func TestCollectHARAborted(t *testing.T) {
+	for _, cache := range []bool{false, true} {
+		exp := defaultExperiment(time.Now())
+		rt := newFakeRuntime()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// the signal arrives while Firefox loads the page (or fills the cache).
+		rt.onRun = func(spec ContainerSpec) {
+			cancel()
+		}
+
+		record := utils.Record{Domain: "example.com"}
+		s := scenario{Cache: cache, DANE: true}
+		opts := measurementCommandOptions(exp, record, s, trialMeasurementID(record, s, 1, 1), t.TempDir())
+		if _, err := collectHAR(ctx, rt, opts); !errors.Is(err, context.Canceled) {
+			t.Fatalf("collectHAR(cache=%t) error = %v, want context.Canceled", cache, err)
+		}
+		if leftovers := rt.Leftovers(); len(leftovers) != 0 {
+			t.Errorf("collectHAR(cache=%t) leftovers = %q, want none", cache, leftovers)
+		}
+	}
+}
+
+func TestMeasurementCommandOptionsDeepLink(t *testing.T) {
+	exp := defaultExperiment(time.Now())
+	record := utils.Record{Domain: "example.com", URL: "https://example.com/news/"}
+	s := scenario{Cache: true, DANE: true}
+	opts := measurementCommandOptions(exp, record, s, trialMeasurementID(record, s, 1, 1), t.TempDir())
+
+	if opts.HAROpts.Website != "https://example.com/news/" {
+		t.Errorf("website = %s, want https://example.com/news/", opts.HAROpts.Website)
+	}
+	if opts.HARDockerRunOpts.ContainerName != "firefox-example.com_news-with-cache-with-dane" {
+		t.Errorf("container = %s, want firefox-example.com_news-with-cache-with-dane", opts.HARDockerRunOpts.ContainerName)
+	}
+	if !measurementResourceName.MatchString(opts.HARDockerRunOpts.ContainerName) {
+		t.Errorf("gc does not match %s", opts.HARDockerRunOpts.ContainerName)
+	}
+}
+
+func TestMeasurementCommandOptions(t *testing.T) {
+	dir := filepath.Join("result", "example.com")
+	exp := defaultExperiment(time.Now())
+	record := utils.Record{Domain: "example.com"}
+	withCacheWithDane := scenario{Cache: true, DANE: true}
+	opts := measurementCommandOptions(exp, record, withCacheWithDane, trialMeasurementID(record, withCacheWithDane, 1, 1), dir)
+
+	if opts.UnboundDockerRunOpts.ImageName != unboundImageName || opts.UnboundConfig != defaultUnboundWithCache {
+		t.Errorf("unbound image = %s, config = %+v, want %s with cache", opts.UnboundDockerRunOpts.ImageName, opts.UnboundConfig, unboundImageName)
+	}
+	if opts.HAROpts.ProxyHost != opts.LetsdaneDockerRunOpts.ContainerName {
+		t.Errorf("proxy host = %s, want %s", opts.HAROpts.ProxyHost, opts.LetsdaneDockerRunOpts.ContainerName)
+	}
+	if opts.HAROpts.Website != "https://example.com" {
+		t.Errorf("website = %s, want https://example.com", opts.HAROpts.Website)
+	}
+	if opts.PcapOpts.PcapSuffix != "-example.com-with-cache-with-dane" {
+		t.Errorf("pcap suffix = %s, want -example.com-with-cache-with-dane", opts.PcapOpts.PcapSuffix)
+	}
+
+	if opts.UnboundDockerRunOpts.Netem != "" || opts.HARDockerRunOpts.Netem != "" {
+		t.Errorf("netem = %q, want none without impairment", opts.UnboundDockerRunOpts.Netem)
+	}
+
+	impaired := scenario{Cache: true, DANE: true, Impairment: "rtt50"}
+	impairedOpts := measurementCommandOptions(exp, record, impaired, trialMeasurementID(record, impaired, 1, 1), dir)
+	if impairedOpts.HARDockerRunOpts.NetWork != "network-example.com-with-cache-with-dane-rtt50" {
+		t.Errorf("network = %s, want network-example.com-with-cache-with-dane-rtt50", impairedOpts.HARDockerRunOpts.NetWork)
+	}
+	for _, o := range []*dockerRunOptions{impairedOpts.UnboundDockerRunOpts, impairedOpts.LetsdaneDockerRunOpts, impairedOpts.HARDockerRunOpts} {
+		if o.Netem != "delay 50000us" {
+			t.Errorf("netem of %s = %q, want delay 50000us", o.ContainerName, o.Netem)
+		}
+	}
+
+	trialOpts := measurementCommandOptions(exp, record, withCacheWithDane, trialMeasurementID(record, withCacheWithDane, 2, 3), dir)
+	if trialOpts.HARDockerRunOpts.ContainerName != "firefox-example.com-with-cache-with-dane-trial-2" {
+		t.Errorf("firefox container = %s, want firefox-example.com-with-cache-with-dane-trial-2", trialOpts.HARDockerRunOpts.ContainerName)
+	}
+
+	exp.Images.Letsdane = "letsdane:test"
+	exp.Letsdane.Args = []string{"-verbose"}
+	exp.Firefox.TimeoutSeconds = 60
+	customOpts := measurementCommandOptions(exp, record, withCacheWithDane, trialMeasurementID(record, withCacheWithDane, 1, 1), dir)
+	if customOpts.LetsdaneDockerRunOpts.ImageName != "letsdane:test" {
+		t.Errorf("letsdane image = %s, want letsdane:test", customOpts.LetsdaneDockerRunOpts.ImageName)
+	}
+	if !slices.Equal(customOpts.LetsdaneOptions.Args, []string{"-verbose"}) {
+		t.Errorf("letsdane args = %q, want [-verbose]", customOpts.LetsdaneOptions.Args)
+	}
+	if cmd := fireFoxHARCmd(customOpts.HAROpts, customOpts.HAROpts.ProxyHost); !slices.Equal(cmd[len(cmd)-2:], []string{"--timeout", "60"}) {
+		t.Errorf("firefox cmd = %q, want --timeout 60", cmd)
+	}
+
+	withoutCacheWithoutDane := scenario{Cache: false, DANE: false}
+	withoutDane := measurementCommandOptions(exp, record, withoutCacheWithoutDane, trialMeasurementID(record, withoutCacheWithoutDane, 1, 1), dir)
+	if withoutDane.LetsdaneDockerRunOpts != nil {
+		t.Error("letsdane options should be nil without DANE")
+	}
+	if withoutDane.UnboundDockerRunOpts.ImageName != unboundImageName || withoutDane.UnboundConfig != defaultUnboundWithoutCache {
+		t.Errorf("unbound image = %s, config = %+v, want %s without cache", withoutDane.UnboundDockerRunOpts.ImageName, withoutDane.UnboundConfig, unboundImageName)
+	}
+
+	withoutDNSSEC := scenario{Cache: true, DANE: true, WithoutDNSSEC: true}
+	withoutDNSSECOpts := measurementCommandOptions(exp, record, withoutDNSSEC, trialMeasurementID(record, withoutDNSSEC, 1, 1), dir)
+	if withoutDNSSECOpts.UnboundConfig.DNSSECValidation {
+		t.Errorf("unbound config = %+v, want DNSSEC validation disabled", withoutDNSSECOpts.UnboundConfig)
+	}
+	if !slices.Equal(withoutDNSSECOpts.LetsdaneOptions.Args, []string{"-verbose", "-skip-dnssec"}) {
+		t.Errorf("letsdane args = %q, want [-verbose -skip-dnssec]", withoutDNSSECOpts.LetsdaneOptions.Args)
+	}
+	if !slices.Contains(withoutDNSSECOpts.LetsdaneOptions.FillCacheArgs, "-skip-dnssec") {
+		t.Errorf("letsdane fill cache args = %q, want -skip-dnssec", withoutDNSSECOpts.LetsdaneOptions.FillCacheArgs)
+	}
+	if slices.Contains(exp.Letsdane.FillCacheArgs, "-skip-dnssec") {
+		t.Errorf("letsdane fill cache args of the experiment are modified: %q", exp.Letsdane.FillCacheArgs)
+	}
+	if withoutDNSSECOpts.PcapOpts.PcapSuffix != "-example.com-with-cache-with-dane-without-dnssec" {
+		t.Errorf("pcap suffix = %s, want -example.com-with-cache-with-dane-without-dnssec", withoutDNSSECOpts.PcapOpts.PcapSuffix)
+	}
+	if !measurementResourceName.MatchString(withoutDNSSECOpts.UnboundDockerRunOpts.ContainerName) {
+		t.Errorf("gc does not match %s", withoutDNSSECOpts.UnboundDockerRunOpts.ContainerName)
+	}
+
+	recursive := scenario{Cache: true, DANE: true, Resolver: resolverRecursive, Impairment: "rtt50"}
+	recursiveOpts := measurementCommandOptions(exp, record, recursive, trialMeasurementID(record, recursive, 2, 3), dir)
+	if recursiveOpts.LetsdaneDockerRunOpts.ContainerName != "letsdane-example.com-with-cache-with-dane-recursive-resolver-rtt50-trial-2" {
+		t.Errorf("letsdane container = %s, want letsdane-example.com-with-cache-with-dane-recursive-resolver-rtt50-trial-2", recursiveOpts.LetsdaneDockerRunOpts.ContainerName)
+	}
+	if slices.Contains(recursiveOpts.LetsdaneOptions.Args, "-skip-dnssec") {
+		t.Errorf("letsdane args = %q, want without -skip-dnssec", recursiveOpts.LetsdaneOptions.Args)
+	}
+	if !measurementResourceName.MatchString(recursiveOpts.LetsdaneDockerRunOpts.ContainerName + "-fill-cache") {
+		t.Errorf("gc does not match %s-fill-cache", recursiveOpts.LetsdaneDockerRunOpts.ContainerName)
+	}
+}
+
+func TestCollectHARRepeatVisit(t *testing.T) {
+	exp := defaultExperiment(time.Now())
+	rt := newFakeRuntime()
+	rt.setOutput(firefoxHARImageName, []byte(`{"log":{}}`))
+	var mu sync.Mutex
+	cmds := make(map[string][]string)
+	rt.onRun = func(spec ContainerSpec) {
+		mu.Lock()
+		defer mu.Unlock()
+		cmds[spec.Name] = spec.Cmd
+	}
+
+	record := utils.Record{Domain: "example.com"}
+	s := scenario{Cache: true, DANE: true, RepeatVisit: true}
+	opts := measurementCommandOptions(exp, record, s, trialMeasurementID(record, s, 1, 1), t.TempDir())
+	if _, err := collectHAR(context.Background(), rt, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the measured firefox loads the page twice. the one which fills the cache of unbound loads it once.
+	if cmd := cmds["firefox-example.com-with-cache-with-dane-repeat-visit"]; !slices.Contains(cmd, "--repeat_visit") {
+		t.Errorf("firefox cmd = %q, want --repeat_visit", cmd)
+	}
+	if cmd := cmds["firefox-example.com-with-cache-with-dane-repeat-visit-fill-cache"]; cmd == nil || slices.Contains(cmd, "--repeat_visit") {
+		t.Errorf("firefox cmd to fill the cache = %q, want without --repeat_visit", cmd)
+	}
+}
+
+func TestSortPageLoadTimeRecords(t *testing.T) {
+	scenarios := []scenario{{Cache: false, DANE: false}, {Cache: true, DANE: true}}
+	records := []utils.PageLoadTimeRecord{
+		{Domain: "b.example", PageLoadTime: "250", Cache: true, Dane: true, Trial: 1},
+		{Domain: "a.example", PageLoadTime: "", Cache: true, Dane: true, Trial: 1},
+		{Domain: "b.example", PageLoadTime: "200", Cache: false, Dane: false, Trial: 2},
+		{Domain: "b.example", PageLoadTime: "210", Cache: false, Dane: false, Trial: 1},
+		{Domain: "a.example", PageLoadTime: "100", Cache: false, Dane: false, Trial: 1},
+	}
+
+	sortPageLoadTimeRecords(records, scenarios)
+	want := []utils.PageLoadTimeRecord{
+		{Domain: "a.example", PageLoadTime: "100", Cache: false, Dane: false, Trial: 1},
+		{Domain: "a.example", PageLoadTime: "", Cache: true, Dane: true, Trial: 1},
+		{Domain: "b.example", PageLoadTime: "210", Cache: false, Dane: false, Trial: 1},
+		{Domain: "b.example", PageLoadTime: "200", Cache: false, Dane: false, Trial: 2},
+		{Domain: "b.example", PageLoadTime: "250", Cache: true, Dane: true, Trial: 1},
+	}
+	if !slices.Equal(records, want) {
+		t.Errorf("sortPageLoadTimeRecords() = %+v, want %+v", records, want)
+	}
+
+	if got := scenarioPageLoadTimeRecords(records, scenarios[1]); !slices.Equal(got, []utils.PageLoadTimeRecord{want[1], want[4]}) {
+		t.Errorf("scenarioPageLoadTimeRecords() = %+v", got)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+// newManifest describes the run before the measurement starts. The images are inspected here,
+// so that the manifest records the image which was actually used even if the tag is updated later.
+func newManifest(ctx context.Context, rt ContainerRuntime, exp *experiment, scenarios []scenario, start time.Time) utils.Manifest {
+	m := utils.Manifest{
+		MeasurementID: exp.Output.SubDirName,
+		Status:        utils.ManifestStatusRunning,
+		StartedAt:     start,
+		Args:          os.Args[1:],
+		Host:          manifestHost(),
+		Build:         manifestBuild(),
+		Scenarios:     scenarioNames(scenarios),
+		Images:        make(map[string]utils.ManifestImage),
+	}
+
+	buf, err := json.Marshal(exp)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to record experiment in manifest: %s", err))
+	}
+	m.Experiment = buf
+
+	for role, image := range experimentImagesOf(exp, scenarios) {
+		m.Images[role] = manifestImage(ctx, rt, image)
+	}
+	m.LetsdaneResolvers = letsdaneResolversOf(exp, scenarios)
+	return m
+}
+
+// letsdaneResolversOf returns the resolver of letsdane in each scenario with DANE, which is decided by letsdane.args
+// for the scenarios without a resolver in the name.
+func letsdaneResolversOf(exp *experiment, scenarios []scenario) map[string]string {
+	resolvers := make(map[string]string)
+	for _, s := range scenarios {
+		if s.DANE {
+			args, _ := exp.letsdaneArgs(s)
+			resolvers[s.String()] = string(letsdaneResolver(args))
+		}
+	}
+	return resolvers
+}
+
+// experimentImagesOf returns the images used by the scenarios by their role in experimentImages.
+func experimentImagesOf(exp *experiment, scenarios []scenario) map[string]string {
+	images := make(map[string]string)
+	if exp.Probe != probeHTTP {
+		images["firefox"] = exp.Images.Firefox
+	}
+	images["unbound"] = exp.Images.Unbound
+	for _, s := range scenarios {
+		if s.DANE {
+			images["letsdane"] = exp.Images.Letsdane
+		}
+	}
+	return images
+}
+
+func manifestImage(ctx context.Context, rt ContainerRuntime, image string) utils.ManifestImage {
+	info, err := rt.InspectImage(ctx, image)
+	if err != nil {
+		// the image may be pulled when the container starts, so it is not an error of the run.
+		logger.Warn(fmt.Sprintf("Failed to inspect image %s: %s", image, err))
+		return utils.ManifestImage{Name: image, Error: err.Error()}
+	}
+	return utils.ManifestImage{
+		Name:        image,
+		ID:          info.ID,
+		RepoDigests: info.RepoDigests,
+		Created:     info.Created,
+		Labels:      info.Labels,
+	}
+}
+
+func manifestHost() utils.ManifestHost {
+	host := utils.ManifestHost{
+		OS:     runtime.GOOS,
+		Arch:   runtime.GOARCH,
+		NumCPU: runtime.NumCPU(),
+		Region: os.Getenv("AWS_REGION"),
+	}
+	if host.Region == "" {
+		host.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		host.Hostname = hostname
+	}
+	return host
+}
+
+func manifestBuild() utils.ManifestBuild {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return utils.ManifestBuild{GoVersion: runtime.Version()}
+	}
+	build := utils.ManifestBuild{
+		GoVersion: info.GoVersion,
+		Path:      info.Main.Path,
+		Version:   info.Main.Version,
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.VCSRevision = setting.Value
+		case "vcs.time":
+			build.VCSTime = setting.Value
+		case "vcs.modified":
+			build.VCSModified = setting.Value == "true"
+		}
+	}
+	return build
+}
+
+// finishManifest records the result of the run. runErr is nil if the run finished.
+func finishManifest(m *utils.Manifest, status progressStatus, domains int, runErr error, now time.Time) {
+	m.FinishedAt = &now
+	m.Status = utils.ManifestStatusFinished
+	if runErr != nil {
+		m.Status = utils.ManifestStatusFailed
+		if errors.Is(runErr, context.Canceled) {
+			m.Status = utils.ManifestStatusInterrupted
+		}
+		m.Error = runErr.Error()
+	}
+
+	counts := &utils.ManifestCounts{
+		Domains: domains,
+		Planned: status.Planned,
+		Success: status.Completed,
+		Failed:  status.Failed,
+	}
+	for _, s := range status.Scenarios {
+		counts.Scenarios = append(counts.Scenarios, utils.ManifestScenarioCounts{
+			Scenario: s.Scenario,
+			Planned:  s.Planned,
+			Success:  s.Completed,
+			Failed:   s.Failed,
+		})
+	}
+	m.Counts = counts
+}
+
+func manifestPath(exp *experiment) string {
+	return filepath.Join(exp.resultSubDirectoryPath(), utils.ManifestFileName)
+}
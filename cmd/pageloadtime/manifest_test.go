@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+func TestNewManifest(t *testing.T) {
+	start := time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+	exp := defaultExperiment(start)
+	exp.Output.Directory = t.TempDir()
+	exp.Output.SubDirName = "tokyo-01"
+	scenarios := []scenario{{Cache: true, DANE: true}, {Cache: true, DANE: false}}
+
+	rt := newFakeRuntime()
+	rt.failOn("InspectImage", exp.Images.Letsdane, errors.New("No such image"))
+
+	m := newManifest(context.Background(), rt, exp, scenarios, start)
+	if m.MeasurementID != "tokyo-01" || m.Status != utils.ManifestStatusRunning || !m.StartedAt.Equal(start) {
+		t.Errorf("manifest = %+v", m)
+	}
+	// one unbound image serves the scenarios with and without cache.
+	if image := m.Images["unbound"]; image.Name != exp.Images.Unbound || len(m.Images) != 3 {
+		t.Errorf("images = %v, want firefox, letsdane and unbound", m.Images)
+	}
+	if image := m.Images["firefox"]; image.Name != exp.Images.Firefox || image.ID == "" {
+		t.Errorf("firefox image = %+v", image)
+	}
+	if image := m.Images["letsdane"]; image.ID != "" || image.Error == "" {
+		t.Errorf("letsdane image = %+v, want the inspect error", image)
+	}
+
+	// the default letsdane.args have -skip-dnssec.
+	if resolvers := m.LetsdaneResolvers; len(resolvers) != 1 || resolvers["with-cache-with-dane"] != "stub" {
+		t.Errorf("letsdane resolvers = %v, want stub in with-cache-with-dane", resolvers)
+	}
+
+	var recorded experiment
+	if err := json.Unmarshal(m.Experiment, &recorded); err != nil || recorded.Output.SubDirName != "tokyo-01" {
+		t.Errorf("experiment = %s, %v", m.Experiment, err)
+	}
+
+	p := newProgress(start)
+	p.plan(scenarios[0], 2)
+	p.begin(scenarios[0])
+	p.finish(scenarios[0], failureNone, time.Second)
+	p.begin(scenarios[0])
+	p.finish(scenarios[0], failureBrowserTimeout, 0)
+	finishManifest(&m, p.status(start.Add(time.Hour)), 1, nil, start.Add(time.Hour))
+
+	if err := os.MkdirAll(exp.resultSubDirectoryPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.WriteManifest(manifestPath(exp), m); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filepath.Join(exp.Output.Directory, "tokyo-01", "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	got, err := utils.ReadManifest(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != utils.ManifestStatusFinished || got.FinishedAt == nil || got.Counts == nil {
+		t.Fatalf("manifest = %+v", got)
+	}
+	if c := got.Counts; c.Domains != 1 || c.Planned != 2 || c.Success != 1 || c.Failed != 1 || len(c.Scenarios) != 1 {
+		t.Errorf("counts = %+v", c)
+	}
+}
+
+func TestFinishManifestFailed(t *testing.T) {
+	var m utils.Manifest
+	finishManifest(&m, progressStatus{}, 0, errors.New("failed to upload results"), time.Now())
+	if m.Status != utils.ManifestStatusFailed || m.Error != "failed to upload results" {
+		t.Errorf("manifest = %+v", m)
+	}
+}
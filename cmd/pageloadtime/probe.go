@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yagikota/danewebperf/cmd/pageloadtime/har"
+)
+
+const (
+	// probeFirefox loads the page with Firefox and Selenium in a container, which exports the HAR file.
+	probeFirefox = "firefox"
+	// probeHTTP fetches the page with net/http of pageloadtime and writes the httptrace timings of each request as a HAR file,
+	// so that the cost of the proxy and the TLSA lookup is measured without the rendering of a browser.
+	probeHTTP = "http"
+
+	// letsdanePort is the port of the proxy of letsdane.
+	letsdanePort = "8080"
+	// containerReadyTimeout is how long the http probe waits for unbound or letsdane to accept connections after they start.
+	containerReadyTimeout = 10 * time.Second
+)
+
+type httpProbeOptions struct {
+	Website string
+	// ResolverIP is the IP address of unbound, which resolves the website without DANE.
+	ResolverIP string
+	// ProxyAddr is the address of letsdane with DANE. e.g. 172.18.0.3:8080
+	ProxyAddr string
+	// CACertPath is the certificate of letsdane, which signs the certificates of the websites through the proxy.
+	CACertPath string
+	Timeout    time.Duration
+}
+
+// httpProbeError is the error of the requests of the http probe. It is classified by httpProbeFailure.
+type httpProbeError struct {
+	Err error
+}
+
+func (e *httpProbeError) Error() string {
+	return "http probe: " + e.Err.Error()
+}
+
+func (e *httpProbeError) Unwrap() error {
+	return e.Err
+}
+
+// runHTTPProbe fetches the website with the http probe from the host of pageloadtime, so the IP addresses of the containers must be reachable,
+// which is the case for the bridge networks of Docker on Linux.
+// With DANE, the requests are sent through the letsdane container, which is the one for filling the cache if fillCache is true.
+// Without DANE, the website is resolved by unbound.
+func runHTTPProbe(ctx context.Context, rt ContainerRuntime, opts *commandOptions, fillCache bool) ([]byte, error) {
+	probeOpts := *opts.HTTPProbeOpts
+	readyAddr := net.JoinHostPort(probeOpts.ResolverIP, "53")
+	if opts.HAROpts.DANE {
+		letsdaneContainerName := opts.LetsdaneDockerRunOpts.ContainerName
+		if fillCache {
+			letsdaneContainerName += "-fill-cache"
+		}
+		letsdaneIP, err := getContainerIP(ctx, rt, letsdaneContainerName)
+		if err != nil {
+			return nil, err
+		}
+		probeOpts.ProxyAddr = net.JoinHostPort(letsdaneIP, letsdanePort)
+		readyAddr = probeOpts.ProxyAddr
+	}
+	if err := waitForPort(ctx, readyAddr, containerReadyTimeout); err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("run http probe: %s proxy: %s resolver: %s", probeOpts.Website, probeOpts.ProxyAddr, probeOpts.ResolverIP))
+	return probeHTTPLog(ctx, &probeOpts)
+}
+
+// waitForPort waits until the address accepts TCP connections, because a container is not ready right after it starts.
+func waitForPort(ctx context.Context, addr string, timeout time.Duration) error {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	for {
+		conn, err := dialer.DialContext(waitCtx, "tcp", addr)
+		if err == nil {
+			return conn.Close()
+		}
+		select {
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%s is not ready in %s: %w", addr, timeout, err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// probeHTTPLog fetches the website following redirects and returns the HAR log of the requests in JSON, which is the same as the output of Firefox.
+// The page load time is from the start of the first request to the end of the body of the last response.
+func probeHTTPLog(ctx context.Context, opts *httpProbeOptions) ([]byte, error) {
+	transport, err := newHTTPProbeTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer transport.CloseIdleConnections()
+	tracing := &tracingTransport{transport: transport, viaProxy: opts.ProxyAddr != ""}
+	client := &http.Client{Transport: tracing}
+
+	probeCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(probeCtx, http.MethodGet, opts.Website, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if err != nil {
+		// the abort of the measurement is not a failure of the probe.
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &httpProbeError{Err: err}
+	}
+
+	return json.Marshal(tracing.harLog())
+}
+
+func newHTTPProbeTransport(opts *httpProbeOptions) (*http.Transport, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if opts.CACertPath != "" {
+		pem, err := os.ReadFile(opts.CACertPath)
+		if err != nil {
+			return nil, err
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", opts.CACertPath)
+		}
+	}
+
+	dialer := &net.Dialer{}
+	if opts.ResolverIP != "" {
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, net.JoinHostPort(opts.ResolverIP, "53"))
+			},
+		}
+	}
+
+	transport := &http.Transport{
+		DialContext:       dialer.DialContext,
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}
+	if opts.ProxyAddr != "" {
+		transport.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: opts.ProxyAddr})
+	}
+	return transport, nil
+}
+
+// tracingTransport records the httptrace events of each request, including the redirects.
+type tracingTransport struct {
+	transport http.RoundTripper
+	viaProxy  bool
+	requests  []*tracedRequest
+}
+
+// tracedRequest is the times of the httptrace events of a request. Zero times mean the events did not happen,
+// e.g. no DNS lookup through the proxy and no connection for a reused connection.
+type tracedRequest struct {
+	mu           sync.Mutex
+	request      *http.Request
+	response     *http.Response
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	bodyDone     time.Time
+	bodySize     int
+	remoteAddr   string
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := &tracedRequest{request: req, start: time.Now()}
+	t.requests = append(t.requests, r)
+
+	resp, err := t.transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), r.clientTrace())))
+	if err != nil {
+		return nil, err
+	}
+	r.response = resp
+	resp.Body = &tracedBody{ReadCloser: resp.Body, request: r}
+	return resp, nil
+}
+
+func (r *tracedRequest) clientTrace() *httptrace.ClientTrace {
+	// the events of a connection are sent from the goroutine which dials it.
+	set := func(t *time.Time) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		*t = time.Now()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { set(&r.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { set(&r.dnsDone) },
+		ConnectStart: func(string, string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			// the first of the addresses tried in parallel.
+			if r.connectStart.IsZero() {
+				r.connectStart = time.Now()
+			}
+		},
+		ConnectDone:       func(string, string, error) { set(&r.connectDone) },
+		TLSHandshakeStart: func() { set(&r.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { set(&r.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			set(&r.gotConn)
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.remoteAddr = info.Conn.RemoteAddr().String()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&r.wroteRequest) },
+		GotFirstResponseByte: func() { set(&r.firstByte) },
+	}
+}
+
+// tracedBody records the end of the body, which is read to the end for the last response and closed for redirects.
+type tracedBody struct {
+	io.ReadCloser
+	request *tracedRequest
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.request.mu.Lock()
+	b.request.bodySize += n
+	if err == io.EOF && b.request.bodyDone.IsZero() {
+		b.request.bodyDone = time.Now()
+	}
+	b.request.mu.Unlock()
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	b.request.mu.Lock()
+	if b.request.bodyDone.IsZero() {
+		b.request.bodyDone = time.Now()
+	}
+	b.request.mu.Unlock()
+	return b.ReadCloser.Close()
+}
+
+// milliseconds returns the time from from to to, or -1 if either of them did not happen as HAR expects.
+func milliseconds(from, to time.Time) int {
+	if from.IsZero() || to.IsZero() {
+		return -1
+	}
+	return int(to.Sub(from).Round(time.Millisecond) / time.Millisecond)
+}
+
+func firstTime(times ...time.Time) time.Time {
+	for _, t := range times {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// harLog converts the traced requests into a HAR log with a page of the first request.
+func (t *tracingTransport) harLog() har.Log {
+	harLog := har.Log{
+		Version: "1.2",
+		Creator: har.Creator{Name: "pageloadtime"},
+		Browser: har.Browser{Name: "net/http", Version: runtime.Version()},
+	}
+	if len(t.requests) == 0 {
+		return harLog
+	}
+
+	first, last := t.requests[0], t.requests[len(t.requests)-1]
+	harLog.Pages = []har.Page{{
+		StartedDateTime: first.start,
+		ID:              "page_1",
+		Title:           first.request.URL.String(),
+		PageTimings: har.PageTimings{
+			OnContentLoad: -1,
+			OnLoad:        milliseconds(first.start, last.bodyDone),
+		},
+	}}
+	for _, r := range t.requests {
+		harLog.Entries = append(harLog.Entries, r.harEntry(t.viaProxy))
+	}
+	return harLog
+}
+
+func (r *tracedRequest) harEntry(viaProxy bool) har.Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	timings := har.Timings{
+		Blocked: milliseconds(r.start, firstTime(r.dnsStart, r.connectStart, r.gotConn)),
+		DNS:     milliseconds(r.dnsStart, r.dnsDone),
+		// connect includes the CONNECT request to the proxy and ssl, as HAR defines.
+		Connect: milliseconds(r.connectStart, firstTime(r.tlsDone, r.connectDone)),
+		Ssl:     milliseconds(r.tlsStart, r.tlsDone),
+		Send:    milliseconds(r.gotConn, r.wroteRequest),
+		Wait:    milliseconds(r.wroteRequest, r.firstByte),
+		Receive: milliseconds(r.firstByte, r.bodyDone),
+	}
+	if viaProxy && !r.tlsStart.IsZero() {
+		timings.ProxyConnect = milliseconds(r.connectDone, r.tlsStart)
+	}
+
+	entry := har.Entry{
+		Pageref:         "page_1",
+		StartedDateTime: r.start,
+		Time:            milliseconds(r.start, firstTime(r.bodyDone, r.firstByte)),
+		Request: har.Request{
+			Method:      r.request.Method,
+			URL:         r.request.URL.String(),
+			HTTPVersion: r.request.Proto,
+			HeadersSize: -1,
+		},
+		Timings:         timings,
+		ServerIPAddress: r.remoteAddr,
+	}
+	if host, _, err := net.SplitHostPort(r.remoteAddr); err == nil {
+		entry.ServerIPAddress = host
+	}
+	if r.response != nil {
+		entry.Request.HTTPVersion = r.response.Proto
+		entry.Response = har.Response{
+			Status:      r.response.StatusCode,
+			StatusText:  strings.TrimSpace(strings.TrimPrefix(r.response.Status, fmt.Sprint(r.response.StatusCode))),
+			HTTPVersion: r.response.Proto,
+			Content: har.Content{
+				Size:     r.bodySize,
+				MimeType: r.response.Header.Get("Content-Type"),
+			},
+			RedirectURL: r.response.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    r.bodySize,
+		}
+	}
+	return entry
+}
+
+// httpProbeFailure classifies the error of the requests of the http probe in the same reasons as Firefox.
+func httpProbeFailure(probeErr *httpProbeError) failureReason {
+	err := probeErr.Err
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var alertErr tls.AlertError
+	var recordErr tls.RecordHeaderError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return failureProbeTimeout
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsNotFound {
+			return failureDNSNotFound
+		}
+		return failureDNSServfail
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthorityErr), errors.As(err, &hostnameErr),
+		errors.As(err, &alertErr), errors.As(err, &recordErr), strings.Contains(err.Error(), "tls:"):
+		return failureTLS
+	case strings.Contains(err.Error(), "Bad Gateway"):
+		// letsdane answers the CONNECT request with 502 if it cannot reach the website.
+		return failureProxyBadGateway
+	case errors.As(err, &netErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return failureConnection
+	}
+	return failureProbeError
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yagikota/danewebperf/cmd/pageloadtime/har"
+	"github.com/yagikota/danewebperf/utils"
+)
+
+// newProbeTestServer serves a redirect to /landing, and writes its certificate to a file for httpProbeOptions.CACertPath.
+func newProbeTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/landing", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "hello")
+	}))
+	t.Cleanup(srv.Close)
+
+	certPath := filepath.Join(t.TempDir(), "cert.crt")
+	writeFile(t, certPath, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})))
+	return srv, certPath
+}
+
+// connectProxy is a minimal proxy for CONNECT like letsdane without DANE validation.
+func connectProxy(t *testing.T, status int) *httptest.Server {
+	t.Helper()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		w.WriteHeader(http.StatusOK)
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go io.Copy(upstream, buf)
+		io.Copy(conn, upstream)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func probeLog(t *testing.T, opts *httpProbeOptions) har.Log {
+	t.Helper()
+	buf, err := probeHTTPLog(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("probeHTTPLog() error = %v", err)
+	}
+	var log har.Log
+	if err := json.Unmarshal(buf, &log); err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+func TestProbeHTTPLog(t *testing.T) {
+	srv, certPath := newProbeTestServer(t)
+	log := probeLog(t, &httpProbeOptions{Website: srv.URL + "/", CACertPath: certPath, Timeout: 10 * time.Second})
+
+	if len(log.Pages) != 1 || log.Pages[0].PageTimings.OnLoad < 0 {
+		t.Fatalf("pages = %+v, want a page with onLoad", log.Pages)
+	}
+	if len(log.Entries) != 2 {
+		t.Fatalf("entries = %+v, want the redirect and the landing page", log.Entries)
+	}
+	redirect, landing := log.Entries[0], log.Entries[1]
+	if redirect.Response.Status != http.StatusFound || redirect.Response.RedirectURL != "/landing" {
+		t.Errorf("redirect = %+v, want 302 to /landing", redirect.Response)
+	}
+	if landing.Response.Status != http.StatusOK || landing.Response.Content.Size != len("hello") || landing.Response.Content.MimeType != "text/html" {
+		t.Errorf("landing = %+v, want 200 with 5 bytes of text/html", landing.Response)
+	}
+	// the IP address of the server is not resolved, and the connection of the redirect is reused for the landing page.
+	if timings := redirect.Timings; timings.DNS != -1 || timings.Connect < 0 || timings.Ssl < 0 || timings.Wait < 0 || timings.ProxyConnect != 0 {
+		t.Errorf("timings of redirect = %+v, want connect and ssl without dns", timings)
+	}
+	if timings := landing.Timings; timings.Connect != -1 || timings.Ssl != -1 || timings.Wait < 0 {
+		t.Errorf("timings of landing = %+v, want a reused connection", timings)
+	}
+	if redirect.ServerIPAddress != "127.0.0.1" {
+		t.Errorf("server IP = %s, want 127.0.0.1", redirect.ServerIPAddress)
+	}
+}
+
+func TestProbeHTTPLogProxy(t *testing.T) {
+	srv, certPath := newProbeTestServer(t)
+	proxy := connectProxy(t, http.StatusOK)
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := probeLog(t, &httpProbeOptions{Website: srv.URL + "/landing", ProxyAddr: proxyURL.Host, CACertPath: certPath, Timeout: 10 * time.Second})
+	if len(log.Entries) != 1 {
+		t.Fatalf("entries = %+v, want the landing page", log.Entries)
+	}
+	entry := log.Entries[0]
+	if entry.Response.Status != http.StatusOK || entry.Timings.ProxyConnect < 0 || entry.Timings.Ssl < 0 {
+		t.Errorf("entry = %+v, want 200 with the timings of CONNECT and ssl", entry)
+	}
+	if entry.ServerIPAddress != proxyURL.Hostname() {
+		t.Errorf("server IP = %s, want the proxy %s", entry.ServerIPAddress, proxyURL.Hostname())
+	}
+}
+
+func TestProbeHTTPLogFailure(t *testing.T) {
+	srv, certPath := newProbeTestServer(t)
+	proxy := connectProxy(t, http.StatusBadGateway)
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts httpProbeOptions
+		want failureReason
+	}{
+		{
+			name: "bad gateway",
+			opts: httpProbeOptions{Website: srv.URL, ProxyAddr: proxyURL.Host, CACertPath: certPath},
+			want: failureProxyBadGateway,
+		},
+		{
+			name: "unknown certificate",
+			opts: httpProbeOptions{Website: srv.URL},
+			want: failureTLS,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Timeout = 10 * time.Second
+			_, err := probeHTTPLog(context.Background(), &tt.opts)
+			var probeErr *httpProbeError
+			if !errors.As(err, &probeErr) {
+				t.Fatalf("probeHTTPLog() error = %v, want httpProbeError", err)
+			}
+			if got := classifyFailure(HARFileContent{Err: err}, nil); got != tt.want {
+				t.Errorf("classifyFailure() = %s, want %s (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestHTTPProbeFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want failureReason
+	}{
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: context.DeadlineExceeded}, failureProbeTimeout},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}}, failureDNSNotFound},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.DNSError{Err: "server misbehaving", Name: "example.com"}}, failureDNSServfail},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}, failureTLS},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}, failureConnection},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: io.EOF}, failureConnection},
+		{errors.New("something else"), failureProbeError},
+	}
+	for _, tt := range tests {
+		if got := httpProbeFailure(&httpProbeError{Err: tt.err}); got != tt.want {
+			t.Errorf("httpProbeFailure(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWaitForPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	if err := waitForPort(context.Background(), addr, time.Second); err != nil {
+		t.Errorf("waitForPort() error = %v, want nil", err)
+	}
+	listener.Close()
+	if err := waitForPort(context.Background(), addr, 200*time.Millisecond); err == nil || !strings.Contains(err.Error(), "not ready") {
+		t.Errorf("waitForPort() error = %v, want not ready", err)
+	}
+}
+
+func TestExperimentProbe(t *testing.T) {
+	exp := defaultExperiment(time.Now())
+	exp.Input.CSV = filepath.Join(t.TempDir(), "domains.csv")
+	writeFile(t, exp.Input.CSV, "example.com\n")
+	exp.Probe = probeHTTP
+	if err := exp.validate(); err != nil {
+		t.Errorf("validate() error = %v, want nil", err)
+	}
+
+	exp.Impairments = []string{noImpairment, "rtt50"}
+	exp.HTTPProbe.TimeoutSeconds = 0
+	err := exp.validate()
+	for _, field := range []string{"impairments:", "httpProbe.timeoutSeconds:"} {
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("validate() error = %v, want %s", err, field)
+		}
+	}
+
+	exp.Probe = "chrome"
+	if err := exp.validate(); err == nil || !strings.Contains(err.Error(), "probe:") {
+		t.Errorf("validate() error = %v, want probe", err)
+	}
+}
+
+func TestMeasurementCommandOptionsHTTPProbe(t *testing.T) {
+	exp := defaultExperiment(time.Now())
+	record := utils.Record{Domain: "example.com"}
+	s := scenario{Cache: true, DANE: true}
+	if opts := measurementCommandOptions(exp, record, s, trialMeasurementID(record, s, 1, 1), t.TempDir()); opts.HTTPProbeOpts != nil {
+		t.Errorf("HTTPProbeOpts = %+v, want nil with Firefox", opts.HTTPProbeOpts)
+	}
+
+	exp.Probe = probeHTTP
+	opts := measurementCommandOptions(exp, record, s, trialMeasurementID(record, s, 1, 1), t.TempDir())
+	if opts.HTTPProbeOpts == nil || opts.HTTPProbeOpts.Website != "https://example.com" || opts.HTTPProbeOpts.Timeout != 30*time.Second {
+		t.Errorf("HTTPProbeOpts = %+v, want https://example.com with the timeout of 30s", opts.HTTPProbeOpts)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// progress tracks the measurements of a run for /metrics and /status.
+// A measurement is a trial of a scenario for a domain.
+type progress struct {
+	mu         sync.Mutex
+	startedAt  time.Time
+	scenarios  []string
+	planned    map[string]int
+	inFlight   map[string]int
+	completed  map[string]int
+	failed     map[string]int
+	containers map[string]bool
+
+	registry          *prometheus.Registry
+	plannedGauge      *prometheus.GaugeVec
+	inFlightGauge     *prometheus.GaugeVec
+	finishedCounter   *prometheus.CounterVec
+	failureCounter    *prometheus.CounterVec
+	containersGauge   prometheus.Gauge
+	pageLoadHistogram *prometheus.HistogramVec
+	etaGauge          prometheus.GaugeFunc
+}
+
+func newProgress(now time.Time) *progress {
+	p := &progress{
+		startedAt:  now,
+		planned:    make(map[string]int),
+		inFlight:   make(map[string]int),
+		completed:  make(map[string]int),
+		failed:     make(map[string]int),
+		containers: make(map[string]bool),
+		registry:   prometheus.NewRegistry(),
+		plannedGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pageloadtime_measurements_planned",
+			Help: "Number of measurements to run in this run.",
+		}, []string{"scenario"}),
+		inFlightGauge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pageloadtime_measurements_in_flight",
+			Help: "Number of measurements running now.",
+		}, []string{"scenario"}),
+		finishedCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pageloadtime_measurements_finished_total",
+			Help: "Number of finished measurements by result (success or failed).",
+		}, []string{"scenario", "result"}),
+		failureCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pageloadtime_measurement_failures_total",
+			Help: "Number of failed measurements by failure reason.",
+		}, []string{"scenario", "reason"}),
+		containersGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pageloadtime_running_containers",
+			Help: "Number of containers started by pageloadtime and not stopped yet.",
+		}),
+		pageLoadHistogram: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pageloadtime_page_load_time_seconds",
+			Help:    "Page load time (onLoad of the first page) of successful measurements.",
+			Buckets: []float64{0.25, 0.5, 1, 2, 3, 5, 7.5, 10, 15, 20, 30, 60},
+		}, []string{"scenario"}),
+	}
+	p.etaGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pageloadtime_eta_seconds",
+		Help: "Estimated time until all planned measurements finish. -1 until the first measurement finishes.",
+	}, func() float64 {
+		eta, ok := p.status(time.Now()).eta()
+		if !ok {
+			return -1
+		}
+		return eta.Seconds()
+	})
+	p.registry.MustRegister(p.plannedGauge, p.inFlightGauge, p.finishedCounter, p.failureCounter, p.containersGauge, p.pageLoadHistogram, p.etaGauge)
+	return p
+}
+
+// plan adds the measurements to run for the scenario.
+func (p *progress) plan(s scenario, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	name := s.String()
+	if _, ok := p.planned[name]; !ok {
+		p.scenarios = append(p.scenarios, name)
+	}
+	p.planned[name] += n
+	p.plannedGauge.WithLabelValues(name).Add(float64(n))
+}
+
+// begin is called when a measurement of the scenario starts.
+func (p *progress) begin(s scenario) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inFlight[s.String()]++
+	p.inFlightGauge.WithLabelValues(s.String()).Inc()
+}
+
+// finish is called when the result of a measurement of the scenario is saved.
+func (p *progress) finish(s scenario, reason failureReason, pageLoadTime time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	name := s.String()
+	p.inFlight[name]--
+	p.inFlightGauge.WithLabelValues(name).Dec()
+	if reason == failureNone {
+		p.completed[name]++
+		p.finishedCounter.WithLabelValues(name, "success").Inc()
+		p.pageLoadHistogram.WithLabelValues(name).Observe(pageLoadTime.Seconds())
+		return
+	}
+	p.failed[name]++
+	p.finishedCounter.WithLabelValues(name, "failed").Inc()
+	p.failureCounter.WithLabelValues(name, string(reason)).Inc()
+}
+
+// abort is called when a measurement of the scenario is aborted. It is still planned, because it is measured again with -resume.
+func (p *progress) abort(s scenario) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inFlight[s.String()]--
+	p.inFlightGauge.WithLabelValues(s.String()).Dec()
+}
+
+func (p *progress) containerStarted(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.containers[name] = true
+	p.containersGauge.Set(float64(len(p.containers)))
+}
+
+func (p *progress) containerStopped(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.containers, name)
+	p.containersGauge.Set(float64(len(p.containers)))
+}
+
+type scenarioStatus struct {
+	Scenario  string `json:"scenario"`
+	Planned   int    `json:"planned"`
+	Completed int    `json:"completed"`
+	Failed    int    `json:"failed"`
+	InFlight  int    `json:"inFlight"`
+}
+
+type progressStatus struct {
+	StartedAt         time.Time        `json:"startedAt"`
+	ElapsedSeconds    float64          `json:"elapsedSeconds"`
+	Planned           int              `json:"planned"`
+	Completed         int              `json:"completed"`
+	Failed            int              `json:"failed"`
+	InFlight          int              `json:"inFlight"`
+	RunningContainers int              `json:"runningContainers"`
+	ETASeconds        *float64         `json:"etaSeconds"`
+	Scenarios         []scenarioStatus `json:"scenarios"`
+}
+
+// eta estimates the remaining time from the average throughput since the start.
+// It returns false until the first measurement finishes.
+func (s progressStatus) eta() (time.Duration, bool) {
+	finished := s.Completed + s.Failed
+	if finished == 0 {
+		return 0, false
+	}
+	elapsed := time.Duration(s.ElapsedSeconds * float64(time.Second))
+	return elapsed / time.Duration(finished) * time.Duration(s.Planned-finished), true
+}
+
+func (p *progress) status(now time.Time) progressStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := progressStatus{
+		StartedAt:         p.startedAt,
+		ElapsedSeconds:    now.Sub(p.startedAt).Seconds(),
+		RunningContainers: len(p.containers),
+		Scenarios:         make([]scenarioStatus, 0, len(p.scenarios)),
+	}
+	for _, name := range p.scenarios {
+		s := scenarioStatus{
+			Scenario:  name,
+			Planned:   p.planned[name],
+			Completed: p.completed[name],
+			Failed:    p.failed[name],
+			InFlight:  p.inFlight[name],
+		}
+		status.Scenarios = append(status.Scenarios, s)
+		status.Planned += s.Planned
+		status.Completed += s.Completed
+		status.Failed += s.Failed
+		status.InFlight += s.InFlight
+	}
+	if eta, ok := status.eta(); ok {
+		seconds := eta.Seconds()
+		status.ETASeconds = &seconds
+	}
+	return status
+}
+
+// handler serves /metrics in the Prometheus format and /status in JSON.
+func (p *progress) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(p.status(time.Now())); err != nil {
+			logger.Error("Failed to write status: " + err.Error())
+		}
+	})
+	return mux
+}
+
+// progressRuntime counts the running containers of the runtime.
+type progressRuntime struct {
+	ContainerRuntime
+	progress *progress
+}
+
+func (r *progressRuntime) StartContainer(ctx context.Context, spec ContainerSpec) error {
+	if err := r.ContainerRuntime.StartContainer(ctx, spec); err != nil {
+		return err
+	}
+	r.progress.containerStarted(spec.Name)
+	return nil
+}
+
+func (r *progressRuntime) RunContainer(ctx context.Context, spec ContainerSpec) ([]byte, error) {
+	r.progress.containerStarted(spec.Name)
+	defer r.progress.containerStopped(spec.Name)
+	return r.ContainerRuntime.RunContainer(ctx, spec)
+}
+
+func (r *progressRuntime) StopContainer(ctx context.Context, name string) error {
+	err := r.ContainerRuntime.StopContainer(ctx, name)
+	r.progress.containerStopped(name)
+	return err
+}
+
+func (r *progressRuntime) RemoveContainer(ctx context.Context, name string) error {
+	err := r.ContainerRuntime.RemoveContainer(ctx, name)
+	r.progress.containerStopped(name)
+	return err
+}
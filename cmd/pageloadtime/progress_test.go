@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+func TestProgressStatus(t *testing.T) {
+	start := time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+	p := newProgress(start)
+	withDane := scenario{Cache: false, DANE: true}
+	withoutDane := scenario{Cache: false, DANE: false}
+	p.plan(withoutDane, 2)
+	p.plan(withDane, 2)
+
+	if status := p.status(start); status.ETASeconds != nil {
+		t.Errorf("eta = %v, want nil before any measurement finishes", *status.ETASeconds)
+	}
+
+	p.begin(withoutDane)
+	p.begin(withDane)
+	p.begin(withDane)
+	p.finish(withoutDane, failureNone, 1500*time.Millisecond)
+	p.finish(withDane, failureBrowserTimeout, 0)
+
+	status := p.status(start.Add(10 * time.Minute))
+	if status.Planned != 4 || status.Completed != 1 || status.Failed != 1 || status.InFlight != 1 {
+		t.Errorf("status = %+v", status)
+	}
+	// 2 measurements in 10 minutes, so the other 2 take 10 minutes.
+	if status.ETASeconds == nil || *status.ETASeconds != 600 {
+		t.Errorf("eta = %v, want 600", status.ETASeconds)
+	}
+	want := []scenarioStatus{
+		{Scenario: "without-cache-without-dane", Planned: 2, Completed: 1},
+		{Scenario: "without-cache-with-dane", Planned: 2, Failed: 1, InFlight: 1},
+	}
+	for i, s := range status.Scenarios {
+		if s != want[i] {
+			t.Errorf("scenario %d = %+v, want %+v", i, s, want[i])
+		}
+	}
+}
+
+func TestProgressHandler(t *testing.T) {
+	p := newProgress(time.Now())
+	s := scenario{Cache: true, DANE: true}
+	p.plan(s, 1)
+	p.begin(s)
+	p.finish(s, failureNone, 2*time.Second)
+
+	server := httptest.NewServer(p.handler())
+	defer server.Close()
+
+	res, err := server.Client().Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	for _, want := range []string{
+		`pageloadtime_measurements_finished_total{result="success",scenario="with-cache-with-dane"} 1`,
+		`pageloadtime_page_load_time_seconds_bucket{scenario="with-cache-with-dane",le="2"} 1`,
+		`pageloadtime_eta_seconds 0`,
+		`pageloadtime_running_containers 0`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics does not contain %s:\n%s", want, body)
+		}
+	}
+
+	res, err = server.Client().Get(server.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var status progressStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Completed != 1 || len(status.Scenarios) != 1 {
+		t.Errorf("/status = %+v", status)
+	}
+}
+
+func TestProgressRuntime(t *testing.T) {
+	p := newProgress(time.Now())
+	fake := newFakeRuntime()
+	rt := &progressRuntime{ContainerRuntime: fake, progress: p}
+
+	record := utils.Record{Domain: "example.com"}
+	s := scenario{Cache: true, DANE: true}
+	opts := measurementCommandOptions(defaultExperiment(time.Now()), record, s, trialMeasurementID(record, s, 1, 1), t.TempDir())
+
+	// unbound and letsdane are running while firefox runs.
+	fake.onRun = func(spec ContainerSpec) {
+		if spec.Name == opts.HARDockerRunOpts.ContainerName {
+			if got := p.status(time.Now()).RunningContainers; got != 4 {
+				t.Errorf("running containers = %d, want 4 (unbound, letsdane for filling cache, letsdane and firefox)", got)
+			}
+		}
+	}
+	if _, err := collectHAR(context.Background(), rt, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.status(time.Now()).RunningContainers; got != 0 {
+		t.Errorf("running containers = %d, want 0 after collectHAR", got)
+	}
+}
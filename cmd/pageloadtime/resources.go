@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resourceHost is the name of the host in the resource usage files, next to the names of the containers.
+const resourceHost = "host"
+
+type resourceOptions struct {
+	// Interval is the interval of sampling the resource usage.
+	Interval time.Duration
+	// SaturationPercent is the mean CPU usage of the host from which the measurement is marked as saturated.
+	SaturationPercent float64
+	// Saturated is set by collectHAR when the page is loaded.
+	Saturated bool
+}
+
+// resourceSample is the resource usage of a container, or the host, in the interval before Time.
+type resourceSample struct {
+	Time      time.Time
+	Container string
+	// CPUPercent is 100 for a fully used CPU, so a container can use more than 100 on a host with several CPUs.
+	// For the host, it is the usage of all CPUs up to 100.
+	CPUPercent  float64
+	MemoryBytes uint64
+	MemoryLimit uint64
+	// NetworkRx and NetworkTx are cumulative since the container started.
+	NetworkRx uint64
+	NetworkTx uint64
+}
+
+type resourceSummary struct {
+	Container      string
+	Samples        int
+	CPUMeanPercent float64
+	CPUMaxPercent  float64
+	MemoryMax      uint64
+	// NetworkRx and NetworkTx are the bytes received and sent during the measurement.
+	NetworkRx uint64
+	NetworkTx uint64
+}
+
+// hostCPUTimes is the cumulative CPU time of the host in USER_HZ.
+type hostCPUTimes struct {
+	Busy  uint64
+	Total uint64
+}
+
+// readHostCPU reads the CPU time of all CPUs from /proc/stat.
+// It is the Docker host only if Docker runs on the same machine as pageloadtime, e.g. with the default unix socket.
+func readHostCPU() (hostCPUTimes, error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return hostCPUTimes{}, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "cpu" {
+			continue
+		}
+		return parseHostCPU(fields[1:])
+	}
+	if err := scanner.Err(); err != nil {
+		return hostCPUTimes{}, err
+	}
+	return hostCPUTimes{}, errors.New("no cpu line in /proc/stat")
+}
+
+// parseHostCPU parses "user nice system idle iowait irq softirq steal ..." of the cpu line of /proc/stat.
+// guest and guest_nice are not added, because they are included in user and nice.
+func parseHostCPU(fields []string) (hostCPUTimes, error) {
+	if len(fields) < 8 {
+		return hostCPUTimes{}, fmt.Errorf("cpu line of /proc/stat has %d fields, want 8 or more", len(fields))
+	}
+	var times hostCPUTimes
+	for i, field := range fields[:8] {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return hostCPUTimes{}, err
+		}
+		times.Total += v
+		// idle and iowait
+		if i != 3 && i != 4 {
+			times.Busy += v
+		}
+	}
+	return times, nil
+}
+
+// resourceSampler samples the resource usage of the containers of a measurement and the host at each interval.
+// The containers which are not running yet, or anymore, are skipped.
+type resourceSampler struct {
+	rt         ContainerRuntime
+	opts       *resourceOptions
+	containers []string
+	hostCPU    func() (hostCPUTimes, error)
+	// seriesPath and summaryPath are where finish writes the samples and their summary.
+	seriesPath  string
+	summaryPath string
+
+	cancel   context.CancelFunc
+	done     chan struct{}
+	once     sync.Once
+	previous map[string]ContainerStats
+	host     *hostCPUTimes
+	samples  []resourceSample
+	first    map[string]ContainerStats
+}
+
+func newResourceSampler(rt ContainerRuntime, opts *resourceOptions, containers []string, resultDirPath, measurementSuffix string) *resourceSampler {
+	return &resourceSampler{
+		rt:          rt,
+		opts:        opts,
+		containers:  containers,
+		hostCPU:     readHostCPU,
+		seriesPath:  filepath.Join(resultDirPath, "resources"+measurementSuffix+".csv"),
+		summaryPath: filepath.Join(resultDirPath, "resources"+measurementSuffix+"-summary.csv"),
+		done:        make(chan struct{}),
+		previous:    make(map[string]ContainerStats),
+		first:       make(map[string]ContainerStats),
+	}
+}
+
+// startResourceSampler starts sampling until finish is called. It returns nil if opts is nil, and finish of nil does nothing.
+// The files are resources-<measurement ID>.csv and resources-<measurement ID>-summary.csv in resultDirPath.
+func startResourceSampler(ctx context.Context, rt ContainerRuntime, opts *resourceOptions, containers []string, resultDirPath, measurementSuffix string) *resourceSampler {
+	if opts == nil {
+		return nil
+	}
+	s := newResourceSampler(rt, opts, containers, resultDirPath, measurementSuffix)
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.run(ctx)
+	return s
+}
+
+func (s *resourceSampler) run(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	for {
+		s.sample(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample takes a sample of every container and the host. The first stats of each is only the baseline of the CPU usage.
+func (s *resourceSampler) sample(ctx context.Context) {
+	for _, name := range s.containers {
+		stats, err := s.rt.ContainerStats(ctx, name)
+		if err != nil {
+			if !isNotFound(err) && ctx.Err() == nil {
+				logger.Warn(fmt.Sprintf("Failed to get resource usage of %s: %s", name, err))
+			}
+			continue
+		}
+		if stats.Read.IsZero() {
+			continue
+		}
+		previous, ok := s.previous[name]
+		s.previous[name] = stats
+		if !ok {
+			s.first[name] = stats
+			continue
+		}
+		var cpuPercent float64
+		if stats.CPUUsage >= previous.CPUUsage && stats.SystemCPUUsage > previous.SystemCPUUsage {
+			// same as docker stats
+			cpuDelta := float64(stats.CPUUsage - previous.CPUUsage)
+			systemDelta := float64(stats.SystemCPUUsage - previous.SystemCPUUsage)
+			cpuPercent = cpuDelta / systemDelta * float64(stats.OnlineCPUs) * 100
+		}
+		s.samples = append(s.samples, resourceSample{
+			Time:        stats.Read,
+			Container:   name,
+			CPUPercent:  cpuPercent,
+			MemoryBytes: stats.MemoryUsage,
+			MemoryLimit: stats.MemoryLimit,
+			NetworkRx:   stats.NetworkRx,
+			NetworkTx:   stats.NetworkTx,
+		})
+	}
+
+	host, err := s.hostCPU()
+	if err != nil {
+		return
+	}
+	if s.host != nil && host.Total > s.host.Total {
+		s.samples = append(s.samples, resourceSample{
+			Time:       time.Now(),
+			Container:  resourceHost,
+			CPUPercent: float64(host.Busy-s.host.Busy) / float64(host.Total-s.host.Total) * 100,
+		})
+	}
+	s.host = &host
+}
+
+// finish stops sampling and saves the samples. It can be called more than once,
+// e.g. right after the page load and again when collectHAR returns.
+func (s *resourceSampler) finish() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		s.cancel()
+		<-s.done
+		s.save()
+	})
+}
+
+// save writes the samples and their summary, and sets opts.Saturated.
+func (s *resourceSampler) save() {
+	summaries := summarizeResources(s.samples, s.first, s.previous)
+	s.opts.Saturated = hostSaturated(summaries, s.opts.SaturationPercent)
+	if s.opts.Saturated {
+		logger.Warn(fmt.Sprintf("host was saturated while measuring: %s", s.seriesPath))
+	}
+	if err := writeResourceSamplesCSV(s.seriesPath, s.samples); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write resource usage into csv: %s", err))
+	}
+	if err := writeResourceSummaryCSV(s.summaryPath, summaries); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write summary of resource usage into csv: %s", err))
+	}
+}
+
+// summarizeResources summarizes the samples of each container and the host in the order of their first samples.
+// The network I/O is the difference between the first and the last stats of the container.
+func summarizeResources(samples []resourceSample, first, last map[string]ContainerStats) []resourceSummary {
+	var summaries []resourceSummary
+	index := make(map[string]int)
+	for _, sample := range samples {
+		i, ok := index[sample.Container]
+		if !ok {
+			i = len(summaries)
+			index[sample.Container] = i
+			summaries = append(summaries, resourceSummary{Container: sample.Container})
+		}
+		summary := &summaries[i]
+		summary.Samples++
+		summary.CPUMeanPercent += sample.CPUPercent
+		summary.CPUMaxPercent = max(summary.CPUMaxPercent, sample.CPUPercent)
+		summary.MemoryMax = max(summary.MemoryMax, sample.MemoryBytes)
+	}
+	for i := range summaries {
+		summary := &summaries[i]
+		summary.CPUMeanPercent /= float64(summary.Samples)
+		if f, l := first[summary.Container], last[summary.Container]; l.NetworkRx >= f.NetworkRx && l.NetworkTx >= f.NetworkTx {
+			summary.NetworkRx = l.NetworkRx - f.NetworkRx
+			summary.NetworkTx = l.NetworkTx - f.NetworkTx
+		}
+	}
+	return summaries
+}
+
+// hostSaturated reports whether the mean CPU usage of the host during the measurement reached threshold percent.
+// It is false if the host was not sampled.
+func hostSaturated(summaries []resourceSummary, threshold float64) bool {
+	for _, summary := range summaries {
+		if summary.Container == resourceHost {
+			return summary.CPUMeanPercent >= threshold
+		}
+	}
+	return false
+}
+
+func formatPercent(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+func writeResourceSamplesCSV(path string, samples []resourceSample) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"time", "container", "cpu_percent", "memory_bytes", "memory_limit_bytes", "network_rx_bytes", "network_tx_bytes"}); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		record := []string{s.Time.Format(time.RFC3339Nano), s.Container, formatPercent(s.CPUPercent), "", "", "", ""}
+		if s.Container != resourceHost {
+			record[3] = strconv.FormatUint(s.MemoryBytes, 10)
+			record[4] = strconv.FormatUint(s.MemoryLimit, 10)
+			record[5] = strconv.FormatUint(s.NetworkRx, 10)
+			record[6] = strconv.FormatUint(s.NetworkTx, 10)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeResourceSummaryCSV(path string, summaries []resourceSummary) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"container", "samples", "cpu_mean_percent", "cpu_max_percent", "memory_max_bytes", "network_rx_bytes", "network_tx_bytes"}); err != nil {
+		return err
+	}
+	for _, s := range summaries {
+		record := []string{s.Container, strconv.Itoa(s.Samples), formatPercent(s.CPUMeanPercent), formatPercent(s.CPUMaxPercent), "", "", ""}
+		if s.Container != resourceHost {
+			record[4] = strconv.FormatUint(s.MemoryMax, 10)
+			record[5] = strconv.FormatUint(s.NetworkRx, 10)
+			record[6] = strconv.FormatUint(s.NetworkTx, 10)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
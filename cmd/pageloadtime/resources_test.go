@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+func TestParseHostCPU(t *testing.T) {
+	// user nice system idle iowait irq softirq steal guest guest_nice
+	times, err := parseHostCPU(strings.Fields("100 10 40 800 20 5 5 20 50 0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if times != (hostCPUTimes{Busy: 180, Total: 1000}) {
+		t.Errorf("parseHostCPU() = %+v, want busy 180 of 1000", times)
+	}
+	if _, err := parseHostCPU([]string{"1", "2"}); err == nil {
+		t.Error("parseHostCPU() error = nil, want error for too few fields")
+	}
+}
+
+func TestResourceSampler(t *testing.T) {
+	rt := newFakeRuntime()
+	if err := rt.StartContainer(context.Background(), ContainerSpec{Name: "unbound"}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	opts := &resourceOptions{Interval: time.Second, SaturationPercent: 90}
+	s := newResourceSampler(rt, opts, []string{"unbound", "firefox"}, dir, "-example.com")
+	var host hostCPUTimes
+	s.hostCPU = func() (hostCPUTimes, error) {
+		host.Busy += 95
+		host.Total += 100
+		return host, nil
+	}
+	// the first sample is the baseline, and firefox is skipped because it does not exist.
+	for i := 0; i < 4; i++ {
+		s.sample(context.Background())
+	}
+	s.save()
+
+	if !opts.Saturated {
+		t.Error("saturated = false, want true with 95% of host CPU")
+	}
+	summary, err := os.ReadFile(filepath.Join(dir, "resources-example.com-summary.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "container,samples,cpu_mean_percent,cpu_max_percent,memory_max_bytes,network_rx_bytes,network_tx_bytes\n" +
+		"unbound,3,10.00,10.00,1048576,3000,3000\n" +
+		"host,3,95.00,95.00,,,\n"
+	if string(summary) != want {
+		t.Errorf("summary =\n%s\nwant\n%s", summary, want)
+	}
+	series, err := os.ReadFile(filepath.Join(dir, "resources-example.com.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(series), "\n"); lines != 7 {
+		t.Errorf("series has %d lines, want a header and 6 samples:\n%s", lines, series)
+	}
+}
+
+func TestCollectHARResources(t *testing.T) {
+	exp := defaultExperiment(time.Now())
+	exp.Resources.IntervalMilliseconds = 0
+	record := utils.Record{Domain: "example.com"}
+	s := scenario{Cache: false, DANE: true}
+	if opts := measurementCommandOptions(exp, record, s, trialMeasurementID(record, s, 1, 1), t.TempDir()); opts.ResourceOpts != nil {
+		t.Errorf("ResourceOpts = %+v, want nil with the interval 0", opts.ResourceOpts)
+	}
+
+	exp.Resources.IntervalMilliseconds = 10
+	dir := t.TempDir()
+	rt := newFakeRuntime()
+	opts := measurementCommandOptions(exp, record, s, trialMeasurementID(record, s, 1, 1), dir)
+	// Firefox loads the page for a while, in which unbound and letsdane are sampled.
+	rt.onRun = func(spec ContainerSpec) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if _, err := collectHAR(context.Background(), rt, opts); err != nil {
+		t.Fatalf("collectHAR() error = %v", err)
+	}
+	if got := measurementContainers(opts); !slices.Equal(got, []string{"unbound-example.com-without-cache-with-dane", "letsdane-example.com-without-cache-with-dane", "firefox-example.com-without-cache-with-dane"}) {
+		t.Errorf("containers = %q", got)
+	}
+	summary, err := os.ReadFile(filepath.Join(dir, "resources-example.com-without-cache-with-dane-summary.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, container := range []string{"unbound-example.com-without-cache-with-dane,", "letsdane-example.com-without-cache-with-dane,"} {
+		if !strings.Contains(string(summary), "\n"+container) {
+			t.Errorf("summary has no %s:\n%s", container, summary)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+// retryPlan is the failed measurements of a previous run to measure again, which are read from its pageloadtime-*.csv.
+// The results are journaled in the result sub directory of the run, so that the CSV files are rebuilt with the rows
+// which succeeded before and the rows measured again.
+type retryPlan struct {
+	// Path is the CSV file of the previous run.
+	Path string
+	// Records are the rows of the CSV file.
+	Records []utils.PageLoadTimeRecord
+	// Domains are the pages of the rows and Scenarios are their scenarios, in the order of the CSV file.
+	Domains   []utils.Record
+	Scenarios []scenario
+	// Trials is the number of trials of the previous run.
+	Trials int
+	// Failed are the rows without a page load time which are measured again.
+	Failed []utils.PageLoadTimeRecord
+	// Budget is how many times each failed measurement is measured again at most. It stops at the first success.
+	Budget int
+}
+
+// newRetryPlan reads the CSV file and plans to measure its failed rows again.
+// If reasons is not empty, only the rows which failed for one of them are measured again.
+func newRetryPlan(path string, reasons []string, budget int) (*retryPlan, error) {
+	if budget < 1 {
+		return nil, fmt.Errorf("retry budget must be 1 or more, got %d", budget)
+	}
+	records, err := utils.ReadPageLoadTimeRecordsCSV(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &retryPlan{Path: path, Records: records, Budget: budget}
+	seenDomains := make(map[string]bool)
+	seenScenarios := make(map[scenario]bool)
+	for i, record := range records {
+		if !seenDomains[record.Domain] {
+			page, err := retryPage(record)
+			if err != nil {
+				return nil, fmt.Errorf("row %d of %s: %w", i+2, path, err)
+			}
+			plan.Domains = append(plan.Domains, page)
+			seenDomains[record.Domain] = true
+		}
+		if s := recordScenario(record); !seenScenarios[s] {
+			plan.Scenarios = append(plan.Scenarios, s)
+			seenScenarios[s] = true
+		}
+		plan.Trials = max(plan.Trials, record.Trial)
+
+		if record.PageLoadTime == "" && (len(reasons) == 0 || slices.Contains(reasons, record.FailureReason)) {
+			plan.Failed = append(plan.Failed, record)
+		}
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s has no rows", path)
+	}
+	return plan, nil
+}
+
+// retryPage returns the page of the row. The domain of the row is the slug of the page.
+func retryPage(record utils.PageLoadTimeRecord) (utils.Record, error) {
+	page := utils.Record{Domain: record.Domain}
+	if record.URL != "" {
+		u, err := url.Parse(record.URL)
+		if err != nil {
+			return page, err
+		}
+		page = utils.Record{Domain: u.Hostname(), URL: record.URL}
+	}
+	if record.Tags != "" {
+		page.Tags = strings.Split(record.Tags, ";")
+	}
+	if page.Slug() != record.Domain {
+		return page, fmt.Errorf("url %s is not of domain %s", record.URL, record.Domain)
+	}
+	return page, nil
+}
+
+func retryKey(record utils.PageLoadTimeRecord) journalKey {
+	return journalKey{Domain: record.Domain, Scenario: recordScenario(record).String(), Trial: record.Trial}
+}
+
+// finished returns every measurement of the run as finished except the failed ones.
+func (r *retryPlan) finished() map[journalKey]bool {
+	finished := make(map[journalKey]bool)
+	for _, page := range r.Domains {
+		for trial := 1; trial <= r.Trials; trial++ {
+			for _, s := range r.Scenarios {
+				finished[journalKey{Domain: page.Slug(), Scenario: s.String(), Trial: trial}] = true
+			}
+		}
+	}
+	for _, record := range r.Failed {
+		delete(finished, retryKey(record))
+	}
+	return finished
+}
+
+// attempts returns the attempts which produced the failed rows.
+func (r *retryPlan) attempts() map[journalKey]int {
+	attempts := make(map[journalKey]int)
+	for _, record := range r.Failed {
+		attempts[retryKey(record)] = max(record.Attempt, 1)
+	}
+	return attempts
+}
+
+// seedJournal journals the rows which are not in the journal, e.g. of a run without a journal,
+// so that they are kept when the CSV files are rebuilt from the journal.
+func (r *retryPlan) seedJournal(journalPath string, j *journal) error {
+	entries, err := readJournal(journalPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	journaled := finishedMeasurements(entries)
+	for _, record := range r.Records {
+		if journaled[retryKey(record)] {
+			continue
+		}
+		s := recordScenario(record)
+		entry := journalEntry{
+			Domain:        record.Domain,
+			Scenario:      s.String(),
+			Cache:         s.Cache,
+			Dane:          s.DANE,
+			WithoutDNSSEC: s.WithoutDNSSEC,
+			Resolver:      string(s.Resolver),
+			RepeatVisit:   s.RepeatVisit,
+			Impairment:    s.Impairment,
+			Trial:         record.Trial,
+			PageLoadTime:  record.PageLoadTime,
+			FailureReason: record.FailureReason,
+			HostSaturated: record.HostSaturated,
+		}
+		if record.Attempt > 1 {
+			entry.Attempt = record.Attempt
+		}
+		if err := j.append(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply makes exp measure in the result sub directory of the run, which has the CSV file, with the trials of the run.
+// The other fields of exp, e.g. the images and the impairment profiles, are used as they are.
+func (r *retryPlan) apply(exp *experiment) error {
+	for _, s := range r.Scenarios {
+		if _, ok := exp.impairment(s.Impairment); s.Impairment != "" && !ok {
+			return fmt.Errorf("impairment %s of %s is not defined in the experiment", s.Impairment, r.Path)
+		}
+	}
+	abs, err := filepath.Abs(r.Path)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(abs)
+	exp.Output.Directory = filepath.Dir(dir)
+	exp.Output.SubDirName = filepath.Base(dir)
+	exp.Trials = r.Trials
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+func writeRetryCSV(t *testing.T, records []utils.PageLoadTimeRecord) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "run")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "pageloadtime-scenarios.csv")
+	if err := utils.WritePageLoadTimeRecordsCSV(path, records); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewRetryPlan(t *testing.T) {
+	path := writeRetryCSV(t, []utils.PageLoadTimeRecord{
+		{Domain: "a.example", URL: "https://a.example", PageLoadTime: "100", Cache: true, Dane: true, Trial: 1},
+		{Domain: "b.example", URL: "https://b.example", FailureReason: "browser-timeout", Cache: true, Dane: true, Trial: 1},
+		{Domain: "a.example", URL: "https://a.example", FailureReason: "container-error", Cache: true, Dane: true, Trial: 2, Attempt: 2},
+		{Domain: "b.example", URL: "https://b.example", PageLoadTime: "200", Cache: true, Dane: true, Trial: 2},
+	})
+	withCacheWithDane := scenario{Cache: true, DANE: true}
+
+	plan, err := newRetryPlan(path, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(plan.Failed); got != 2 {
+		t.Errorf("len(Failed) = %d, want 2", got)
+	}
+	if got := []string{plan.Domains[0].Domain, plan.Domains[1].Domain}; len(plan.Domains) != 2 || !slices.Equal(got, []string{"a.example", "b.example"}) {
+		t.Errorf("Domains = %+v", plan.Domains)
+	}
+	if !slices.Equal(plan.Scenarios, []scenario{withCacheWithDane}) {
+		t.Errorf("Scenarios = %+v", plan.Scenarios)
+	}
+	if plan.Trials != 2 {
+		t.Errorf("Trials = %d, want 2", plan.Trials)
+	}
+
+	finished := plan.finished()
+	if !finished[journalKey{Domain: "a.example", Scenario: withCacheWithDane.String(), Trial: 1}] {
+		t.Error("successful row should be finished")
+	}
+	if finished[journalKey{Domain: "b.example", Scenario: withCacheWithDane.String(), Trial: 1}] {
+		t.Error("failed row should not be finished")
+	}
+	attempts := plan.attempts()
+	if got := attempts[journalKey{Domain: "b.example", Scenario: withCacheWithDane.String(), Trial: 1}]; got != 1 {
+		t.Errorf("attempt of b.example = %d, want 1", got)
+	}
+	if got := attempts[journalKey{Domain: "a.example", Scenario: withCacheWithDane.String(), Trial: 2}]; got != 2 {
+		t.Errorf("attempt of a.example = %d, want 2", got)
+	}
+
+	plan, err = newRetryPlan(path, []string{"browser-timeout"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Failed) != 1 || plan.Failed[0].Domain != "b.example" {
+		t.Errorf("Failed with reasons = %+v", plan.Failed)
+	}
+
+	if _, err := newRetryPlan(path, nil, 0); err == nil {
+		t.Error("newRetryPlan() with no budget should fail")
+	}
+}
+
+func TestRetryPlanSeedJournal(t *testing.T) {
+	path := writeRetryCSV(t, []utils.PageLoadTimeRecord{
+		{Domain: "a.example", URL: "https://a.example", PageLoadTime: "100", Cache: true, Dane: true, Trial: 1},
+		{Domain: "b.example", URL: "https://b.example", FailureReason: "browser-timeout", Cache: true, Dane: true, Trial: 1},
+	})
+	plan, err := newRetryPlan(path, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withCacheWithDane := scenario{Cache: true, DANE: true}
+	journalPath := filepath.Join(t.TempDir(), journalFileName)
+
+	j, err := openJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a.example was journaled by the run and b.example was not.
+	if err := j.append(journalEntry{Domain: "a.example", Scenario: withCacheWithDane.String(), Cache: true, Dane: true, Trial: 1, PageLoadTime: "100"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.seedJournal(journalPath, j); err != nil {
+		t.Fatal(err)
+	}
+	// the retry of b.example succeeds at the second attempt.
+	if err := j.append(journalEntry{Domain: "b.example", Scenario: withCacheWithDane.String(), Cache: true, Dane: true, Trial: 1, PageLoadTime: "300", Attempt: 2}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	entries, err := readJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("len(entries) = %d, want 3", len(entries))
+	}
+	got := journalPageLoadTimeRecords(entries, plan.Domains, plan.Scenarios, plan.Trials)
+	want := []utils.PageLoadTimeRecord{
+		{Domain: "a.example", URL: "https://a.example", PageLoadTime: "100", Cache: true, Dane: true, Trial: 1},
+		{Domain: "b.example", URL: "https://b.example", PageLoadTime: "300", Cache: true, Dane: true, Trial: 1, Attempt: 2},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("journalPageLoadTimeRecords() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRetryPlanApply(t *testing.T) {
+	path := writeRetryCSV(t, []utils.PageLoadTimeRecord{
+		{Domain: "a.example", URL: "https://a.example", FailureReason: "browser-timeout", Cache: true, Dane: true, Trial: 3, Impairment: "lossy"},
+	})
+	plan, err := newRetryPlan(path, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := &experiment{}
+	if err := plan.apply(exp); err == nil {
+		t.Error("apply() with an undefined impairment should fail")
+	}
+	exp.ImpairmentProfiles = map[string]impairmentProfile{"lossy": {}}
+	if err := plan.apply(exp); err != nil {
+		t.Fatal(err)
+	}
+	if exp.Output.Directory != filepath.Dir(filepath.Dir(path)) || exp.Output.SubDirName != "run" {
+		t.Errorf("Output = %+v", exp.Output)
+	}
+	if exp.Trials != 3 {
+		t.Errorf("Trials = %d, want 3", exp.Trials)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ContainerRuntime is the container engine which runs unbound, letsdane and firefox-har for a measurement.
+// dockerRuntime talks to the Docker Engine API and fakeRuntime keeps everything in memory for tests.
+type ContainerRuntime interface {
+	// CreateNetwork creates a bridge network. (docker network create [network name])
+	CreateNetwork(ctx context.Context, name string) error
+	// RemoveNetwork removes a network. (docker network rm [network name])
+	RemoveNetwork(ctx context.Context, name string) error
+	// StartContainer creates and starts a container in the background. (docker run -d ...)
+	StartContainer(ctx context.Context, spec ContainerSpec) error
+	// RunContainer creates and starts a container, waits until it exits and returns its stdout. (docker run ...)
+	RunContainer(ctx context.Context, spec ContainerSpec) ([]byte, error)
+	// ContainerIP returns the IP address of a container. (docker inspect -f '{{range.NetworkSettings.Networks}}{{.IPAddress}}{{end}}' [container name])
+	ContainerIP(ctx context.Context, name string) (string, error)
+	// ExecDetached runs a command in a running container without waiting for it. (docker exec -d [container name] ...)
+	ExecDetached(ctx context.Context, name string, cmd []string) error
+	// CopyFromContainer copies a file in a container to the host. (docker cp [container name]:[src path] [dst path])
+	CopyFromContainer(ctx context.Context, name, srcPath, dstPath string) error
+	// StopContainer stops a container. (docker stop [container name])
+	StopContainer(ctx context.Context, name string) error
+	// RemoveContainer removes a stopped container. (docker rm [container name])
+	RemoveContainer(ctx context.Context, name string) error
+	// InspectImage returns the ID of a local image. (docker image inspect [image name])
+	InspectImage(ctx context.Context, image string) (ImageInfo, error)
+	// ListContainers returns the names of all containers including stopped ones. (docker ps -a --format '{{.Names}}')
+	ListContainers(ctx context.Context) ([]string, error)
+	// ListNetworks returns the names of all networks. (docker network ls --format '{{.Name}}')
+	ListNetworks(ctx context.Context) ([]string, error)
+	// ContainerStats returns the resource usage of a running container. (docker stats --no-stream [container name])
+	ContainerStats(ctx context.Context, name string) (ContainerStats, error)
+}
+
+// ImageInfo identifies the image which a container runs.
+type ImageInfo struct {
+	ID          string            `json:"id"`
+	RepoDigests []string          `json:"repoDigests,omitempty"`
+	Created     string            `json:"created,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// ContainerStats is the resource usage of a container at Read. The CPU and network counters are cumulative,
+// so the usage in an interval is the difference between two samples.
+type ContainerStats struct {
+	// Read is zero if the container is not running.
+	Read time.Time
+	// CPUUsage is the CPU time of the container and SystemCPUUsage is the CPU time of the host, both in nanoseconds.
+	CPUUsage       uint64
+	SystemCPUUsage uint64
+	OnlineCPUs     int
+	// MemoryUsage excludes the page cache like docker stats.
+	MemoryUsage uint64
+	MemoryLimit uint64
+	// NetworkRx and NetworkTx are the bytes received and sent on all interfaces.
+	NetworkRx uint64
+	NetworkTx uint64
+}
+
+type ContainerSpec struct {
+	Image   string
+	Name    string
+	Network string
+	// Cmd is passed to the entrypoint of the image.
+	Cmd []string
+	// Ports are published to random host ports, e.g. "53/udp". (docker run -p :53/udp)
+	Ports []string
+	// AutoRemove removes the container when it exits. (docker run --rm)
+	AutoRemove bool
+	// Env is the environment variables, e.g. "NETEM=delay 50000us". (docker run -e)
+	Env []string
+	// CapAdd is the Linux capabilities added to the container, e.g. NET_ADMIN. (docker run --cap-add)
+	CapAdd []string
+	// Files are written into the container before it starts, by the absolute path in the container.
+	// Unlike a bind mount, they do not have to exist on the Docker host. (docker create, docker cp and docker start)
+	Files map[string][]byte
+}
+
+// ContainerExitError is returned by RunContainer when the container exits with non-zero status.
+type ContainerExitError struct {
+	Name       string
+	StatusCode int
+	Stderr     string
+}
+
+func (e *ContainerExitError) Error() string {
+	return fmt.Sprintf("container %s exited with status %d", e.Name, e.StatusCode)
+}
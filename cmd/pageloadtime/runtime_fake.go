@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeRuntime is an in-memory ContainerRuntime. It records every call and keeps track of networks and containers,
+// so that the orchestration in collectHAR can be checked without Docker.
+type fakeRuntime struct {
+	mu         sync.Mutex
+	networks   map[string]bool
+	containers map[string]*fakeContainer
+	calls      []string
+	lastIP     int
+
+	// outputs is the stdout returned by RunContainer for each image.
+	outputs map[string][]byte
+	// failures makes a call fail. The key is "<method> <name>" or "<method>" for any name.
+	failures map[string]error
+	// onRun is called while RunContainer runs the container, if it is set.
+	onRun func(spec ContainerSpec)
+}
+
+type fakeContainer struct {
+	spec    ContainerSpec
+	ip      string
+	running bool
+	execs   [][]string
+	// stats is the number of calls of ContainerStats, which advances the counters of the container.
+	stats uint64
+}
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{
+		networks:   make(map[string]bool),
+		containers: make(map[string]*fakeContainer),
+		outputs:    make(map[string][]byte),
+		failures:   make(map[string]error),
+	}
+}
+
+// errNoSuchContainer is the error of Docker for a missing container.
+func errNoSuchContainer(name string) error {
+	return &dockerAPIError{StatusCode: http.StatusNotFound, Message: "No such container: " + name}
+}
+
+// setOutput sets the stdout of RunContainer for the image.
+func (f *fakeRuntime) setOutput(image string, output []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.outputs[image] = output
+}
+
+// failOn makes method fail with err. If name is empty, the method fails for any name.
+func (f *fakeRuntime) failOn(method, name string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[strings.TrimSpace(method+" "+name)] = err
+}
+
+// record appends the call and returns the error registered by failOn.
+func (f *fakeRuntime) record(method, name string) error {
+	f.calls = append(f.calls, method+" "+name)
+	if err, ok := f.failures[method+" "+name]; ok {
+		return err
+	}
+	return f.failures[method]
+}
+
+// Calls returns the calls in order, e.g. "StartContainer unbound-example.com-with-cache-with-dane".
+func (f *fakeRuntime) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// Leftovers returns the networks and containers which have not been removed.
+func (f *fakeRuntime) Leftovers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var leftovers []string
+	for name := range f.networks {
+		leftovers = append(leftovers, "network "+name)
+	}
+	for name := range f.containers {
+		leftovers = append(leftovers, "container "+name)
+	}
+	sort.Strings(leftovers)
+	return leftovers
+}
+
+func (f *fakeRuntime) CreateNetwork(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("CreateNetwork", name); err != nil {
+		return err
+	}
+	if f.networks[name] {
+		return fmt.Errorf("network with name %s already exists", name)
+	}
+	f.networks[name] = true
+	return nil
+}
+
+func (f *fakeRuntime) RemoveNetwork(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("RemoveNetwork", name); err != nil {
+		return err
+	}
+	if !f.networks[name] {
+		return fmt.Errorf("network %s not found", name)
+	}
+	for _, c := range f.containers {
+		if c.spec.Network == name {
+			return fmt.Errorf("network %s has active endpoints", name)
+		}
+	}
+	delete(f.networks, name)
+	return nil
+}
+
+func (f *fakeRuntime) create(spec ContainerSpec) (*fakeContainer, error) {
+	if _, ok := f.containers[spec.Name]; ok {
+		return nil, fmt.Errorf("container name %s is already in use", spec.Name)
+	}
+	if spec.Network != "" && !f.networks[spec.Network] {
+		return nil, fmt.Errorf("network %s not found", spec.Network)
+	}
+	f.lastIP++
+	c := &fakeContainer{
+		spec: spec,
+		ip:   fmt.Sprintf("172.18.0.%d", f.lastIP+1),
+	}
+	f.containers[spec.Name] = c
+	return c, nil
+}
+
+func (f *fakeRuntime) StartContainer(_ context.Context, spec ContainerSpec) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("StartContainer", spec.Name); err != nil {
+		return err
+	}
+	c, err := f.create(spec)
+	if err != nil {
+		return err
+	}
+	c.running = true
+	return nil
+}
+
+// RunContainer runs onRun as the container. If ctx is canceled by then, the container is left running like Docker,
+// unless it is removed automatically.
+func (f *fakeRuntime) RunContainer(ctx context.Context, spec ContainerSpec) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("RunContainer", spec.Name); err != nil {
+		return nil, err
+	}
+	c, err := f.create(spec)
+	if err != nil {
+		return nil, err
+	}
+	// the lock is released while the container runs, so that the other containers can be used meanwhile.
+	if f.onRun != nil {
+		f.mu.Unlock()
+		f.onRun(spec)
+		f.mu.Lock()
+	}
+	if spec.AutoRemove {
+		delete(f.containers, spec.Name)
+	}
+	if err := ctx.Err(); err != nil {
+		c.running = true
+		return nil, err
+	}
+	return f.outputs[spec.Image], nil
+}
+
+func (f *fakeRuntime) ContainerIP(_ context.Context, name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ContainerIP", name); err != nil {
+		return "", err
+	}
+	c, ok := f.containers[name]
+	if !ok {
+		return "", errNoSuchContainer(name)
+	}
+	return c.ip, nil
+}
+
+func (f *fakeRuntime) ExecDetached(_ context.Context, name string, cmd []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ExecDetached", name); err != nil {
+		return err
+	}
+	c, ok := f.containers[name]
+	if !ok || !c.running {
+		return fmt.Errorf("container %s is not running", name)
+	}
+	c.execs = append(c.execs, cmd)
+	return nil
+}
+
+func (f *fakeRuntime) CopyFromContainer(_ context.Context, name, srcPath, dstPath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("CopyFromContainer", name); err != nil {
+		return err
+	}
+	c, ok := f.containers[name]
+	if !ok {
+		return errNoSuchContainer(name)
+	}
+	// the files of the spec are copied as they are, and any other file contains its path.
+	if content, ok := c.spec.Files[srcPath]; ok {
+		return os.WriteFile(dstPath, content, 0644)
+	}
+	return os.WriteFile(dstPath, []byte(srcPath), 0644)
+}
+
+func (f *fakeRuntime) StopContainer(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("StopContainer", name); err != nil {
+		return err
+	}
+	c, ok := f.containers[name]
+	if !ok {
+		return errNoSuchContainer(name)
+	}
+	c.running = false
+	if c.spec.AutoRemove {
+		delete(f.containers, name)
+	}
+	return nil
+}
+
+func (f *fakeRuntime) RemoveContainer(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("RemoveContainer", name); err != nil {
+		return err
+	}
+	c, ok := f.containers[name]
+	if !ok {
+		return errNoSuchContainer(name)
+	}
+	if c.running {
+		return fmt.Errorf("container %s is running", name)
+	}
+	delete(f.containers, name)
+	return nil
+}
+
+func (f *fakeRuntime) ListContainers(_ context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ListContainers", ""); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(f.containers))
+	for name := range f.containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *fakeRuntime) ListNetworks(_ context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("ListNetworks", ""); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(f.networks))
+	for name := range f.networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// InspectImage returns a fake ID derived from the image name. failOn("InspectImage", image, err) makes an image missing.
+func (f *fakeRuntime) InspectImage(_ context.Context, image string) (ImageInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("InspectImage", image); err != nil {
+		return ImageInfo{}, err
+	}
+	return ImageInfo{ID: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(image)))}, nil
+}
+
+// ContainerStats returns counters which advance by 10% of a CPU and 1000 bytes of network I/O per call.
+// It is not recorded in Calls, because the resource sampler calls it at any time during a measurement.
+func (f *fakeRuntime) ContainerStats(_ context.Context, name string) (ContainerStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err, ok := f.failures["ContainerStats "+name]; ok {
+		return ContainerStats{}, err
+	}
+	c, ok := f.containers[name]
+	if !ok {
+		return ContainerStats{}, errNoSuchContainer(name)
+	}
+	if !c.running {
+		return ContainerStats{}, nil
+	}
+	c.stats++
+	return ContainerStats{
+		Read:           time.Now(),
+		CPUUsage:       c.stats * 100_000_000,
+		SystemCPUUsage: c.stats * 1_000_000_000,
+		OnlineCPUs:     1,
+		MemoryUsage:    1 << 20,
+		MemoryLimit:    1 << 30,
+		NetworkRx:      c.stats * 1000,
+		NetworkTx:      c.stats * 1000,
+	}, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// scenario is a combination of DNS cache, DANE, DNSSEC validation, the resolver of letsdane, the visit of Firefox
+// and network impairment to measure.
+type scenario struct {
+	Cache bool `json:"cache"`
+	DANE  bool `json:"dane"`
+	// WithoutDNSSEC disables DNSSEC validation in unbound, and letsdane only checks the AD bit of the answers (-skip-dnssec).
+	// Without the AD bit, the TLSA records are insecure and letsdane does not validate the certificate by DANE.
+	WithoutDNSSEC bool `json:"withoutDNSSEC,omitempty"`
+	// Resolver is how letsdane resolves the TLSA records. It is empty without DANE or if letsdane.args decide it.
+	Resolver resolverMode `json:"resolver,omitempty"`
+	// RepeatVisit loads the page twice in the same Firefox profile and measures the second load,
+	// which reuses the HTTP cache, the TLS sessions and the DNS cache of Firefox.
+	RepeatVisit bool `json:"repeatVisit,omitempty"`
+	// Impairment is the name of the network impairment profile. It is empty without impairment.
+	Impairment string `json:"impairment,omitempty"`
+}
+
+// allScenarios is the full matrix of measurement patterns, in the order they are measured for each domain.
+var allScenarios = []scenario{
+	{Cache: false, DANE: false}, // withoutCacheWithoutDane
+	{Cache: true, DANE: false},  // withCacheWithoutDane
+	{Cache: false, DANE: true},  // withoutCacheWithDane
+	{Cache: true, DANE: true},   // withCacheWithDane
+}
+
+// allScenariosWithoutDNSSEC is allScenarios with DNSSEC validation disabled in unbound.
+// They are not in "all", so that the existing experiments measure the same scenarios.
+var allScenariosWithoutDNSSEC = []scenario{
+	{Cache: false, DANE: false, WithoutDNSSEC: true}, // withoutCacheWithoutDaneWithoutDNSSEC
+	{Cache: true, DANE: false, WithoutDNSSEC: true},  // withCacheWithoutDaneWithoutDNSSEC
+	{Cache: false, DANE: true, WithoutDNSSEC: true},  // withoutCacheWithDaneWithoutDNSSEC
+	{Cache: true, DANE: true, WithoutDNSSEC: true},   // withCacheWithDaneWithoutDNSSEC
+}
+
+// scenarioGroups are the names which select several scenarios in -scenarios.
+var scenarioGroups = map[string][]scenario{
+	"all":                allScenarios,
+	"all-without-dnssec": allScenariosWithoutDNSSEC,
+}
+
+// knownScenarios are the scenarios which can be selected by their measurement pattern.
+var knownScenarios = append(append([]scenario{}, allScenarios...), allScenariosWithoutDNSSEC...)
+
+// resolverMode is how letsdane resolves and validates the TLSA records with unbound.
+type resolverMode string
+
+const (
+	// resolverStub trusts the AD bit of the answers of unbound. It is resolver.Stub of letsdane with -skip-dnssec.
+	resolverStub resolverMode = "stub"
+	// resolverRecursive validates the answers in letsdane. It is resolver.Recursive of letsdane, whose libunbound forwards to unbound.
+	resolverRecursive resolverMode = "recursive"
+)
+
+var resolverModes = []resolverMode{resolverStub, resolverRecursive}
+
+// visit is which load of the page by Firefox is measured.
+type visit string
+
+const (
+	// firstVisit measures the first load with the empty profile of Firefox.
+	firstVisit visit = "first"
+	// repeatVisit measures the second load in the same profile of Firefox.
+	repeatVisit visit = "repeat"
+)
+
+var visits = []visit{firstVisit, repeatVisit}
+
+func (s scenario) pattern() measurementPattern {
+	return measurementPattern(strings.TrimPrefix(measurementPatternSuffix(s.Cache, s.DANE, s.WithoutDNSSEC), "-"))
+}
+
+// String is the measurement pattern followed by the resolver of letsdane, the repeat visit and the impairment,
+// e.g. with-cache-with-dane-rtt50, with-cache-with-dane-without-dnssec-rtt50, with-cache-with-dane-recursive-resolver-rtt50
+// or with-cache-with-dane-repeat-visit-rtt50.
+// It is used in the measurement ID and the names of the result files.
+func (s scenario) String() string {
+	name := string(s.pattern())
+	if s.Resolver != "" {
+		name += "-" + string(s.Resolver) + "-resolver"
+	}
+	if s.RepeatVisit {
+		name += "-repeat-visit"
+	}
+	if s.Impairment != "" {
+		name += "-" + s.Impairment
+	}
+	return name
+}
+
+// parseScenarios parses the value of -scenarios flag.
+// The value is comma separated measurement patterns, e.g. "without-cache-without-dane,with-cache-with-dane-without-dnssec".
+// "all" selects the four patterns with DNSSEC validation and "all-without-dnssec" the four patterns without it.
+func parseScenarios(value string) ([]scenario, error) {
+	var scenarios []scenario
+	seen := make(map[scenario]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		candidates, isGroup := scenarioGroups[name]
+		if !isGroup {
+			candidates = knownScenarios
+		}
+		var found bool
+		for _, s := range candidates {
+			if !isGroup && string(s.pattern()) != name {
+				continue
+			}
+			found = true
+			if !seen[s] {
+				scenarios = append(scenarios, s)
+				seen[s] = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown scenario %q: must be one of %s, all or all-without-dnssec", name, strings.Join(scenarioNames(knownScenarios), ", "))
+		}
+	}
+
+	if len(scenarios) == 0 {
+		return nil, fmt.Errorf("no scenario is specified")
+	}
+	return scenarios, nil
+}
+
+func scenarioNames(scenarios []scenario) []string {
+	names := make([]string, 0, len(scenarios))
+	for _, s := range scenarios {
+		names = append(names, s.String())
+	}
+	return names
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScenarios(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			value: "all",
+			want:  []string{"without-cache-without-dane", "with-cache-without-dane", "without-cache-with-dane", "with-cache-with-dane"},
+		},
+		{
+			value: "with-cache-with-dane, without-cache-without-dane",
+			want:  []string{"with-cache-with-dane", "without-cache-without-dane"},
+		},
+		{
+			value: "with-cache-with-dane,with-cache-with-dane",
+			want:  []string{"with-cache-with-dane"},
+		},
+		{
+			value: "all-without-dnssec",
+			want:  []string{"without-cache-without-dane-without-dnssec", "with-cache-without-dane-without-dnssec", "without-cache-with-dane-without-dnssec", "with-cache-with-dane-without-dnssec"},
+		},
+		{
+			value: "with-cache-with-dane,with-cache-with-dane-without-dnssec",
+			want:  []string{"with-cache-with-dane", "with-cache-with-dane-without-dnssec"},
+		},
+		{value: "with-cache", wantErr: true},
+		{value: ",", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseScenarios(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseScenarios() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if names := scenarioNames(got); !tt.wantErr && !slices.Equal(names, tt.want) {
+				t.Errorf("parseScenarios() = %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestScenarioPattern(t *testing.T) {
+	for _, s := range knownScenarios {
+		if got, want := "-"+string(s.pattern()), measurementPatternSuffix(s.Cache, s.DANE, s.WithoutDNSSEC); got != want {
+			t.Errorf("pattern of %+v = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestScenarioListResolverModes(t *testing.T) {
+	exp := defaultExperiment(time.Now())
+	exp.Scenarios = []string{"without-cache-without-dane", "with-cache-with-dane"}
+	exp.Impairments = []string{"none", "rtt50"}
+	exp.Letsdane.ResolverModes = []string{"stub", "recursive"}
+
+	scenarios, err := exp.scenarioList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// letsdane does not run without DANE, so the resolver is not measured.
+	want := []string{
+		"without-cache-without-dane",
+		"with-cache-with-dane-stub-resolver",
+		"with-cache-with-dane-recursive-resolver",
+		"without-cache-without-dane-rtt50",
+		"with-cache-with-dane-stub-resolver-rtt50",
+		"with-cache-with-dane-recursive-resolver-rtt50",
+	}
+	if names := scenarioNames(scenarios); !slices.Equal(names, want) {
+		t.Errorf("scenarioList() = %q, want %q", names, want)
+	}
+
+	// -skip-dnssec is added or removed by the resolver in both args.
+	args, fillCacheArgs := exp.letsdaneArgs(scenarios[2])
+	if slices.Contains(args, "-skip-dnssec") || slices.Contains(fillCacheArgs, "-skip-dnssec") {
+		t.Errorf("args of recursive = %q, %q, want without -skip-dnssec", args, fillCacheArgs)
+	}
+	args, fillCacheArgs = exp.letsdaneArgs(scenarios[1])
+	if !slices.Contains(args, "-skip-dnssec") || !slices.Contains(fillCacheArgs, "-skip-dnssec") {
+		t.Errorf("args of stub = %q, %q, want -skip-dnssec", args, fillCacheArgs)
+	}
+	if !slices.Contains(exp.Letsdane.Args, "-skip-dnssec") || slices.Contains(exp.Letsdane.FillCacheArgs, "-skip-dnssec") {
+		t.Errorf("args of the experiment are modified: %q, %q", exp.Letsdane.Args, exp.Letsdane.FillCacheArgs)
+	}
+
+	for _, modes := range [][]string{{"forwarder"}, {"stub", "stub"}} {
+		exp.Letsdane.ResolverModes = modes
+		if err := exp.validate(); err == nil || !strings.Contains(err.Error(), "letsdane.resolverModes:") {
+			t.Errorf("validate() with resolvers %q = %v, want an error of letsdane.resolverModes", modes, err)
+		}
+	}
+	// unbound does not validate in the scenarios without DNSSEC, so letsdane always trusts the AD bit.
+	exp.Scenarios = []string{"all-without-dnssec"}
+	exp.Letsdane.ResolverModes = []string{"recursive"}
+	if err := exp.validate(); err == nil || !strings.Contains(err.Error(), "letsdane.resolverModes:") {
+		t.Errorf("validate() = %v, want an error of recursive without DNSSEC", err)
+	}
+}
+
+func TestScenarioListVisits(t *testing.T) {
+	exp := defaultExperiment(time.Now())
+	exp.Scenarios = []string{"without-cache-without-dane", "with-cache-with-dane"}
+	exp.Firefox.Visits = []string{"first", "repeat"}
+
+	scenarios, err := exp.scenarioList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"without-cache-without-dane", "without-cache-without-dane-repeat-visit", "with-cache-with-dane", "with-cache-with-dane-repeat-visit"}
+	if names := scenarioNames(scenarios); !slices.Equal(names, want) {
+		t.Errorf("scenarioList() = %q, want %q", names, want)
+	}
+
+	for _, v := range [][]string{{"second"}, {"repeat", "repeat"}} {
+		exp.Firefox.Visits = v
+		if err := exp.validate(); err == nil || !strings.Contains(err.Error(), "firefox.visits:") {
+			t.Errorf("validate() with visits %q = %v, want an error of firefox.visits", v, err)
+		}
+	}
+	// the http probe has no browser cache.
+	exp.Firefox.Visits = []string{"repeat"}
+	exp.Probe = probeHTTP
+	if err := exp.validate(); err == nil || !strings.Contains(err.Error(), "firefox.visits:") {
+		t.Errorf("validate() with probe %s = %v, want an error of firefox.visits", probeHTTP, err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule decides when the daemon starts the runs.
+type schedule interface {
+	// next returns the first time after t to start a run.
+	next(t time.Time) time.Time
+}
+
+// parseSchedule parses an interval (e.g. 6h or @every 6h), a descriptor (@hourly, @daily, @weekly or @monthly)
+// or a cron expression of 5 fields: minute, hour, day of month, month and day of week (e.g. 0 */6 * * *).
+func parseSchedule(expr string) (schedule, error) {
+	expr = strings.TrimSpace(expr)
+	switch expr {
+	case "@hourly":
+		expr = "0 * * * *"
+	case "@daily", "@midnight":
+		expr = "0 0 * * *"
+	case "@weekly":
+		expr = "0 0 * * 0"
+	case "@monthly":
+		expr = "0 0 1 * *"
+	}
+	interval := strings.TrimPrefix(expr, "@every ")
+	if d, err := time.ParseDuration(strings.TrimSpace(interval)); err == nil {
+		if d < time.Minute {
+			return nil, fmt.Errorf("interval of schedule %q must be at least 1m", expr)
+		}
+		return intervalSchedule(d), nil
+	} else if interval != expr {
+		return nil, fmt.Errorf("invalid interval of schedule %q: %w", expr, err)
+	}
+	return parseCron(expr)
+}
+
+// intervalSchedule starts a run every interval after the previous start.
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule is a cron expression. Each field is the set of the values which match.
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	// domStar and dowStar are true if the field is *. As in cron, if neither is *, a day matches either of them.
+	domStar, dowStar bool
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields: minute hour day-of-month month day-of-week", expr)
+	}
+	var errs []error
+	parse := func(field, name string, min, max int) map[int]bool {
+		values, err := parseCronField(field, min, max)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s of cron expression %q: %w", name, expr, err))
+		}
+		return values
+	}
+	s := &cronSchedule{
+		minute:  parse(fields[0], "minute", 0, 59),
+		hour:    parse(fields[1], "hour", 0, 23),
+		dom:     parse(fields[2], "day of month", 1, 31),
+		month:   parse(fields[3], "month", 1, 12),
+		dow:     parse(fields[4], "day of week", 0, 7),
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	// 7 is also Sunday.
+	if s.dow[7] {
+		s.dow[0] = true
+	}
+	if s.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return s, nil
+}
+
+// parseCronField parses a comma separated list of *, a value or a range (a-b), each optionally with a step (/n).
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step %q", part)
+			}
+		}
+		first, last := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if first, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			last = first
+			if isRange {
+				if last, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			} else if hasStep {
+				last = max
+			}
+		}
+		if first < min || last > max || first > last {
+			return nil, fmt.Errorf("%q is out of %d-%d", part, min, max)
+		}
+		for v := first; v <= last; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func (s *cronSchedule) next(t time.Time) time.Time {
+	// the next minute which matches, found within 5 years as Feb 29 matches only in leap years.
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case !s.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	// e.g. 0 0 30 2 *, which never matches.
+	return time.Time{}
+}
+
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2024, 6, 1, 10, 30, 15, 0, time.UTC) // Saturday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"6h", now.Add(6 * time.Hour)},
+		{"@every 90m", now.Add(90 * time.Minute)},
+		{"@hourly", time.Date(2024, 6, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 6, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 */6 * * *", time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 6, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * 1-5", time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)},
+		// either the day of month or the day of week matches.
+		{"0 0 15 * 1", time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		s, err := parseSchedule(test.expr)
+		if err != nil {
+			t.Errorf("parseSchedule(%q) = %v", test.expr, err)
+			continue
+		}
+		if got := s.next(now); !got.Equal(test.want) {
+			t.Errorf("parseSchedule(%q).next(%s) = %s, want %s", test.expr, now, got, test.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"10s",
+		"@every soon",
+		"0 * * *",
+		"60 * * * *",
+		"0 24 * * *",
+		"0 0 0 * *",
+		"0 0 * 13 *",
+		"0 0 * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"0 0 30 2 *",
+	} {
+		if _, err := parseSchedule(expr); err == nil {
+			t.Errorf("parseSchedule(%q) should fail", expr)
+		}
+	}
+}
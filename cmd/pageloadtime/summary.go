@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+// quantile returns the q-th quantile of sorted values by linear interpolation between the closest ranks,
+// which is the same as the default of numpy.quantile and R (type 7).
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	pos := q * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// stdDev returns the sample standard deviation. It is 0 if there is only one value.
+func stdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := mean(values)
+	var sum float64
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// summarizePageLoadTime calculates the statistics of the page load time over the trials of each domain.
+// Failed trials, whose page load time is empty, are counted in Trials but not in the statistics.
+func summarizePageLoadTime(records []utils.PageLoadTimeRecord) []utils.PageLoadTimeSummary {
+	type key struct {
+		domain string
+		cache  bool
+		dane   bool
+	}
+	trials := make(map[key]int)
+	values := make(map[key][]float64)
+	var keys []key
+	for _, record := range records {
+		k := key{domain: record.Domain, cache: record.Cache, dane: record.Dane}
+		if _, ok := trials[k]; !ok {
+			keys = append(keys, k)
+		}
+		trials[k]++
+
+		if record.PageLoadTime == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(record.PageLoadTime, 64)
+		if err != nil {
+			logger.Warn("invalid page load time: " + record.PageLoadTime)
+			continue
+		}
+		values[k] = append(values[k], v)
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].domain < keys[j].domain
+	})
+
+	summaries := make([]utils.PageLoadTimeSummary, 0, len(keys))
+	for _, k := range keys {
+		summary := utils.PageLoadTimeSummary{
+			Domain:  k.domain,
+			Cache:   k.cache,
+			Dane:    k.dane,
+			Trials:  trials[k],
+			Success: len(values[k]),
+		}
+		if v := values[k]; len(v) > 0 {
+			sort.Float64s(v)
+			summary.Median = quantile(v, 0.5)
+			summary.Mean = mean(v)
+			summary.StdDev = stdDev(v)
+			summary.Min = v[0]
+			summary.Max = v[len(v)-1]
+			summary.IQR = quantile(v, 0.75) - quantile(v, 0.25)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+func TestSummarizePageLoadTime(t *testing.T) {
+	records := []utils.PageLoadTimeRecord{
+		{Domain: "example.com", PageLoadTime: "400", Cache: true, Dane: true, Trial: 1},
+		{Domain: "example.com", PageLoadTime: "100", Cache: true, Dane: true, Trial: 2},
+		{Domain: "example.com", PageLoadTime: "", Cache: true, Dane: true, Trial: 3},
+		{Domain: "example.com", PageLoadTime: "200", Cache: true, Dane: true, Trial: 4},
+		{Domain: "example.com", PageLoadTime: "300", Cache: true, Dane: true, Trial: 5},
+		{Domain: "failed.example", PageLoadTime: "", Cache: true, Dane: true, Trial: 1},
+		{Domain: "failed.example", PageLoadTime: "", Cache: true, Dane: true, Trial: 2},
+	}
+
+	got := summarizePageLoadTime(records)
+	if len(got) != 2 {
+		t.Fatalf("len(summaries) = %d, want 2", len(got))
+	}
+
+	s := got[0]
+	if s.Domain != "example.com" || s.Trials != 5 || s.Success != 4 {
+		t.Errorf("summary = %+v", s)
+	}
+	floatEquals := func(name string, got, want float64) {
+		t.Helper()
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s = %f, want %f", name, got, want)
+		}
+	}
+	floatEquals("median", s.Median, 250)
+	floatEquals("mean", s.Mean, 250)
+	floatEquals("stddev", s.StdDev, math.Sqrt(50000.0/3))
+	floatEquals("min", s.Min, 100)
+	floatEquals("max", s.Max, 400)
+	// Q1 = 175, Q3 = 325
+	floatEquals("iqr", s.IQR, 150)
+
+	if failed := got[1]; failed.Domain != "failed.example" || failed.Trials != 2 || failed.Success != 0 {
+		t.Errorf("summary = %+v", failed)
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	values := []float64{1, 2, 3, 4}
+	for q, want := range map[float64]float64{0: 1, 0.25: 1.75, 0.5: 2.5, 1: 4} {
+		if got := quantile(values, q); got != want {
+			t.Errorf("quantile(%v) = %v, want %v", q, got, want)
+		}
+	}
+	if got := stdDev([]float64{42}); got != 0 {
+		t.Errorf("stdDev of one value = %v, want 0", got)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// unboundConfPath is where the unbound image reads unbound.conf. pageloadtime writes it before unbound starts.
+const unboundConfPath = "/usr/local/etc/unbound/unbound.conf"
+
+// unboundConfig is the configuration of unbound, which is rendered into unbound.conf of each unbound container.
+// The cache is on or off by the TTLs, so that one image serves every scenario.
+//
+// e.g. a cache which keeps the records for their own TTL, without DNSSEC validation:
+//
+//	cacheMinTTL: 0
+//	cacheMaxTTL: 86400
+//	cacheMaxNegativeTTL: 3600
+//	dnssecValidation: false
+type unboundConfig struct {
+	// CacheMinTTL and CacheMaxTTL bound the TTL of the cached records in seconds. CacheMaxTTL 0 disables the cache,
+	// and CacheMinTTL 86400 keeps every record until the end of the measurement.
+	CacheMinTTL int `json:"cacheMinTTL" yaml:"cacheMinTTL"`
+	CacheMaxTTL int `json:"cacheMaxTTL" yaml:"cacheMaxTTL"`
+	// CacheMaxNegativeTTL bounds the TTL of the cached negative answers (NXDOMAIN and NODATA) in seconds.
+	CacheMaxNegativeTTL int `json:"cacheMaxNegativeTTL" yaml:"cacheMaxNegativeTTL"`
+	// Prefetch fetches the cached records again before they expire.
+	Prefetch bool `json:"prefetch" yaml:"prefetch"`
+	// DNSSECValidation validates the answers with the root trust anchor. Without it, unbound only iterates.
+	DNSSECValidation bool `json:"dnssecValidation" yaml:"dnssecValidation"`
+	// QNAMEMinimisation sends only the labels which each authoritative server needs. (RFC 9156)
+	QNAMEMinimisation bool `json:"qnameMinimisation" yaml:"qnameMinimisation"`
+	// EDNSBufferSize is the EDNS buffer size advertised to the authoritative servers in bytes.
+	EDNSBufferSize int `json:"ednsBufferSize" yaml:"ednsBufferSize"`
+	// StatisticsInterval prints the statistics to the log every this many seconds. 0 disables it.
+	StatisticsInterval int `json:"statisticsInterval" yaml:"statisticsInterval"`
+	// StatisticsCumulative keeps the statistics after they are printed instead of clearing them.
+	StatisticsCumulative bool `json:"statisticsCumulative" yaml:"statisticsCumulative"`
+	// ExtendedStatistics counts the query types, answer codes and status, which unbound-control stats prints.
+	ExtendedStatistics bool `json:"extendedStatistics" yaml:"extendedStatistics"`
+}
+
+// defaultUnboundWithCache and defaultUnboundWithoutCache are the same as the start scripts of the images
+// unbound:with-cache and unbound:without-cache, which were used before the configuration was rendered by pageloadtime.
+var (
+	defaultUnboundWithCache = unboundConfig{
+		CacheMinTTL:         86400,
+		CacheMaxTTL:         86400,
+		CacheMaxNegativeTTL: 3600,
+		DNSSECValidation:    true,
+		QNAMEMinimisation:   true,
+		EDNSBufferSize:      4096,
+		ExtendedStatistics:  true,
+	}
+	defaultUnboundWithoutCache = unboundConfig{
+		CacheMinTTL:         0,
+		CacheMaxTTL:         0,
+		CacheMaxNegativeTTL: 3600,
+		DNSSECValidation:    true,
+		QNAMEMinimisation:   true,
+		EDNSBufferSize:      4096,
+	}
+)
+
+// validate returns the problems of the configuration, which are prefixed by field, e.g. unbound.withCache.
+func (c unboundConfig) validate(field string) []error {
+	var errs []error
+	if c.CacheMinTTL < 0 {
+		errs = append(errs, fmt.Errorf("%s.cacheMinTTL: must be 0 or more, got %d", field, c.CacheMinTTL))
+	}
+	if c.CacheMaxTTL < 0 {
+		errs = append(errs, fmt.Errorf("%s.cacheMaxTTL: must be 0 or more, got %d", field, c.CacheMaxTTL))
+	}
+	if c.CacheMinTTL > c.CacheMaxTTL {
+		errs = append(errs, fmt.Errorf("%s.cacheMinTTL: must be cacheMaxTTL (%d) or less, got %d", field, c.CacheMaxTTL, c.CacheMinTTL))
+	}
+	if c.CacheMaxNegativeTTL < 0 {
+		errs = append(errs, fmt.Errorf("%s.cacheMaxNegativeTTL: must be 0 or more, got %d", field, c.CacheMaxNegativeTTL))
+	}
+	if c.StatisticsInterval < 0 {
+		errs = append(errs, fmt.Errorf("%s.statisticsInterval: must be 0 or more, got %d", field, c.StatisticsInterval))
+	}
+	if c.EDNSBufferSize < 512 || c.EDNSBufferSize > 65535 {
+		errs = append(errs, fmt.Errorf("%s.ednsBufferSize: must be from 512 to 65535, got %d", field, c.EDNSBufferSize))
+	}
+	return errs
+}
+
+// unboundConfTemplate is unbound.conf of the unbound container. See unbound.conf(5).
+var unboundConfTemplate = template.Must(template.New("unbound.conf").Funcs(template.FuncMap{
+	"yesno": func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	},
+}).Parse(`# rendered by pageloadtime. see cmd/pageloadtime/unbound.go
+include: "/usr/local/etc/unbound/conf.d/*.conf"
+
+server:
+	verbosity: 0
+	num-threads: 1
+	interface: 0.0.0.0
+	access-control: 0.0.0.0/0 allow
+	do-ip4: yes
+	do-ip6: yes
+	do-udp: yes
+	do-tcp: yes
+	do-daemonize: no
+	username: "unbound"
+	logfile: ""
+	use-syslog: no
+	log-time-ascii: yes
+	log-queries: yes
+	root-hints: "/usr/local/etc/unbound/root.hints"
+	hide-identity: no
+	hide-version: no
+	statistics-interval: {{.StatisticsInterval}}
+	statistics-cumulative: {{yesno .StatisticsCumulative}}
+	extended-statistics: {{yesno .ExtendedStatistics}}
+
+	msg-cache-size: 4m
+	rrset-cache-size: 4m
+	cache-min-ttl: {{.CacheMinTTL}}
+	cache-max-ttl: {{.CacheMaxTTL}}
+	cache-max-negative-ttl: {{.CacheMaxNegativeTTL}}
+	prefetch: {{yesno .Prefetch}}
+	qname-minimisation: {{yesno .QNAMEMinimisation}}
+	edns-buffer-size: {{.EDNSBufferSize}}
+{{- if .DNSSECValidation}}
+	module-config: "validator iterator"
+	auto-trust-anchor-file: "/usr/local/etc/unbound/root.key"
+{{- else}}
+	module-config: "iterator"
+{{- end}}
+
+remote-control:
+	control-enable: yes
+	control-interface: 0.0.0.0
+	control-interface: ::0
+	control-port: 8953
+	server-key-file: "/usr/local/etc/unbound/unbound_server.key"
+	server-cert-file: "/usr/local/etc/unbound/unbound_server.pem"
+	control-key-file: "/usr/local/etc/unbound/unbound_control.key"
+	control-cert-file: "/usr/local/etc/unbound/unbound_control.pem"
+`))
+
+// render returns unbound.conf of the configuration.
+func (c unboundConfig) render() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := unboundConfTemplate.Execute(&buf, c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
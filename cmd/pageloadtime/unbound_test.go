@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+func TestUnboundConfigRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  unboundConfig
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "with cache",
+			config: defaultUnboundWithCache,
+			want: []string{
+				"\tcache-min-ttl: 86400\n",
+				"\tcache-max-ttl: 86400\n",
+				"\tcache-max-negative-ttl: 3600\n",
+				"\tprefetch: no\n",
+				"\tqname-minimisation: yes\n",
+				"\tedns-buffer-size: 4096\n",
+				"\tmodule-config: \"validator iterator\"\n",
+				"\tauto-trust-anchor-file: \"/usr/local/etc/unbound/root.key\"\n",
+				"include: \"/usr/local/etc/unbound/conf.d/*.conf\"\n",
+				"\tstatistics-interval: 0\n",
+				"\tstatistics-cumulative: no\n",
+				"\textended-statistics: yes\n",
+			},
+		},
+		{
+			name: "partial cache without validation",
+			config: unboundConfig{
+				CacheMaxTTL:          300,
+				CacheMaxNegativeTTL:  60,
+				Prefetch:             true,
+				EDNSBufferSize:       1232,
+				StatisticsInterval:   60,
+				StatisticsCumulative: true,
+			},
+			want: []string{
+				"\tcache-min-ttl: 0\n",
+				"\tcache-max-ttl: 300\n",
+				"\tcache-max-negative-ttl: 60\n",
+				"\tprefetch: yes\n",
+				"\tqname-minimisation: no\n",
+				"\tedns-buffer-size: 1232\n",
+				"\tmodule-config: \"iterator\"\n",
+				"\tstatistics-interval: 60\n",
+				"\tstatistics-cumulative: yes\n",
+				"\textended-statistics: no\n",
+			},
+			notWant: []string{"trust-anchor"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := tt.config.render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(conf), want) {
+					t.Errorf("unbound.conf does not contain %q:\n%s", want, conf)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(string(conf), notWant) {
+					t.Errorf("unbound.conf contains %q:\n%s", notWant, conf)
+				}
+			}
+		})
+	}
+}
+
+func TestUnboundConfigValidate(t *testing.T) {
+	if errs := defaultUnboundWithoutCache.validate("unbound.withoutCache"); len(errs) != 0 {
+		t.Errorf("validate() = %v, want none", errs)
+	}
+	config := unboundConfig{CacheMinTTL: 600, CacheMaxTTL: 60, CacheMaxNegativeTTL: -1, EDNSBufferSize: 100, StatisticsInterval: -1}
+	errs := config.validate("unbound.withCache")
+	if len(errs) != 4 {
+		t.Fatalf("validate() = %v, want 4 errors", errs)
+	}
+	for _, want := range []string{"unbound.withCache.cacheMinTTL", "unbound.withCache.cacheMaxNegativeTTL", "unbound.withCache.ednsBufferSize", "unbound.withCache.statisticsInterval"} {
+		found := false
+		for _, err := range errs {
+			found = found || strings.HasPrefix(err.Error(), want+":")
+		}
+		if !found {
+			t.Errorf("validate() = %v, want an error of %s", errs, want)
+		}
+	}
+}
+
+func TestCollectHARWritesUnboundConf(t *testing.T) {
+	dir := t.TempDir()
+	exp := defaultExperiment(time.Now())
+	exp.Unbound.WithCache.CacheMaxTTL = 90000
+	rt := newFakeRuntime()
+	rt.setOutput(firefoxHARImageName, []byte(`{"log":{}}`))
+
+	record := utils.Record{Domain: "example.com"}
+	s := scenario{Cache: true}
+	opts := measurementCommandOptions(exp, record, s, trialMeasurementID(record, s, 1, 1), dir)
+	// unbound is running while firefox loads the page.
+	confPath := filepath.Join(dir, "unbound.conf")
+	rt.onRun = func(spec ContainerSpec) {
+		if err := rt.CopyFromContainer(context.Background(), opts.UnboundDockerRunOpts.ContainerName, unboundConfPath, confPath); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := collectHAR(context.Background(), rt, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := os.ReadFile(confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(conf), "cache-max-ttl: 90000") {
+		t.Errorf("unbound.conf is not rendered from unbound.withCache:\n%s", conf)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// errLeaseGone is returned by the coordinator for a lease which expired or was given up, and when all measurements are finished.
+var errLeaseGone = errors.New("lease is gone")
+
+// workerCommand is `pageloadtime worker`, which runs the measurements handed out by a coordinator (pageloadtime -coordinator-addr).
+// It exits when the coordinator has no more measurements.
+//
+// go run . worker -coordinator http://10.0.0.1:9200 -concurrency 20
+func workerCommand(args []string) error {
+	hostname, _ := os.Hostname()
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	coordinatorURL := flags.String("coordinator", "", "URL of the coordinator, e.g. http://10.0.0.1:9200")
+	concurrency := flags.Int("concurrency", 20, "number of measurements to run at the same time")
+	dockerHost := flags.String("docker-host", os.Getenv("DOCKER_HOST"), "docker daemon socket. if empty, "+defaultDockerHost+" is used")
+	workDir := flags.String("workdir", filepath.Join(os.TempDir(), "pageloadtime-worker"), "directory to write the results of a measurement to before uploading them")
+	name := flags.String("name", hostname, "name of the worker in the logs of the coordinator")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *coordinatorURL == "" {
+		return errors.New("-coordinator is required")
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("-concurrency must be at least 1: %d", *concurrency)
+	}
+
+	rt, err := newDockerRuntime(*dockerHost)
+	if err != nil {
+		return err
+	}
+
+	// on SIGINT or SIGTERM, the running measurements are aborted and handed back to the coordinator.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w := &worker{
+		coordinator:  strings.TrimSuffix(*coordinatorURL, "/"),
+		name:         *name,
+		workDir:      *workDir,
+		rt:           rt,
+		client:       http.DefaultClient,
+		pollInterval: time.Second,
+	}
+	return w.run(ctx, *concurrency)
+}
+
+// worker leases the measurements from the coordinator, runs them on its own container runtime
+// and uploads their results to the coordinator.
+type worker struct {
+	// coordinator is the base URL of the coordinator without the trailing slash.
+	coordinator string
+	name        string
+	workDir     string
+	rt          ContainerRuntime
+	client      *http.Client
+	// pollInterval is how long to wait for a measurement when all of them are leased.
+	pollInterval time.Duration
+}
+
+// run measures with concurrency goroutines until the coordinator has no more measurements or ctx is done.
+func (w *worker) run(ctx context.Context, concurrency int) error {
+	exp := &experiment{}
+	if err := w.call(ctx, http.MethodGet, "/experiment", nil, exp); err != nil {
+		return fmt.Errorf("failed to get the experiment from the coordinator: %w", err)
+	}
+	logger.Info(fmt.Sprintf("measure %s for %s with %d goroutines", exp.Output.SubDirName, w.coordinator, concurrency))
+
+	var wg sync.WaitGroup
+	errs := make([]error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = w.loop(ctx, exp)
+		}(i)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// loop leases and runs measurements one by one.
+func (w *worker) loop(ctx context.Context, exp *experiment) error {
+	for ctx.Err() == nil {
+		var l leaseResponse
+		err := w.call(ctx, http.MethodPost, "/leases", leaseRequest{Worker: w.name}, &l)
+		if errors.Is(err, errLeaseGone) {
+			return nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to lease a measurement: %w", err)
+		}
+		if l.ID == "" {
+			select {
+			case <-time.After(w.pollInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		w.measure(ctx, exp, l)
+	}
+	return nil
+}
+
+// measure runs the measurement of the lease in its own directory and completes the lease.
+// The lease is renewed during the measurement, and the measurement is aborted if the lease is lost.
+func (w *worker) measure(ctx context.Context, exp *experiment, l leaseResponse) {
+	item := l.Item
+	logger.Info(fmt.Sprintf("start measuring %s (%d)", item.MeasurementID, item.Index))
+	dir := filepath.Join(w.workDir, l.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Error(fmt.Sprintf("Failed to create directory: %s", err))
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	measureCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	renewed := make(chan struct{})
+	lost := false
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(time.Duration(l.LeaseMilliseconds) * time.Millisecond / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-measureCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := w.call(measureCtx, http.MethodPost, "/leases/"+l.ID+"/renew", nil, nil)
+			if errors.Is(err, errLeaseGone) {
+				logger.Warn(fmt.Sprintf("lease of %s is lost, abort the measurement", item.MeasurementID))
+				lost = true
+				cancel()
+				return
+			}
+			if err != nil && measureCtx.Err() == nil {
+				logger.Error(fmt.Sprintf("Failed to renew the lease of %s: %s", item.MeasurementID, err))
+			}
+		}
+	}()
+	result := measure(measureCtx, w.rt, exp, item.Record, item.Scenario, item.Trial, dir)
+	cancel()
+	<-renewed
+	if lost {
+		return
+	}
+
+	// the coordinator is told about an aborted measurement even after the signal, so that it is handed out again at once.
+	completeCtx, cancelComplete := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancelComplete()
+	if !result.Aborted {
+		if err := w.upload(completeCtx, l.ID, dir); err != nil {
+			// the lease expires and the measurement is handed out again.
+			logger.Error(fmt.Sprintf("Failed to upload the results of %s: %s", item.MeasurementID, err))
+			return
+		}
+	}
+	if err := w.call(completeCtx, http.MethodPost, "/leases/"+l.ID+"/complete", result, nil); err != nil {
+		logger.Error(fmt.Sprintf("Failed to complete %s: %s", item.MeasurementID, err))
+		return
+	}
+	logger.Info(fmt.Sprintf("finish measuring %s", item.MeasurementID))
+}
+
+// upload uploads the regular files in dir, which are the results of the measurement.
+func (w *worker) upload(ctx context.Context, id, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := w.uploadFile(ctx, id, filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *worker) uploadFile(ctx context.Context, id, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return w.do(ctx, http.MethodPut, "/leases/"+id+"/files/"+url.PathEscape(filepath.Base(path)), file, nil)
+}
+
+// call sends in as JSON and decodes the response into out. out is left as is for 204 No Content.
+func (w *worker) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	return w.do(ctx, method, path, body, out)
+}
+
+// do sends the request to the coordinator. It returns errLeaseGone for 410 Gone.
+func (w *worker) do(ctx context.Context, method, path string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, w.coordinator+path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return errLeaseGone
+	case resp.StatusCode == http.StatusNoContent:
+		return nil
+	case resp.StatusCode >= 300:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yagikota/danewebperf/pcap"
+	"github.com/yagikota/danewebperf/storage"
+)
+
+const (
+	awsProfile = "default"
+	awsRegion  = "ap-northeast-1"
+	s3Bucket   = "pageloadtime-results"
+
+	outPutDirPath = "../../analysis"
+)
+
+var logger *slog.Logger
+
+// containers are the prefixes of the pcap files, e.g. unbound-example.com-with-cache-with-dane.pcap.
+var containers = []string{"unbound", "letsdane", "firefox"}
+
+// pcapFile is a pcap file of a measurement in the result store.
+type pcapFile struct {
+	MeasurementID string
+	Domain        string
+	// Container is unbound, letsdane or firefox.
+	Container string
+	// Measurement is the file name without the container and the extension, e.g. example.com-with-cache-with-dane.
+	Measurement string
+}
+
+func newPcapFile(key storage.Key) pcapFile {
+	file := pcapFile{MeasurementID: key.MeasurementID, Domain: key.Domain, Measurement: strings.TrimSuffix(key.Name, filepath.Ext(key.Name))}
+	for _, container := range containers {
+		if measurement, ok := strings.CutPrefix(file.Measurement, container+"-"); ok {
+			file.Container = container
+			file.Measurement = measurement
+			break
+		}
+	}
+	return file
+}
+
+func (f pcapFile) columns() []string {
+	return []string{f.MeasurementID, f.Domain, f.Container, f.Measurement}
+}
+
+var fileHeader = []string{"measurementID", "domain", "container", "measurement"}
+
+// dnsSummary is the DNS transactions of a type in a pcap file.
+type dnsSummary struct {
+	pcapFile
+	QType    string
+	Queries  int
+	Answered int
+	// TotalRTT and MaxRTT are of the answered queries.
+	TotalRTT time.Duration
+	MaxRTT   time.Duration
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// formatMilliseconds returns the duration between from and to in milliseconds. It is empty if either is zero.
+func formatMilliseconds(from, to time.Time) string {
+	if from.IsZero() || to.IsZero() {
+		return ""
+	}
+	return formatDuration(to.Sub(from))
+}
+
+func formatDuration(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+type csvTable struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func createCSV(path string, header []string) (*csvTable, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(file)
+	if err := writer.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &csvTable{file: file, writer: writer}, nil
+}
+
+func (t *csvTable) write(record []string) error {
+	return t.writer.Write(record)
+}
+
+func (t *csvTable) Close() error {
+	t.writer.Flush()
+	if err := t.writer.Error(); err != nil {
+		t.file.Close()
+		return err
+	}
+	return t.file.Close()
+}
+
+func dnsRecord(file pcapFile, d pcap.DNSTransaction) []string {
+	rtt := ""
+	if d.Answered {
+		rtt = formatDuration(d.RTT)
+	}
+	return append(file.columns(),
+		formatTime(d.QueryTime),
+		d.Client.String(),
+		d.Server.String(),
+		d.Transport,
+		strconv.Itoa(int(d.ID)),
+		d.QName,
+		d.QType,
+		strconv.FormatBool(d.Answered),
+		d.RCode,
+		strconv.FormatBool(d.AD),
+		strconv.FormatBool(d.Truncated),
+		strconv.Itoa(d.Answers),
+		rtt,
+	)
+}
+
+func tlsRecord(file pcapFile, h pcap.TLSHandshake) []string {
+	return append(file.columns(),
+		h.Client.String(),
+		h.Server.String(),
+		h.SNI,
+		strings.Join(h.ALPN, ";"),
+		h.ClientVersion,
+		h.Version,
+		h.CipherSuite,
+		formatTime(h.SYNTime),
+		formatTime(h.ClientHelloTime),
+		formatTime(h.ServerHelloTime),
+		formatMilliseconds(h.SYNTime, h.ClientHelloTime),
+		formatMilliseconds(h.ClientHelloTime, h.ServerHelloTime),
+	)
+}
+
+func summarizeDNS(file pcapFile, transactions []pcap.DNSTransaction) []dnsSummary {
+	var summaries []dnsSummary
+	index := make(map[string]int)
+	for _, d := range transactions {
+		i, ok := index[d.QType]
+		if !ok {
+			i = len(summaries)
+			index[d.QType] = i
+			summaries = append(summaries, dnsSummary{pcapFile: file, QType: d.QType})
+		}
+		summary := &summaries[i]
+		summary.Queries++
+		if d.Answered {
+			summary.Answered++
+			summary.TotalRTT += d.RTT
+			summary.MaxRTT = max(summary.MaxRTT, d.RTT)
+		}
+	}
+	return summaries
+}
+
+func main() {
+	start := time.Now()
+	log.Println("start time: ", start.Format("2006-01-02-15-04-05"))
+
+	measurementID := flag.String("measurementID", "", "measurementID. if empty, all finished measurements in the result store are processed")
+	includeLegacy := flag.Bool("include-legacy", false, "without -measurementID, also process the measurements without manifest.json, which were run by an old pageloadtime")
+	outPutDir := flag.String("outPutDir", outPutDirPath, "directory to write pcap-dns.csv, pcap-dns-summary.csv and pcap-tls.csv")
+	storeConfig := storage.Config{
+		URL:     "s3://" + s3Bucket,
+		Region:  awsRegion,
+		Profile: awsProfile,
+	}
+	storeConfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	ctx := context.Background()
+	store, err := storage.New(storeConfig)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	measurementIDs := []string{*measurementID}
+	if *measurementID == "" {
+		// the measurements without a finished manifest are still running, failed, or run by an old pageloadtime.
+		var skipped []string
+		measurementIDs, skipped, err = storage.FinishedMeasurementIDs(ctx, store, *includeLegacy)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, id := range skipped {
+			logger.Warn(fmt.Sprintf("skip %s without manifest.json, use -include-legacy to process it", id))
+		}
+		if len(measurementIDs) == 0 {
+			log.Fatalf("no finished measurement in %s", storeConfig.URL)
+		}
+		logger.Info(fmt.Sprintf("finished measurements in %s: %s", storeConfig.URL, strings.Join(measurementIDs, ", ")))
+	}
+
+	var keys []storage.Key
+	for _, id := range measurementIDs {
+		logger.Info(fmt.Sprintf("listing pcap files in %s of %s", id, storeConfig.URL))
+		measurementKeys, err := store.List(ctx, storage.Filter{MeasurementID: id, Kind: storage.KindPcap})
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to list pcap files, %v", err))
+			continue
+		}
+		keys = append(keys, measurementKeys...)
+	}
+
+	if err := os.MkdirAll(*outPutDir, 0755); err != nil {
+		log.Fatalln(err)
+	}
+	dnsTable, err := createCSV(filepath.Join(*outPutDir, "pcap-dns.csv"), append(fileHeader, "query_time", "client", "server", "transport", "id", "qname", "qtype", "answered", "rcode", "ad", "tc", "answers", "rtt_ms"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	summaryTable, err := createCSV(filepath.Join(*outPutDir, "pcap-dns-summary.csv"), append(fileHeader, "qtype", "queries", "answered", "total_rtt_ms", "max_rtt_ms"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tlsTable, err := createCSV(filepath.Join(*outPutDir, "pcap-tls.csv"), append(fileHeader, "client", "server", "sni", "alpn", "client_version", "version", "cipher_suite", "syn_time", "client_hello_time", "server_hello_time", "connect_ms", "hello_ms"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	for idx, key := range keys {
+		logger.Info(fmt.Sprintf("now processing %s (%d/%d) %f%%", key.Path(), idx+1, len(keys), float64(idx+1)/float64(len(keys))*100))
+		file := newPcapFile(key)
+
+		analysis, err := analyze(ctx, store, key)
+		if err != nil {
+			logger.Error(fmt.Sprintf("unable to analyze pcap file %q, %v", key.Path(), err))
+			continue
+		}
+		if analysis.Truncated {
+			logger.Warn(fmt.Sprintf("the last packet of %s is cut off", key.Path()))
+		}
+
+		for _, d := range analysis.DNS {
+			if err := dnsTable.write(dnsRecord(file, d)); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		for _, s := range summarizeDNS(file, analysis.DNS) {
+			record := append(s.columns(), s.QType, strconv.Itoa(s.Queries), strconv.Itoa(s.Answered), formatDuration(s.TotalRTT), formatDuration(s.MaxRTT))
+			if err := summaryTable.write(record); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		for _, h := range analysis.TLS {
+			if err := tlsTable.write(tlsRecord(file, h)); err != nil {
+				log.Fatalln(err)
+			}
+		}
+	}
+
+	for _, table := range []*csvTable{dnsTable, summaryTable, tlsTable} {
+		if err := table.Close(); err != nil {
+			logger.Error(fmt.Sprintf("unable to export result as csv, %v", err))
+		}
+	}
+
+	logger.Info(fmt.Sprintf("elapsed time: %f min", time.Since(start).Minutes()))
+	logger.Info("done")
+}
+
+// analyze reads the pcap file in the result store.
+func analyze(ctx context.Context, store storage.ResultStore, key storage.Key) (*pcap.Analysis, error) {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return pcap.Analyze(body)
+}
@@ -112,11 +112,14 @@ func main() {
 	concurrency := flag.Int("concurrency", 10, "concurrency")
 	flag.Parse()
 
-	// domainList, err := utils.ReadDomainListCSV(*inputCSV)
-	domainList, err := utils.ReadDomainListCSV(*inputCSV)
+	dataset, err := utils.ReadDataset(*inputCSV)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	for _, rejected := range dataset.Rejected {
+		log.Printf("skip %s of %s", rejected, *inputCSV)
+	}
+	domainList := dataset.Records
 
 	if *last == -1 {
 		*last = len(domainList)
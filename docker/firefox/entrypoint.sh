@@ -1,5 +1,8 @@
 #!/bin/sh
 
+# sudo drops environment variables, so NETEM is passed explicitly.
+sudo NETEM="$NETEM" /netem.sh || exit 1
+
 sudo tcpdump -i any  -w /captured/firefox.pcap &
 
 sudo python3 /home/seluser/measure/pageload_measure.py $@
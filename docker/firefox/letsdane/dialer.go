@@ -102,13 +102,14 @@ func (d *dialer) resolveAddr(ctx context.Context, addr string) (addrs *addrList,
 }
 
 // resolveDANE resolves the given host by performing a dns lookup returning
-// an address list of ipv4 and ipv6 addresses and TLSA resource records.
-func (d *dialer) resolveDANE(ctx context.Context, network, host string, constraints map[string]struct{}) (addrs *addrList, tlsa []*dns.TLSA, err error) {
+// an address list of ipv4 and ipv6 addresses and TLSA resource records,
+// and the time taken by the TLSA lookup.
+func (d *dialer) resolveDANE(ctx context.Context, network, host string, constraints map[string]struct{}) (addrs *addrList, tlsa []*dns.TLSA, tlsaLookup time.Duration, err error) {
 	addrs = &addrList{}
 	tlsa = []*dns.TLSA{}
 	addrs.Host, addrs.Port, err = net.SplitHostPort(host)
 	if err != nil || addrs.Host == "" || addrs.Port == "" {
-		return nil, nil, errBadHost
+		return nil, nil, 0, errBadHost
 	}
 	if ip := net.ParseIP(addrs.Host); ip != nil {
 		addrs.IPs = []net.IP{ip}
@@ -125,7 +126,9 @@ func (d *dialer) resolveDANE(ctx context.Context, network, host string, constrai
 
 	if constraints == nil || !inConstraints(constraints, addrs.Host) {
 		var secure bool
+		start := time.Now()
 		tlsa, secure, tlsaErr = d.resolver.LookupTLSA(ctx, addrs.Port, network, addrs.Host)
+		tlsaLookup = time.Since(start)
 		if !secure {
 			tlsa = []*dns.TLSA{}
 		}
@@ -1,5 +1,7 @@
 #!/bin/sh
 
+/netem.sh || exit 1
+
 echo "Starting letsdane..."
 cd /dane/cmd/letsdane/
 ./letsdane "$@"
\ No newline at end of file
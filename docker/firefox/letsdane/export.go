@@ -3,6 +3,8 @@ package letsdane
 import (
 	"encoding/csv"
 	"io"
+	"strconv"
+	"time"
 )
 
 var DANEValidationResultsChan = make(chan DANEValidationResult, 1)
@@ -11,6 +13,21 @@ type DANEValidationResult struct {
 	Host            string
 	IsDANEValidated bool
 	Err             error
+	// Started is when the CONNECT request was received.
+	Started time.Time
+	// TLSALookup is the time to look up the TLSA records. It is zero if they were not looked up.
+	TLSALookup time.Duration
+	// Finished is when the tunnel was established or failed.
+	Finished time.Time
+}
+
+// timingColumns are the Started, TLSA Lookup(ms) and Finished columns of the result.
+func (r DANEValidationResult) timingColumns() []string {
+	return []string{
+		r.Started.UTC().Format(time.RFC3339Nano),
+		strconv.FormatFloat(float64(r.TLSALookup)/float64(time.Millisecond), 'f', 3, 64),
+		r.Finished.UTC().Format(time.RFC3339Nano),
+	}
 }
 
 func writeEachLine(line []string, w io.Writer) error {
@@ -24,7 +41,7 @@ func writeEachLine(line []string, w io.Writer) error {
 
 func WriteToCSV(resultChan <-chan DANEValidationResult, w io.Writer) error {
 
-	if err := writeEachLine([]string{"Host", "DANE Validated", "Error"}, w); err != nil {
+	if err := writeEachLine([]string{"Host", "DANE Validated", "Error", "Started", "TLSA Lookup(ms)", "Finished"}, w); err != nil {
 		return err
 	}
 
@@ -38,13 +55,13 @@ func WriteToCSV(resultChan <-chan DANEValidationResult, w io.Writer) error {
 		}
 
 		if result.Err != nil {
-			if err := writeEachLine([]string{result.Host, daneValidated, result.Err.Error()}, w); err != nil {
+			if err := writeEachLine(append([]string{result.Host, daneValidated, result.Err.Error()}, result.timingColumns()...), w); err != nil {
 				return err
 			}
 			continue
 		}
 
-		if err := writeEachLine([]string{result.Host, daneValidated, ""}, w); err != nil {
+		if err := writeEachLine(append([]string{result.Host, daneValidated, ""}, result.timingColumns()...), w); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,19 @@
+#!/bin/sh
+# netem.sh impairs the network of the container for pageloadtime with tc netem.
+# NETEM is the parameters of tc netem, e.g. "delay 50000us loss 1%". If it is empty, nothing is done.
+# Only the packets to outside of the Docker network are impaired, so that the packets between
+# firefox, letsdane and unbound are not delayed twice. The container needs NET_ADMIN.
+# This file is also in docker/firefox/letsdane, because the build contexts of the images are different.
+
+[ -z "$NETEM" ] && exit 0
+set -e
+
+DEV=${NETEM_DEV:-eth0}
+SUBNET=$(ip -o -4 addr show dev "$DEV" | awk '{print $4}')
+
+# every packet goes to band 3 with netem, except the packets to the Docker network, which go to band 1.
+tc qdisc add dev "$DEV" root handle 1: prio bands 3 priomap 2 2 2 2 2 2 2 2 2 2 2 2 2 2 2 2
+tc qdisc add dev "$DEV" parent 1:3 handle 30: netem $NETEM
+tc filter add dev "$DEV" parent 1: protocol ip prio 1 u32 match ip dst "$SUBNET" flowid 1:1
+
+echo "netem: $NETEM on $DEV except $SUBNET"
@@ -54,22 +54,27 @@ type tunneler struct {
 func (h *tunneler) Tunnel(ctx context.Context, clientConn *proxy.Conn, network, addr string) {
 	defer clientConn.Close()
 
-	addrs, tlsa, err := h.dialer.resolveDANE(ctx, network, addr, h.constraints)
+	started := time.Now()
+	addrs, tlsa, tlsaLookup, err := h.dialer.resolveDANE(ctx, network, addr, h.constraints)
+	report := func(host string, validated bool, err error) {
+		DANEValidationResultsChan <- DANEValidationResult{Host: host, IsDANEValidated: validated, Err: err, Started: started, TLSALookup: tlsaLookup, Finished: time.Now()}
+	}
 	if err == errBadHost {
 		h.warnf("bad host", http.StatusBadRequest, addr)
-		DANEValidationResultsChan <- DANEValidationResult{Host: addrs.Host, IsDANEValidated: false, Err: err}
+		// addrs is nil for a bad host.
+		report(addr, false, err)
 		clientConn.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	if err != nil {
 		h.warnf("%v", http.StatusBadGateway, addr, err)
-		DANEValidationResultsChan <- DANEValidationResult{Host: addrs.Host, IsDANEValidated: false, Err: err}
+		report(addrs.Host, false, err)
 		clientConn.WriteHeader(http.StatusBadGateway)
 		return
 	}
 	if len(addrs.IPs) == 0 {
 		h.warnf("no such host", http.StatusBadGateway, addr)
-		DANEValidationResultsChan <- DANEValidationResult{Host: addrs.Host, IsDANEValidated: false, Err: err}
+		report(addrs.Host, false, err)
 		clientConn.WriteHeader(http.StatusBadGateway)
 		return
 	}
@@ -81,13 +86,13 @@ func (h *tunneler) Tunnel(ctx context.Context, clientConn *proxy.Conn, network,
 		remote, err := h.dialer.dialAddrList(ctx, network, addrs)
 		if err != nil {
 			h.warnf("dial remote host failed: %v", http.StatusBadGateway, addr, err)
-			DANEValidationResultsChan <- DANEValidationResult{Host: addrs.Host, IsDANEValidated: false, Err: err}
+			report(addrs.Host, false, err)
 			clientConn.WriteHeader(http.StatusBadGateway)
 			return
 		}
 
 		h.logf("tunnel established %s", http.StatusOK, addr, remote.RemoteAddr().String())
-		DANEValidationResultsChan <- DANEValidationResult{Host: addrs.Host, IsDANEValidated: false, Err: errors.New("tunnel established without DANE validation")}
+		report(addrs.Host, false, errors.New("tunnel established without DANE validation"))
 		clientConn.WriteHeader(http.StatusOK)
 		clientConn.Copy(remote)
 		return
@@ -97,7 +102,7 @@ func (h *tunneler) Tunnel(ctx context.Context, clientConn *proxy.Conn, network,
 	clientConn.WriteHeader(http.StatusOK)
 	hello, err := clientConn.PeekClientHello()
 	if err != nil {
-		DANEValidationResultsChan <- DANEValidationResult{Host: addrs.Host, IsDANEValidated: false, Err: err}
+		report(addrs.Host, false, err)
 		if err == io.EOF {
 			return
 		}
@@ -108,7 +113,7 @@ func (h *tunneler) Tunnel(ctx context.Context, clientConn *proxy.Conn, network,
 	tlsaDomain := addrs.Host
 	if tlsaDomain != hello.ServerName {
 		h.warnf("client sni `%s` does not match tlsa domain `%s`", statusErr, addr, hello.ServerName, tlsaDomain)
-		DANEValidationResultsChan <- DANEValidationResult{Host: addrs.Host, IsDANEValidated: false, Err: errors.New("client sni does not match tlsa domain")}
+		report(addrs.Host, false, errors.New("client sni does not match tlsa domain"))
 		return
 	}
 
@@ -121,12 +126,12 @@ func (h *tunneler) Tunnel(ctx context.Context, clientConn *proxy.Conn, network,
 
 	remote, err := h.dialer.dialTLSContext(ctx, network, addrs, daneConfig)
 	if _, ok := err.(*tlsError); ok {
-		DANEValidationResultsChan <- DANEValidationResult{Host: addrs.Host, IsDANEValidated: false, Err: err}
+		report(addrs.Host, false, err)
 		terminateTLSHandshake(clientConn)
 	}
 	if err != nil {
 		h.warnf("dial remote host failed: %v", statusErr, addr, err)
-		DANEValidationResultsChan <- DANEValidationResult{Host: addrs.Host, IsDANEValidated: false, Err: err}
+		report(addrs.Host, false, err)
 		return
 	}
 	defer remote.Close()
@@ -142,7 +147,7 @@ func (h *tunneler) Tunnel(ctx context.Context, clientConn *proxy.Conn, network,
 
 	clientTLS := tls.Server(clientConn, clientTLSConfig)
 	if err := clientTLS.Handshake(); err != nil {
-		DANEValidationResultsChan <- DANEValidationResult{Host: addrs.Host, IsDANEValidated: false, Err: err}
+		report(addrs.Host, false, err)
 		if err == io.EOF {
 			return
 		}
@@ -151,7 +156,7 @@ func (h *tunneler) Tunnel(ctx context.Context, clientConn *proxy.Conn, network,
 	}
 
 	h.logf("dane tunnel established %s", http.StatusOK, addr, remote.RemoteAddr().String())
-	DANEValidationResultsChan <- DANEValidationResult{Host: addrs.Host, IsDANEValidated: true, Err: nil}
+	report(addrs.Host, true, nil)
 	log.Println(DANEValidationResultsChan)
 	copyConn(clientTLS, remote)
 }
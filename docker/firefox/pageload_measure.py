@@ -48,14 +48,14 @@ def initFireFoxProfile(dane: bool, proxy_host: str):
         profile.set_preference("network.proxy.ssl_port", proxy_port)
     return profile
 
-def initFireFoxDriver(options: FirefoxOptions, profile: FirefoxProfile):
+def initFireFoxDriver(options: FirefoxOptions, profile: FirefoxProfile, timeout: int):
     firefox_binary_path = "/opt/firefox/firefox-bin"
     driver = Firefox(
         options=options,
         firefox_profile=profile,
         firefox_binary=firefox_binary_path,
         )
-    driver.set_page_load_timeout(30)
+    driver.set_page_load_timeout(timeout)
     return driver
 
 # In the Background, Native messaging is used to collect HAR files.
@@ -64,8 +64,20 @@ def initFireFoxDriver(options: FirefoxOptions, profile: FirefoxProfile):
 def har_file_ready(file_path: str):
     return os.path.exists(file_path + ".ready")
 
+# started is when the page load started, so that the timeout includes the page load.
+def wait_har_file(file_path: str, started: datetime, timeout: int):
+    while (datetime.now() - started).total_seconds() < timeout and not har_file_ready(file_path):
+        time.sleep(1)
+    return har_file_ready(file_path)
+
+def remove_har_file(file_path: str):
+    for path in [file_path, file_path + ".ready"]:
+        if os.path.exists(path):
+            os.remove(path)
+
 # How to run:
 # python3 custom_run.py https://www.example.com/ --resolver_ip 1.1.1.1 --proxy_host letsdane-www.example.com --dane --cache
+# python3 custom_run.py https://www.example.com/ --resolver_ip 1.1.1.1 --repeat_visit
 def main():
     parser = argparse.ArgumentParser(
         prog='firefox-har',
@@ -77,6 +89,7 @@ def main():
     parser.add_argument('--timeout', type=int, default=30, help='The maximum time to wait for the page to load')
     parser.add_argument('--dane', action='store_true', help='Enable DANE validation')
     parser.add_argument('--fill_cache_only', action='store_true', help='Only fill the cache and exit')
+    parser.add_argument('--repeat_visit', action='store_true', help='Load the page twice in the same profile and return the HAR file of the second load')
     args = parser.parse_args()
 
     # This allow FireFox to use elf-hosted DNS resolver.
@@ -86,7 +99,7 @@ def main():
     options = initFireFoxOptions()
     profile = initFireFoxProfile(args.dane, args.proxy_host)
     profile.set_preference('devtools.toolbox.selectedTool', 'netmonitor')
-    driver = initFireFoxDriver(options, profile)
+    driver = initFireFoxDriver(options, profile, args.timeout)
 
     har_addon_path = "/home/seluser/measure/harexporttrigger-0.6.2-fx.xpi"
     driver.install_addon(har_addon_path, temporary=True)
@@ -97,17 +110,23 @@ def main():
         driver.quit()
         return
 
+    har_file = "/home/seluser/measure/har.json"
+
+    # The first visit fills the HTTP cache, the TLS session cache and the DNS cache of Firefox.
+    # Its HAR file is discarded and the page is loaded again from about:blank.
+    if args.repeat_visit:
+        started = datetime.now()
+        driver.get(args.website)
+        wait_har_file(har_file, started, args.timeout)
+        remove_har_file(har_file)
+        driver.get('about:blank')
+
     # Make a page load
     started = datetime.now()
     driver.get(args.website)
 
-    har_file = "/home/seluser/measure/har.json"
-
-    while (datetime.now() - started).total_seconds() < args.timeout and not har_file_ready(har_file):
-        time.sleep(1)
-
     # Once the HAR is on disk in the container, write it to stdout so the host machine can get it
-    if har_file_ready(har_file):
+    if wait_har_file(har_file, started, args.timeout):
         with open(har_file, 'rb') as f:
             sys.stdout.buffer.write(f.read())
 
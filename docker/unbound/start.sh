@@ -0,0 +1,7 @@
+#!/bin/bash
+# unbound.conf is written into the container by pageloadtime before it starts (see cmd/pageloadtime/unbound.go).
+
+/netem.sh || exit 1
+
+echo "Starting unbound..."
+/usr/local/sbin/unbound -c /usr/local/etc/unbound/unbound.conf -d -v
@@ -0,0 +1,94 @@
+package pcap
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// Analysis is the DNS transactions and the TLS handshakes in a pcap file.
+//
+// DNS is read from UDP and TCP on port 53, and TLS from the other TCP connections, including the ones through
+// a proxy with CONNECT. QUIC and the fragments of IP are not read.
+type Analysis struct {
+	// DNS is in the order of the queries.
+	DNS []DNSTransaction
+	// TLS is in the order of the ClientHellos.
+	TLS []TLSHandshake
+	// Truncated is true if the last packet is cut off, e.g. because the file was copied while tcpdump was writing it.
+	// The packets before it are analyzed.
+	Truncated bool
+}
+
+type analyzer struct {
+	result     Analysis
+	pendingDNS map[dnsKey]int
+	streams    map[direction]*tcpStream
+	// synTimes are the times of SYN by the direction from the client to the server.
+	synTimes map[direction]time.Time
+	// handshakes are the indexes of result.TLS by the direction from the client to the server.
+	handshakes map[direction]int
+}
+
+// Analyze reads all packets of the pcap file.
+func Analyze(r io.Reader) (*Analysis, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &analyzer{
+		pendingDNS: make(map[dnsKey]int),
+		streams:    make(map[direction]*tcpStream),
+		synTimes:   make(map[direction]time.Time),
+		handshakes: make(map[direction]int),
+	}
+	for {
+		packet, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			a.result.Truncated = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if seg, ok := decodePacket(reader.LinkType, packet); ok {
+			a.handle(seg)
+		}
+	}
+	return &a.result, nil
+}
+
+func (a *analyzer) handle(seg segment) {
+	dns := seg.Src.Port() == dnsPort || seg.Dst.Port() == dnsPort
+	if !seg.TCP {
+		if dns {
+			a.handleDNS(seg.Payload, seg.Src, seg.Dst, seg.Timestamp, "udp")
+		}
+		return
+	}
+
+	d := direction{src: seg.Src, dst: seg.Dst}
+	s, ok := a.streams[d]
+	// a new connection may reuse the ports of a closed one.
+	if !ok || seg.Flags&tcpFlagSYN != 0 {
+		s = &tcpStream{}
+		a.streams[d] = s
+	}
+	if seg.Flags&(tcpFlagSYN|tcpFlagACK) == tcpFlagSYN {
+		a.synTimes[d] = seg.Timestamp
+	}
+	s.add(seg)
+	if len(s.buf) == 0 {
+		return
+	}
+	if dns {
+		a.handleDNSStream(s, seg.Src, seg.Dst, seg.Timestamp)
+		return
+	}
+	a.handleTLSStream(s, d, seg.Timestamp)
+}
@@ -0,0 +1,258 @@
+package pcap
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// pcapWriter writes a pcap file in memory like `tcpdump -i any -w`.
+type pcapWriter struct {
+	buf      bytes.Buffer
+	linkType uint32
+}
+
+func newPcapWriter(linkType uint32) *pcapWriter {
+	w := &pcapWriter{linkType: linkType}
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, magicMicroseconds)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 262144)
+	binary.LittleEndian.PutUint32(header[20:], linkType)
+	w.buf.Write(header)
+	return w
+}
+
+// write writes an IPv4 packet with the link layer header.
+func (w *pcapWriter) write(at time.Time, ip []byte) {
+	var data []byte
+	switch w.linkType {
+	case LinkTypeLinuxSLL:
+		data = make([]byte, 16)
+		binary.BigEndian.PutUint16(data[14:], etherTypeIPv4)
+	case LinkTypeEthernet:
+		data = make([]byte, 14)
+		binary.BigEndian.PutUint16(data[12:], etherTypeIPv4)
+	}
+	data = append(data, ip...)
+
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint32(header, uint32(at.Unix()))
+	binary.LittleEndian.PutUint32(header[4:], uint32(at.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(data)))
+	w.buf.Write(header)
+	w.buf.Write(data)
+}
+
+func ipv4(protocol byte, src, dst netip.AddrPort, transport []byte) []byte {
+	header := make([]byte, 20)
+	header[0] = 0x45
+	binary.BigEndian.PutUint16(header[2:], uint16(20+len(transport)))
+	header[8] = 64
+	header[9] = protocol
+	copy(header[12:], src.Addr().AsSlice())
+	copy(header[16:], dst.Addr().AsSlice())
+	return append(header, transport...)
+}
+
+func udp(src, dst netip.AddrPort, payload []byte) []byte {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint16(header, src.Port())
+	binary.BigEndian.PutUint16(header[2:], dst.Port())
+	binary.BigEndian.PutUint16(header[4:], uint16(8+len(payload)))
+	return ipv4(protocolUDP, src, dst, append(header, payload...))
+}
+
+func tcp(src, dst netip.AddrPort, seq uint32, flags byte, payload []byte) []byte {
+	header := make([]byte, 20)
+	binary.BigEndian.PutUint16(header, src.Port())
+	binary.BigEndian.PutUint16(header[2:], dst.Port())
+	binary.BigEndian.PutUint32(header[4:], seq)
+	header[12] = 5 << 4
+	header[13] = flags
+	return ipv4(protocolTCP, src, dst, append(header, payload...))
+}
+
+func dnsMessage(t *testing.T, id uint16, response, ad bool, rcode dnsmessage.RCode, name string, qtype dnsmessage.Type, answers int) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: response, AuthenticData: ad, RCode: rcode})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < answers; i++ {
+		if err := b.AResource(dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: 300}, dnsmessage.AResource{A: [4]byte{192, 0, 2, byte(i)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// clientHello returns the records of the ClientHello which crypto/tls sends.
+func clientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		conn := tls.Client(client, &tls.Config{ServerName: serverName, NextProtos: []string{"h2", "http/1.1"}})
+		conn.Handshake()
+		client.Close()
+	}()
+
+	var records []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := server.Read(buf)
+		if err != nil {
+			t.Fatalf("failed to read ClientHello: %v", err)
+		}
+		records = append(records, buf[:n]...)
+		if _, err := firstHandshakeMessage(records); err == nil {
+			return records
+		}
+	}
+}
+
+// serverHello returns a record of a ServerHello of TLS 1.3.
+func serverHello() []byte {
+	body := []byte{3, 3}
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // session ID
+	body = append(body, 0x13, 0x01)          // TLS_AES_128_GCM_SHA256
+	body = append(body, 0)                   // compression method
+	body = append(body, 0, 6, 0, 43, 0, 2, 3, 4)
+	msg := append([]byte{handshakeTypeServerHello, 0, 0, byte(len(body))}, body...)
+	return append([]byte{recordTypeHandshake, 3, 3, 0, byte(len(msg))}, msg...)
+}
+
+func TestAnalyzeDNS(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	letsdane := netip.MustParseAddrPort("172.18.0.3:40000")
+	unbound := netip.MustParseAddrPort("172.18.0.2:53")
+	w := newPcapWriter(LinkTypeLinuxSLL)
+	w.write(start, udp(letsdane, unbound, dnsMessage(t, 1, false, false, 0, "_443._tcp.Example.com.", 52, 0)))
+	w.write(start.Add(time.Millisecond), udp(letsdane, unbound, dnsMessage(t, 2, false, false, 0, "example.com.", 1, 0)))
+	// the response of A comes first.
+	w.write(start.Add(5*time.Millisecond), udp(unbound, letsdane, dnsMessage(t, 2, true, true, 0, "example.com.", 1, 2)))
+	w.write(start.Add(30*time.Millisecond), udp(unbound, letsdane, dnsMessage(t, 1, true, true, 0, "_443._tcp.example.com.", 52, 1)))
+	// a query without a response.
+	w.write(start.Add(40*time.Millisecond), udp(letsdane, unbound, dnsMessage(t, 3, false, false, 0, "example.net.", 28, 0)))
+	// a query over TCP in two segments.
+	client := netip.MustParseAddrPort("172.18.0.3:40001")
+	query := dnsMessage(t, 4, false, false, 0, "example.org.", 1, 0)
+	tcpQuery := append([]byte{0, byte(len(query))}, query...)
+	response := dnsMessage(t, 4, true, false, 2, "example.org.", 1, 0)
+	w.write(start.Add(50*time.Millisecond), tcp(client, unbound, 100, tcpFlagSYN, nil))
+	w.write(start.Add(51*time.Millisecond), tcp(client, unbound, 101, tcpFlagACK, tcpQuery[:5]))
+	w.write(start.Add(52*time.Millisecond), tcp(client, unbound, 106, tcpFlagACK, tcpQuery[5:]))
+	w.write(start.Add(60*time.Millisecond), tcp(unbound, client, 500, tcpFlagACK, append([]byte{0, byte(len(response))}, response...)))
+
+	analysis, err := Analyze(&w.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Truncated {
+		t.Error("truncated = true, want false")
+	}
+	want := []DNSTransaction{
+		{QueryTime: start, Client: letsdane, Server: unbound, Transport: "udp", ID: 1, QName: "_443._tcp.example.com", QType: "TLSA", Answered: true, RTT: 30 * time.Millisecond, RCode: "NOERROR", AD: true, Answers: 1},
+		{QueryTime: start.Add(time.Millisecond), Client: letsdane, Server: unbound, Transport: "udp", ID: 2, QName: "example.com", QType: "A", Answered: true, RTT: 4 * time.Millisecond, RCode: "NOERROR", AD: true, Answers: 2},
+		{QueryTime: start.Add(40 * time.Millisecond), Client: letsdane, Server: unbound, Transport: "udp", ID: 3, QName: "example.net", QType: "AAAA"},
+		{QueryTime: start.Add(52 * time.Millisecond), Client: client, Server: unbound, Transport: "tcp", ID: 4, QName: "example.org", QType: "A", Answered: true, RTT: 8 * time.Millisecond, RCode: "SERVFAIL"},
+	}
+	if len(analysis.DNS) != len(want) {
+		t.Fatalf("DNS = %+v, want %d transactions", analysis.DNS, len(want))
+	}
+	for i := range want {
+		if analysis.DNS[i] != want[i] {
+			t.Errorf("DNS[%d] = %+v, want %+v", i, analysis.DNS[i], want[i])
+		}
+	}
+}
+
+func TestAnalyzeTLS(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	firefox := netip.MustParseAddrPort("172.18.0.4:50000")
+	letsdane := netip.MustParseAddrPort("172.18.0.3:8080")
+	hello := clientHello(t, "example.com")
+	connect := []byte("CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n")
+	established := []byte("HTTP/1.1 200 OK\r\n\r\n")
+
+	w := newPcapWriter(LinkTypeEthernet)
+	w.write(start, tcp(firefox, letsdane, 1000, tcpFlagSYN, nil))
+	w.write(start.Add(time.Millisecond), tcp(letsdane, firefox, 5000, tcpFlagSYN|tcpFlagACK, nil))
+	w.write(start.Add(2*time.Millisecond), tcp(firefox, letsdane, 1001, tcpFlagACK, connect))
+	w.write(start.Add(3*time.Millisecond), tcp(letsdane, firefox, 5001, tcpFlagACK, established))
+	// the ClientHello is split, and its second half arrives first and is retransmitted.
+	seq := 1001 + uint32(len(connect))
+	half := len(hello) / 2
+	w.write(start.Add(5*time.Millisecond), tcp(firefox, letsdane, seq+uint32(half), tcpFlagACK, hello[half:]))
+	w.write(start.Add(4*time.Millisecond), tcp(firefox, letsdane, seq, tcpFlagACK, hello[:half]))
+	w.write(start.Add(6*time.Millisecond), tcp(firefox, letsdane, seq+uint32(half), tcpFlagACK, hello[half:]))
+	w.write(start.Add(20*time.Millisecond), tcp(letsdane, firefox, 5001+uint32(len(established)), tcpFlagACK, serverHello()))
+
+	analysis, err := Analyze(&w.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analysis.TLS) != 1 {
+		t.Fatalf("TLS = %+v, want a handshake", analysis.TLS)
+	}
+	got := analysis.TLS[0]
+	if got.Client != firefox || got.Server != letsdane || got.SNI != "example.com" || got.ClientVersion != "TLS 1.3" {
+		t.Errorf("handshake = %+v, want a ClientHello of TLS 1.3 for example.com from firefox to letsdane", got)
+	}
+	if len(got.ALPN) != 2 || got.ALPN[0] != "h2" || got.ALPN[1] != "http/1.1" {
+		t.Errorf("ALPN = %q, want h2 and http/1.1", got.ALPN)
+	}
+	if !got.SYNTime.Equal(start) || !got.ClientHelloTime.Equal(start.Add(4*time.Millisecond)) || !got.ServerHelloTime.Equal(start.Add(20*time.Millisecond)) {
+		t.Errorf("times = %s, %s, %s, want SYN at 0ms, ClientHello at 4ms and ServerHello at 20ms", got.SYNTime, got.ClientHelloTime, got.ServerHelloTime)
+	}
+	if got.Version != "TLS 1.3" || got.CipherSuite != "TLS_AES_128_GCM_SHA256" {
+		t.Errorf("server = %s %s, want TLS 1.3 with TLS_AES_128_GCM_SHA256", got.Version, got.CipherSuite)
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	w := newPcapWriter(LinkTypeLinuxSLL)
+	src := netip.MustParseAddrPort("172.18.0.3:40000")
+	dst := netip.MustParseAddrPort("172.18.0.2:53")
+	w.write(time.Unix(0, 0), udp(src, dst, dnsMessage(t, 1, false, false, 0, "example.com.", 1, 0)))
+	w.write(time.Unix(1, 0), udp(src, dst, dnsMessage(t, 2, false, false, 0, "example.com.", 28, 0)))
+	data := w.buf.Bytes()[:w.buf.Len()-10]
+
+	analysis, err := Analyze(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !analysis.Truncated || len(analysis.DNS) != 1 {
+		t.Errorf("analysis = %+v, want the first query of a truncated file", analysis)
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte{0x0a, 0x0d, 0x0d, 0x0a, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})); err == nil {
+		t.Error("NewReader() error = nil, want error for pcapng")
+	}
+	if _, err := NewReader(bytes.NewReader(nil)); !errors.Is(err, io.EOF) {
+		t.Errorf("NewReader() error = %v, want EOF", err)
+	}
+}
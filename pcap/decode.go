@@ -0,0 +1,149 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+
+	protocolTCP = 6
+	protocolUDP = 17
+
+	tcpFlagSYN = 0x02
+	tcpFlagACK = 0x10
+)
+
+// segment is the transport layer of a packet: a UDP datagram or a TCP segment.
+type segment struct {
+	Timestamp time.Time
+	Src       netip.AddrPort
+	Dst       netip.AddrPort
+	TCP       bool
+	// Seq and Flags are only for TCP.
+	Seq     uint32
+	Flags   uint8
+	Payload []byte
+}
+
+// decodePacket decodes the packet down to UDP or TCP. It returns false for the other protocols,
+// the fragments of IP and broken packets.
+func decodePacket(linkType uint32, packet Packet) (segment, bool) {
+	data := packet.Data
+	var etherType uint16
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return segment{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[12:]), data[14:]
+		if etherType == etherTypeVLAN {
+			if len(data) < 4 {
+				return segment{}, false
+			}
+			etherType, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return segment{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	case LinkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return segment{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data), data[20:]
+	case LinkTypeRaw:
+		if len(data) == 0 {
+			return segment{}, false
+		}
+		switch data[0] >> 4 {
+		case 4:
+			etherType = etherTypeIPv4
+		case 6:
+			etherType = etherTypeIPv6
+		}
+	default:
+		return segment{}, false
+	}
+
+	var src, dst netip.Addr
+	var protocol uint8
+	switch etherType {
+	case etherTypeIPv4:
+		if len(data) < 20 || data[0]>>4 != 4 {
+			return segment{}, false
+		}
+		headerLength := int(data[0]&0x0f) * 4
+		totalLength := int(binary.BigEndian.Uint16(data[2:]))
+		// more fragments, or not the first fragment
+		if fragment := binary.BigEndian.Uint16(data[6:]); fragment&0x2000 != 0 || fragment&0x1fff != 0 {
+			return segment{}, false
+		}
+		if headerLength < 20 || totalLength < headerLength || totalLength > len(data) {
+			return segment{}, false
+		}
+		protocol = data[9]
+		src = netip.AddrFrom4([4]byte(data[12:16]))
+		dst = netip.AddrFrom4([4]byte(data[16:20]))
+		// the link layer may pad short packets
+		data = data[headerLength:totalLength]
+	case etherTypeIPv6:
+		if len(data) < 40 || data[0]>>4 != 6 {
+			return segment{}, false
+		}
+		payloadLength := int(binary.BigEndian.Uint16(data[4:]))
+		if 40+payloadLength > len(data) {
+			return segment{}, false
+		}
+		protocol = data[6]
+		src = netip.AddrFrom16([16]byte(data[8:24]))
+		dst = netip.AddrFrom16([16]byte(data[24:40]))
+		data = data[40 : 40+payloadLength]
+		// skip the extension headers: hop-by-hop options, routing and destination options.
+		for protocol == 0 || protocol == 43 || protocol == 60 {
+			if len(data) < 8 || len(data) < (int(data[1])+1)*8 {
+				return segment{}, false
+			}
+			protocol, data = data[0], data[(int(data[1])+1)*8:]
+		}
+	default:
+		return segment{}, false
+	}
+
+	seg := segment{Timestamp: packet.Timestamp}
+	switch protocol {
+	case protocolUDP:
+		if len(data) < 8 {
+			return segment{}, false
+		}
+		length := int(binary.BigEndian.Uint16(data[4:]))
+		if length < 8 || length > len(data) {
+			return segment{}, false
+		}
+		seg.Src = netip.AddrPortFrom(src, binary.BigEndian.Uint16(data))
+		seg.Dst = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:]))
+		seg.Payload = data[8:length]
+	case protocolTCP:
+		if len(data) < 20 {
+			return segment{}, false
+		}
+		offset := int(data[12]>>4) * 4
+		if offset < 20 || offset > len(data) {
+			return segment{}, false
+		}
+		seg.TCP = true
+		seg.Src = netip.AddrPortFrom(src, binary.BigEndian.Uint16(data))
+		seg.Dst = netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:]))
+		seg.Seq = binary.BigEndian.Uint32(data[4:])
+		seg.Flags = data[13]
+		seg.Payload = data[offset:]
+	default:
+		return segment{}, false
+	}
+	return seg, true
+}
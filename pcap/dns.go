@@ -0,0 +1,160 @@
+package pcap
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const dnsPort = 53
+
+// DNSTransaction is a DNS query and its response.
+type DNSTransaction struct {
+	QueryTime time.Time
+	Client    netip.AddrPort
+	Server    netip.AddrPort
+	// Transport is udp or tcp.
+	Transport string
+	ID        uint16
+	// QName is the name in the question without the trailing dot, in lower case.
+	QName string
+	// QType is the type in the question, e.g. A, AAAA or TLSA.
+	QType string
+	// Answered is false if the response was not captured. Then the fields below are zero.
+	Answered bool
+	RTT      time.Duration
+	// RCode is the response code, e.g. NOERROR, NXDOMAIN or SERVFAIL.
+	RCode string
+	// AD is the Authenticated Data bit, which a validating resolver sets if the answer is secure with DNSSEC.
+	AD bool
+	// Truncated is the TC bit, which makes the client retry with TCP.
+	Truncated bool
+	Answers   int
+}
+
+type dnsKey struct {
+	client netip.AddrPort
+	server netip.AddrPort
+	id     uint16
+	name   string
+	qtype  dnsmessage.Type
+}
+
+// qtypeNames are the names of the types which a measurement sends and receives. The others are TYPE[number] of RFC 3597.
+var qtypeNames = map[dnsmessage.Type]string{
+	1:  "A",
+	2:  "NS",
+	5:  "CNAME",
+	6:  "SOA",
+	12: "PTR",
+	15: "MX",
+	16: "TXT",
+	28: "AAAA",
+	43: "DS",
+	46: "RRSIG",
+	47: "NSEC",
+	48: "DNSKEY",
+	50: "NSEC3",
+	52: "TLSA",
+	64: "SVCB",
+	65: "HTTPS",
+}
+
+func qtypeName(t dnsmessage.Type) string {
+	if name, ok := qtypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+var rcodeNames = map[dnsmessage.RCode]string{
+	0: "NOERROR",
+	1: "FORMERR",
+	2: "SERVFAIL",
+	3: "NXDOMAIN",
+	4: "NOTIMP",
+	5: "REFUSED",
+}
+
+func rcodeName(rcode dnsmessage.RCode) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// handleDNS records a query, or fills the transaction of its query with a response.
+// The response of a retransmitted query is matched with the last one.
+func (a *analyzer) handleDNS(msg []byte, src, dst netip.AddrPort, at time.Time, transport string) {
+	var p dnsmessage.Parser
+	header, err := p.Start(msg)
+	if err != nil {
+		return
+	}
+	question, err := p.Question()
+	if err != nil {
+		return
+	}
+	name := strings.ToLower(question.Name.String())
+	if name != "." {
+		name = strings.TrimSuffix(name, ".")
+	}
+
+	if !header.Response {
+		a.pendingDNS[dnsKey{client: src, server: dst, id: header.ID, name: name, qtype: question.Type}] = len(a.result.DNS)
+		a.result.DNS = append(a.result.DNS, DNSTransaction{
+			QueryTime: at,
+			Client:    src,
+			Server:    dst,
+			Transport: transport,
+			ID:        header.ID,
+			QName:     name,
+			QType:     qtypeName(question.Type),
+		})
+		return
+	}
+
+	key := dnsKey{client: dst, server: src, id: header.ID, name: name, qtype: question.Type}
+	i, ok := a.pendingDNS[key]
+	if !ok {
+		return
+	}
+	delete(a.pendingDNS, key)
+	transaction := &a.result.DNS[i]
+	transaction.Answered = true
+	transaction.RTT = at.Sub(transaction.QueryTime)
+	transaction.RCode = rcodeName(header.RCode)
+	transaction.AD = header.AuthenticData
+	transaction.Truncated = header.Truncated
+	if err := p.SkipAllQuestions(); err != nil {
+		return
+	}
+	for {
+		if _, err := p.AnswerHeader(); err != nil {
+			if !errors.Is(err, dnsmessage.ErrSectionDone) {
+				transaction.Answers = 0
+			}
+			return
+		}
+		if err := p.SkipAnswer(); err != nil {
+			return
+		}
+		transaction.Answers++
+	}
+}
+
+// handleDNSStream reads the DNS messages over TCP, each of which has its length in 2 bytes before it.
+func (a *analyzer) handleDNSStream(s *tcpStream, src, dst netip.AddrPort, now time.Time) {
+	for len(s.buf) >= 2 {
+		length := int(s.buf[0])<<8 | int(s.buf[1])
+		if len(s.buf) < 2+length {
+			return
+		}
+		a.handleDNS(s.buf[2:2+length], src, dst, now, "tcp")
+		s.consume(2+length, now)
+	}
+}
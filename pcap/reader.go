@@ -0,0 +1,102 @@
+// Package pcap reads the packets captured by tcpdump in the containers of a measurement,
+// e.g. unbound-example.com-with-cache-with-dane.pcap, and extracts the DNS transactions and the TLS handshakes.
+//
+// Only the classic pcap format written by `tcpdump -w` is supported, not pcapng.
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Link types of the pcap header. https://www.tcpdump.org/linktypes.html
+const (
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	// LinkTypeLinuxSLL is written by `tcpdump -i any`, and LinkTypeLinuxSLL2 by newer versions of it.
+	LinkTypeLinuxSLL  = 113
+	LinkTypeLinuxSLL2 = 276
+)
+
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+	magicPcapng       = 0x0a0d0d0a
+	// maxPacketSize is the largest packet to read, which is far larger than the default snapshot length of tcpdump.
+	maxPacketSize = 1 << 20
+)
+
+// Packet is a captured packet from its link layer header.
+type Packet struct {
+	Timestamp time.Time
+	Data      []byte
+}
+
+// Reader reads the packets of a pcap file in order.
+type Reader struct {
+	r           io.Reader
+	order       binary.ByteOrder
+	nanoseconds bool
+	// LinkType is the link layer of every packet, e.g. LinkTypeLinuxSLL.
+	LinkType uint32
+}
+
+// NewReader reads the header of the pcap file.
+func NewReader(r io.Reader) (*Reader, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read pcap header: %w", err)
+	}
+
+	reader := &Reader{r: r}
+	switch magic := binary.LittleEndian.Uint32(header); magic {
+	case magicMicroseconds, magicNanoseconds:
+		reader.order = binary.LittleEndian
+		reader.nanoseconds = magic == magicNanoseconds
+	case magicPcapng:
+		return nil, errors.New("pcapng is not supported")
+	default:
+		switch binary.BigEndian.Uint32(header) {
+		case magicMicroseconds:
+			reader.order = binary.BigEndian
+		case magicNanoseconds:
+			reader.order = binary.BigEndian
+			reader.nanoseconds = true
+		default:
+			return nil, fmt.Errorf("not a pcap file: magic %#x", magic)
+		}
+	}
+	reader.LinkType = reader.order.Uint32(header[20:]) & 0x0fffffff
+	return reader, nil
+}
+
+// Next returns the next packet. It returns io.EOF at the end of the file, and io.ErrUnexpectedEOF
+// if the last packet is cut off, e.g. because the file was copied while tcpdump was writing it.
+func (r *Reader) Next() (Packet, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		return Packet{}, err
+	}
+	seconds := int64(r.order.Uint32(header))
+	fraction := int64(r.order.Uint32(header[4:]))
+	capturedLength := r.order.Uint32(header[8:])
+	if capturedLength > maxPacketSize {
+		return Packet{}, fmt.Errorf("packet of %d bytes is too large", capturedLength)
+	}
+
+	data := make([]byte, capturedLength)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Packet{}, io.ErrUnexpectedEOF
+		}
+		return Packet{}, err
+	}
+
+	if !r.nanoseconds {
+		fraction *= int64(time.Microsecond)
+	}
+	return Packet{Timestamp: time.Unix(seconds, fraction).UTC(), Data: data}, nil
+}
@@ -0,0 +1,97 @@
+package pcap
+
+import "time"
+
+const (
+	// maxStreamBuffer is the most bytes buffered for a direction of a TCP connection, which is enough for the first
+	// handshake messages of TLS and a few DNS messages.
+	maxStreamBuffer = 64 << 10
+	// maxEarlySegments is the most segments kept for a direction of a TCP connection until the missing data arrives.
+	maxEarlySegments = 64
+)
+
+// tcpStream reassembles the data sent in a direction of a TCP connection.
+// The data is available in buf in order, without retransmissions, until it is consumed.
+type tcpStream struct {
+	started bool
+	next    uint32
+	buf     []byte
+	// bufTime is when the first byte of buf was received.
+	bufTime time.Time
+	// early are the segments received before the missing data, by their sequence numbers.
+	early map[uint32]segment
+	// done stops buffering, e.g. after the TLS handshake messages are read.
+	done bool
+}
+
+// add appends the payload of the segment if it is the next data, and then the early segments which follow it.
+func (s *tcpStream) add(seg segment) {
+	if s.done {
+		return
+	}
+	if seg.Flags&tcpFlagSYN != 0 {
+		s.started = true
+		s.next = seg.Seq + 1
+		return
+	}
+	if len(seg.Payload) == 0 {
+		return
+	}
+	// the capture started in the middle of the connection.
+	if !s.started {
+		s.started = true
+		s.next = seg.Seq
+	}
+
+	s.push(seg)
+	for !s.done {
+		early, ok := s.early[s.next]
+		if !ok {
+			break
+		}
+		delete(s.early, s.next)
+		s.push(early)
+	}
+}
+
+func (s *tcpStream) push(seg segment) {
+	switch diff := int32(seg.Seq - s.next); {
+	case diff > 0:
+		if s.early == nil {
+			s.early = make(map[uint32]segment)
+		}
+		if len(s.early) < maxEarlySegments {
+			s.early[seg.Seq] = seg
+		}
+		return
+	case diff < 0:
+		// a retransmission, which may have new data at the end.
+		if int(-diff) >= len(seg.Payload) {
+			return
+		}
+		seg.Payload = seg.Payload[-diff:]
+	}
+
+	if len(s.buf)+len(seg.Payload) > maxStreamBuffer {
+		s.stop()
+		return
+	}
+	if len(s.buf) == 0 {
+		s.bufTime = seg.Timestamp
+	}
+	s.buf = append(s.buf, seg.Payload...)
+	s.next += uint32(len(seg.Payload))
+}
+
+// consume drops the first n bytes of buf. The rest is regarded as received at now.
+func (s *tcpStream) consume(n int, now time.Time) {
+	s.buf = s.buf[n:]
+	s.bufTime = now
+}
+
+// stop drops the buffered data and ignores the data from now on.
+func (s *tcpStream) stop() {
+	s.done = true
+	s.buf = nil
+	s.early = nil
+}
@@ -0,0 +1,260 @@
+package pcap
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net/netip"
+	"time"
+)
+
+const (
+	recordTypeHandshake = 22
+
+	handshakeTypeClientHello = 1
+	handshakeTypeServerHello = 2
+
+	extensionServerName        = 0
+	extensionALPN              = 16
+	extensionSupportedVersions = 43
+
+	// maxHTTPHeader is the most bytes of the CONNECT request or its response before TLS through a proxy.
+	maxHTTPHeader = 8 << 10
+)
+
+// TLSHandshake is a ClientHello and the ServerHello of a TCP connection.
+type TLSHandshake struct {
+	Client netip.AddrPort
+	Server netip.AddrPort
+	// SYNTime is when the client sent SYN. It is zero if the SYN was not captured.
+	SYNTime time.Time
+	// ClientHelloTime is when the first byte of the ClientHello was received.
+	ClientHelloTime time.Time
+	// SNI is the server name of the ClientHello. It is empty without the extension.
+	SNI string
+	// ALPN are the protocols offered by the client, e.g. h2 and http/1.1.
+	ALPN []string
+	// ClientVersion is the highest version offered by the client, e.g. TLS 1.3.
+	ClientVersion string
+	// ServerHelloTime is when the first byte of the ServerHello was received. It is zero if it was not captured,
+	// and then Version and CipherSuite are empty.
+	ServerHelloTime time.Time
+	// Version is the version selected by the server.
+	Version     string
+	CipherSuite string
+}
+
+// direction is a direction of a TCP connection.
+type direction struct {
+	src netip.AddrPort
+	dst netip.AddrPort
+}
+
+func (d direction) reverse() direction {
+	return direction{src: d.dst, dst: d.src}
+}
+
+// handleTLSStream reads the first handshake message of the direction, which is a ClientHello or a ServerHello.
+// A CONNECT request to a proxy like letsdane, and its response, are skipped before TLS.
+func (a *analyzer) handleTLSStream(s *tcpStream, d direction, now time.Time) {
+	if bytes.HasPrefix(s.buf, []byte("CONNECT ")) || bytes.HasPrefix(s.buf, []byte("HTTP/1.")) {
+		end := bytes.Index(s.buf, []byte("\r\n\r\n"))
+		if end < 0 {
+			if len(s.buf) > maxHTTPHeader {
+				s.stop()
+			}
+			return
+		}
+		s.consume(end+4, now)
+	}
+	if len(s.buf) == 0 {
+		return
+	}
+
+	msg, err := firstHandshakeMessage(s.buf)
+	if errors.Is(err, errNeedMore) {
+		return
+	}
+	at := s.bufTime
+	s.stop()
+	if err != nil {
+		return
+	}
+
+	switch msg[0] {
+	case handshakeTypeClientHello:
+		hello, err := parseClientHello(msg)
+		if err != nil {
+			return
+		}
+		hello.Client = d.src
+		hello.Server = d.dst
+		hello.SYNTime = a.synTimes[d]
+		hello.ClientHelloTime = at
+		a.handshakes[d] = len(a.result.TLS)
+		a.result.TLS = append(a.result.TLS, hello)
+	case handshakeTypeServerHello:
+		i, ok := a.handshakes[d.reverse()]
+		if !ok {
+			return
+		}
+		version, cipherSuite, err := parseServerHello(msg)
+		if err != nil {
+			return
+		}
+		handshake := &a.result.TLS[i]
+		handshake.ServerHelloTime = at
+		handshake.Version = tls.VersionName(version)
+		handshake.CipherSuite = tls.CipherSuiteName(cipherSuite)
+	}
+}
+
+var (
+	errNeedMore  = errors.New("need more data")
+	errNotTLS    = errors.New("not a TLS handshake")
+	errMalformed = errors.New("malformed handshake message")
+)
+
+// firstHandshakeMessage returns the first handshake message in the TLS records at the start of buf,
+// which may span several records.
+func firstHandshakeMessage(buf []byte) ([]byte, error) {
+	var msg []byte
+	for {
+		if len(buf) < 5 {
+			return nil, errNeedMore
+		}
+		if buf[0] != recordTypeHandshake || buf[1] != 3 {
+			return nil, errNotTLS
+		}
+		length := int(buf[3])<<8 | int(buf[4])
+		if len(buf) < 5+length {
+			return nil, errNeedMore
+		}
+		msg = append(msg, buf[5:5+length]...)
+		buf = buf[5+length:]
+		if len(msg) >= 4 {
+			if length := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3]); len(msg) >= 4+length {
+				return msg[:4+length], nil
+			}
+		}
+	}
+}
+
+// byteReader reads the fields of a handshake message. After a read fails, every read returns zero.
+type byteReader struct {
+	b   []byte
+	err bool
+}
+
+func (r *byteReader) bytes(n int) []byte {
+	if r.err || n > len(r.b) {
+		r.err = true
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *byteReader) uint(n int) int {
+	v := 0
+	for _, b := range r.bytes(n) {
+		v = v<<8 | int(b)
+	}
+	return v
+}
+
+// vector reads a field with its length in lengthBytes bytes before it.
+func (r *byteReader) vector(lengthBytes int) []byte {
+	return r.bytes(r.uint(lengthBytes))
+}
+
+// extensions calls f for each extension.
+func (r *byteReader) extensions(f func(extensionType int, data []byte)) {
+	// the extensions are optional in TLS 1.2.
+	if len(r.b) == 0 {
+		return
+	}
+	extensions := &byteReader{b: r.vector(2)}
+	for len(extensions.b) > 0 && !extensions.err {
+		extensionType := extensions.uint(2)
+		data := extensions.vector(2)
+		if !extensions.err {
+			f(extensionType, data)
+		}
+	}
+	if extensions.err {
+		r.err = true
+	}
+}
+
+// isGREASE reports whether the version is a GREASE value of RFC 8701, e.g. 0x0a0a.
+func isGREASE(v int) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func parseClientHello(msg []byte) (TLSHandshake, error) {
+	r := &byteReader{b: msg[4:]}
+	version := r.uint(2)
+	r.bytes(32) // random
+	r.vector(1) // session ID
+	r.vector(2) // cipher suites
+	r.vector(1) // compression methods
+
+	var hello TLSHandshake
+	r.extensions(func(extensionType int, data []byte) {
+		e := &byteReader{b: data}
+		switch extensionType {
+		case extensionServerName:
+			names := &byteReader{b: e.vector(2)}
+			for len(names.b) > 0 && !names.err {
+				nameType := names.uint(1)
+				name := names.vector(2)
+				if nameType == 0 && !names.err {
+					hello.SNI = string(name)
+				}
+			}
+		case extensionALPN:
+			protocols := &byteReader{b: e.vector(2)}
+			for len(protocols.b) > 0 && !protocols.err {
+				if protocol := protocols.vector(1); !protocols.err {
+					hello.ALPN = append(hello.ALPN, string(protocol))
+				}
+			}
+		case extensionSupportedVersions:
+			versions := &byteReader{b: e.vector(1)}
+			for len(versions.b) > 0 && !versions.err {
+				if v := versions.uint(2); !versions.err && !isGREASE(v) && v > version {
+					version = v
+				}
+			}
+		}
+	})
+	if r.err {
+		return TLSHandshake{}, errMalformed
+	}
+	hello.ClientVersion = tls.VersionName(uint16(version))
+	return hello, nil
+}
+
+// parseServerHello returns the selected version and cipher suite. A HelloRetryRequest is also a ServerHello.
+func parseServerHello(msg []byte) (uint16, uint16, error) {
+	r := &byteReader{b: msg[4:]}
+	version := r.uint(2)
+	r.bytes(32) // random
+	r.vector(1) // session ID
+	cipherSuite := r.uint(2)
+	r.uint(1) // compression method
+	r.extensions(func(extensionType int, data []byte) {
+		if extensionType == extensionSupportedVersions {
+			e := &byteReader{b: data}
+			if v := e.uint(2); !e.err {
+				version = v
+			}
+		}
+	})
+	if r.err {
+		return 0, 0, errMalformed
+	}
+	return uint16(version), uint16(cipherSuite), nil
+}
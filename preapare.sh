@@ -2,8 +2,7 @@
 
 prepare_docker_images() {
 	unbound_dir="docker/unbound"
-	unbound_cache_image="unbound:with-cache"
-	unbound_no_cache_image="unbound:without-cache"
+	unbound_image="unbound"
 	letsdane_dir="docker/firefox/letsdane"
 	letsdane_image="letsdane"
 	firefox_har_dir="docker/firefox"
@@ -13,8 +12,7 @@ prepare_docker_images() {
 
 	echo "Building unbound docker image..."
 	cd "$unbound_dir"
-	docker build -t "$unbound_cache_image" -f Dockerfile.unbound-with-cache .
-	docker build -t "$unbound_no_cache_image" -f Dockerfile.unbound-without-cache .
+	docker build -t "$unbound_image" -f Dockerfile.unbound .
 	cd "$OLDPWD"
 
 	echo "Building letsdane docker image..."
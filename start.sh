@@ -12,22 +12,10 @@ inputCSV=../../dataset/hall-of-flame-websites-tlsa-usage3.csv
 
 mkdir -p ../../result/pageloadtime/${measurementID}
 
-echo "Running measurements without cache and without DANE...(1/4)"
-./pageloadtime -subdirname=${measurementID} -inputCSV=${inputCSV} -last=${last} -concurrency=${concurrency} > ../../result/pageloadtime/${measurementID}/without-cache-without-dane.log
-echo "Uplodaing results to S3...(1/4)"
-aws s3 mv ../../result/pageloadtime/${measurementID}/ s3://pageloadtime-results/${measurementID}/ --recursive
-
-echo "Running measurements without cache and with DANE...(2/4)"
-./pageloadtime -subdirname=${measurementID} -inputCSV=${inputCSV} -last=${last}  -concurrency=${concurrency} -dane > ../../result/pageloadtime/${measurementID}/without-cache-with-dane.log
-echo "Uplodaing results to S3...(2/4)"
-aws s3 mv ../../result/pageloadtime/${measurementID}/ s3://pageloadtime-results/${measurementID}/ --recursive
-
-echo "Running measurements with cache and without DANE...(3/4)"
-./pageloadtime -subdirname=${measurementID} -inputCSV=${inputCSV} -last=${last} -concurrency=${concurrency} -cache > ../../result/pageloadtime/${measurementID}/with-cache-without-dane.log
-echo "Uplodaing results to S3...(3/4)"
-aws s3 mv ../../result/pageloadtime/${measurementID}/ s3://pageloadtime-results/${measurementID}/ --recursive
-
-echo "Running measurements with cache and with DANE... (4/4)"
-./pageloadtime -subdirname=${measurementID} -inputCSV=${inputCSV} -last=${last} -concurrency=${concurrency} -cache -dane > ../../result/pageloadtime/${measurementID}/with-cache-with-dane.log
-echo "Uplodaing results to S3...(4/4)"
-aws s3 mv ../../result/pageloadtime/${measurementID}/ s3://pageloadtime-results/${measurementID}/ --recursive
+# All four scenarios are measured back-to-back for each domain.
+echo "Running measurements of all scenarios..."
+# The results are uploaded to S3 by pageloadtime at the end of the measurement.
+./pageloadtime -subdirname=${measurementID} -inputCSV=${inputCSV} -last=${last} -concurrency=${concurrency} -scenarios=all -store=s3://pageloadtime-results -s3-region=ap-northeast-1 > ../../result/pageloadtime/${measurementID}/all-scenarios.log || exit 1
+echo "Uplodaing log to S3..."
+aws s3 mv ../../result/pageloadtime/${measurementID}/all-scenarios.log s3://pageloadtime-results/${measurementID}/all-scenarios.log
+rm -rf ../../result/pageloadtime/${measurementID}
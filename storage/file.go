@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FileStore stores the result files in a local directory.
+type FileStore struct {
+	root string
+}
+
+func NewFileStore(root string) *FileStore {
+	return &FileStore{root: root}
+}
+
+func (s *FileStore) path(key Key) string {
+	return filepath.Join(s.root, filepath.FromSlash(key.Path()))
+}
+
+// Put writes the file via a temporary file, so that a reader never sees a partially written file.
+func (s *FileStore) Put(ctx context.Context, key Key, r io.Reader) error {
+	if err := key.validate(); err != nil {
+		return err
+	}
+	dst := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+key.Name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (s *FileStore) Get(ctx context.Context, key Key) (io.ReadCloser, error) {
+	if err := key.validate(); err != nil {
+		return nil, err
+	}
+	return os.Open(s.path(key))
+}
+
+func (s *FileStore) List(ctx context.Context, filter Filter) ([]Key, error) {
+	root := s.root
+	if filter.MeasurementID != "" {
+		root = filepath.Join(s.root, filter.MeasurementID)
+	}
+
+	var keys []Key
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key, ok := parseKey(filepath.ToSlash(rel))
+		if ok && filter.match(key) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Path() < keys[j].Path()
+	})
+	return keys, nil
+}
+
+func (s *FileStore) String() string {
+	return s.root
+}
+
+func (s *FileStore) MeasurementIDs(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	return ids, nil
+}
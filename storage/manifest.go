@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+// ReadManifest reads the manifest of the measurement.
+func ReadManifest(ctx context.Context, store ResultStore, measurementID string) (utils.Manifest, error) {
+	body, err := store.Get(ctx, Key{MeasurementID: measurementID, Name: utils.ManifestFileName})
+	if err != nil {
+		return utils.Manifest{}, err
+	}
+	defer body.Close()
+	m, err := utils.ReadManifest(body)
+	if err != nil {
+		return utils.Manifest{}, fmt.Errorf("invalid manifest of %s: %w", measurementID, err)
+	}
+	return m, nil
+}
+
+// FinishedMeasurementIDs returns the measurements whose manifest says they finished.
+// The measurements without a manifest, which were run before the manifest was introduced, are returned
+// if includeLegacy is true, and otherwise in skipped, so that the caller can tell them from the unfinished ones.
+func FinishedMeasurementIDs(ctx context.Context, store ResultStore, includeLegacy bool) (finished, skipped []string, err error) {
+	ids, err := store.MeasurementIDs(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, id := range ids {
+		m, err := ReadManifest(ctx, store, id)
+		if errors.Is(err, fs.ErrNotExist) {
+			if includeLegacy {
+				finished = append(finished, id)
+			} else {
+				skipped = append(skipped, id)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if m.Status == utils.ManifestStatusFinished {
+			finished = append(finished, id)
+		}
+	}
+	return finished, skipped, nil
+}
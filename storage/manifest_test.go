@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFinishedMeasurementIDs(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	ctx := context.Background()
+	files := map[Key]string{
+		{MeasurementID: "tokyo-01", Name: "manifest.json"}:                                     `{"measurementID": "tokyo-01", "status": "finished"}`,
+		{MeasurementID: "tokyo-02", Name: "manifest.json"}:                                     `{"measurementID": "tokyo-02", "status": "running"}`,
+		{MeasurementID: "tokyo-03", Name: "manifest.json"}:                                     `{"measurementID": "tokyo-03", "status": "failed"}`,
+		{MeasurementID: "tokyo-v2-01", Name: "pageloadtime-with-cache-with-dane.csv"}:          "domain,pageLoadTime\n",
+		{MeasurementID: "osaka-01", Domain: "example.com", Name: "example.com-with-cache.har"}: "{}",
+		{MeasurementID: "osaka-01", Name: "manifest.json"}:                                     `{"measurementID": "osaka-01", "status": "finished"}`,
+	}
+	for key, body := range files {
+		if err := store.Put(ctx, key, strings.NewReader(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, skipped, err := FinishedMeasurementIDs(ctx, store, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"osaka-01", "tokyo-01"}; !slices.Equal(got, want) {
+		t.Errorf("FinishedMeasurementIDs() = %v, want %v", got, want)
+	}
+	if want := []string{"tokyo-v2-01"}; !slices.Equal(skipped, want) {
+		t.Errorf("FinishedMeasurementIDs() skipped = %v, want %v", skipped, want)
+	}
+
+	// the measurements without a manifest are included in the order of the IDs.
+	got, skipped, err = FinishedMeasurementIDs(ctx, store, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"osaka-01", "tokyo-01", "tokyo-v2-01"}; !slices.Equal(got, want) || len(skipped) != 0 {
+		t.Errorf("FinishedMeasurementIDs() with legacy = %v, %v, want %v", got, skipped, want)
+	}
+
+	if err := store.Put(ctx, Key{MeasurementID: "broken", Name: "manifest.json"}, strings.NewReader("{")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := FinishedMeasurementIDs(ctx, store, false); err == nil {
+		t.Error("FinishedMeasurementIDs() with a broken manifest error = nil")
+	}
+}
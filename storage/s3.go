@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+type customRetryer struct {
+	client.DefaultRetryer
+}
+
+type temporary interface {
+	Temporary() bool
+}
+
+func (r customRetryer) ShouldRetry(req *request.Request) bool {
+	if origErr := req.Error; origErr != nil {
+		switch origErr.(type) {
+		case temporary:
+			if strings.Contains(origErr.Error(), "read: connection reset") {
+				// デフォルトのSDKではリトライしないが、リトライ可にする
+				return true
+			}
+		}
+	}
+	return r.DefaultRetryer.ShouldRetry(req)
+}
+
+// S3Store stores the result files in an S3 bucket or an S3 compatible storage such as MinIO.
+type S3Store struct {
+	svc    s3iface.S3API
+	bucket string
+	// prefix is prepended to the path of every key. e.g. results/ for s3://bucket/results
+	prefix string
+}
+
+// NewS3Store creates the client of S3 from the shared AWS config and the config.
+// If the endpoint is set, the bucket is accessed in path style, which MinIO expects.
+func NewS3Store(cfg Config, bucket, prefix string) (*S3Store, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Profile:           cfg.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	awsCfg := &aws.Config{
+		Retryer: customRetryer{},
+	}
+	if cfg.Region != "" {
+		awsCfg.Region = aws.String(cfg.Region)
+	}
+	if cfg.Endpoint != "" {
+		awsCfg.Endpoint = aws.String(cfg.Endpoint)
+		awsCfg.S3ForcePathStyle = aws.Bool(true)
+	}
+	return newS3StoreWithClient(s3.New(sess, awsCfg), bucket, prefix), nil
+}
+
+func newS3StoreWithClient(svc s3iface.S3API, bucket, prefix string) *S3Store {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3Store{svc: svc, bucket: bucket, prefix: prefix}
+}
+
+func (s *S3Store) objectKey(key Key) string {
+	return s.prefix + key.Path()
+}
+
+// Put uploads the file with multipart upload if it is large, so that r does not need to be seekable.
+func (s *S3Store) Put(ctx context.Context, key Key, r io.Reader) error {
+	if err := key.validate(); err != nil {
+		return err
+	}
+	uploader := s3manager.NewUploaderWithClient(s.svc)
+	_, err := uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.objectKey(key)),
+		Body:   r,
+	})
+	return err
+}
+
+func (s *S3Store) Get(ctx context.Context, key Key) (io.ReadCloser, error) {
+	if err := key.validate(); err != nil {
+		return nil, err
+	}
+	out, err := s.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.objectKey(key)),
+	})
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, fmt.Errorf("s3://%s/%s: %w", s.bucket, s.objectKey(key), fs.ErrNotExist)
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *S3Store) List(ctx context.Context, filter Filter) ([]Key, error) {
+	listPrefix := s.prefix
+	if filter.MeasurementID != "" {
+		listPrefix += filter.MeasurementID + "/"
+		if filter.Domain != "" {
+			listPrefix += filter.Domain + "/"
+		}
+	}
+
+	var keys []Key
+	err := s.svc.ListObjectsPagesWithContext(ctx, &s3.ListObjectsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(listPrefix),
+	}, func(p *s3.ListObjectsOutput, last bool) (shouldContinue bool) {
+		for _, obj := range p.Contents {
+			key, ok := parseKey(strings.TrimPrefix(aws.StringValue(obj.Key), s.prefix))
+			if ok && filter.match(key) {
+				keys = append(keys, key)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list items in bucket %s with prefix %s: %w", s.bucket, listPrefix, err)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Path() < keys[j].Path()
+	})
+	return keys, nil
+}
+
+// String returns the URL of the store.
+func (s *S3Store) String() string {
+	return "s3://" + path.Join(s.bucket, s.prefix)
+}
+
+// MeasurementIDs lists the "directories" under the prefix with the delimiter, so that the files in them are not listed.
+func (s *S3Store) MeasurementIDs(ctx context.Context) ([]string, error) {
+	var ids []string
+	err := s.svc.ListObjectsPagesWithContext(ctx, &s3.ListObjectsInput{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(s.prefix),
+		Delimiter: aws.String("/"),
+	}, func(p *s3.ListObjectsOutput, last bool) (shouldContinue bool) {
+		for _, prefix := range p.CommonPrefixes {
+			ids = append(ids, strings.TrimSuffix(strings.TrimPrefix(aws.StringValue(prefix.Prefix), s.prefix), "/"))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list measurements in bucket %s with prefix %s: %w", s.bucket, s.prefix, err)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,273 @@
+// Package storage stores the results of the measurements, e.g. HAR, pcap and DANE validation result files,
+// in a local directory or an S3 compatible bucket with the same layout:
+//
+//	[measurement ID]/[domain]/[file name]  e.g. tokyo-01/example.com/example.com-with-cache-with-dane.har
+//	[measurement ID]/[file name]           e.g. tokyo-01/pageloadtime-with-cache-with-dane.csv
+package storage
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yagikota/danewebperf/utils"
+)
+
+// ArtifactKind is the kind of a result file, which is decided by its file name.
+type ArtifactKind string
+
+const (
+	// KindHAR is the HAR file of a page load. e.g. example.com-with-cache-with-dane.har
+	KindHAR ArtifactKind = "har"
+	// KindHARCSV is the entries of the HAR file in csv. e.g. example.com-with-cache-with-dane.csv
+	KindHARCSV ArtifactKind = "har-csv"
+	// KindDANEValidation is the DANE validation result of letsdane. e.g. letsdane-example.com-with-cache-with-dane.csv
+	KindDANEValidation ArtifactKind = "dane-validation"
+	// KindPcap is the packets captured in a container. e.g. firefox-example.com-with-cache-with-dane.pcap
+	KindPcap ArtifactKind = "pcap"
+	// KindResources is the resource usage of the containers during a page load.
+	// e.g. resources-example.com-with-cache-with-dane.csv and resources-example.com-with-cache-with-dane-summary.csv
+	KindResources ArtifactKind = "resources"
+	// KindRunResult is a file of the whole measurement, which is not in a domain directory. e.g. pageloadtime-with-cache-with-dane.csv
+	KindRunResult ArtifactKind = "run-result"
+)
+
+// Key identifies a result file.
+type Key struct {
+	// MeasurementID is the ID of the whole measurement, which is -subdirname of pageloadtime. e.g. tokyo-01
+	MeasurementID string
+	// Domain is empty for the files of the whole measurement.
+	Domain string
+	Name   string
+}
+
+// Path returns the slash separated path of the key relative to the root of the store.
+func (k Key) Path() string {
+	if k.Domain == "" {
+		return path.Join(k.MeasurementID, k.Name)
+	}
+	return path.Join(k.MeasurementID, k.Domain, k.Name)
+}
+
+func (k Key) Kind() ArtifactKind {
+	switch {
+	case k.Domain == "":
+		return KindRunResult
+	case strings.HasSuffix(k.Name, ".har"):
+		return KindHAR
+	case strings.HasSuffix(k.Name, ".pcap"):
+		return KindPcap
+	case strings.HasPrefix(k.Name, "letsdane-") && strings.HasSuffix(k.Name, ".csv"):
+		return KindDANEValidation
+	case strings.HasPrefix(k.Name, "resources-") && strings.HasSuffix(k.Name, ".csv"):
+		return KindResources
+	case strings.HasSuffix(k.Name, ".csv"):
+		return KindHARCSV
+	}
+	return ""
+}
+
+// MeasurementName is a measurement of a page, which is read from the name of its result file.
+type MeasurementName struct {
+	Domain string
+	Cache  bool
+	DANE   bool
+	// DNSSEC is false for the measurements with DNSSEC validation disabled in unbound.
+	DNSSEC bool
+	// Resolver is the resolver of letsdane, stub or recursive. It is empty for the scenarios without DANE
+	// and the runs which did not choose it.
+	Resolver string
+	// RepeatVisit is true for the second load of the page in the same Firefox profile.
+	RepeatVisit bool
+	Trial       int
+}
+
+// measurementName matches the name of a measurement, e.g. example.com-with-cache-with-dane-stub-resolver-trial-2.csv.
+// The suffixes after the cache and dane pattern are in the order of the measurement ID of pageloadtime.
+var measurementName = regexp.MustCompile(`^(.+)-(with|without)-cache-(with|without)-dane(-without-dnssec)?(?:-(stub|recursive)-resolver)?(-repeat-visit)?(?:-[a-z0-9]+)?(?:-trial-([0-9]+))?(?:\.[a-z]+)?$`)
+
+// ParseMeasurementName reads the measurement from the name of its result file without the prefix of the kind,
+// e.g. example.com-with-cache-with-dane-trial-2.har. It returns false if name is not of a measurement.
+func ParseMeasurementName(name string) (MeasurementName, bool) {
+	m := measurementName.FindStringSubmatch(name)
+	if m == nil {
+		return MeasurementName{}, false
+	}
+	// the measurements of a single trial have no trial suffix.
+	trial := 1
+	if m[7] != "" {
+		var err error
+		if trial, err = strconv.Atoi(m[7]); err != nil {
+			return MeasurementName{}, false
+		}
+	}
+	return MeasurementName{
+		Domain:      m[1],
+		Cache:       m[2] == "with",
+		DANE:        m[3] == "with",
+		DNSSEC:      m[4] == "",
+		Resolver:    m[5],
+		RepeatVisit: m[6] != "",
+		Trial:       trial,
+	}, true
+}
+
+func (k Key) validate() error {
+	for _, part := range []string{k.MeasurementID, k.Domain, k.Name} {
+		if strings.Contains(part, "/") || part == "." || part == ".." {
+			return fmt.Errorf("invalid key %q: each part must be a file or directory name", k.Path())
+		}
+	}
+	if k.MeasurementID == "" || k.Name == "" {
+		return fmt.Errorf("invalid key %q: measurement ID and name must not be empty", k.Path())
+	}
+	return nil
+}
+
+// parseKey is the inverse of Key.Path. It returns false if the path is not in the layout of the store.
+func parseKey(p string) (Key, bool) {
+	parts := strings.Split(p, "/")
+	switch len(parts) {
+	case 2:
+		return Key{MeasurementID: parts[0], Name: parts[1]}, true
+	case 3:
+		return Key{MeasurementID: parts[0], Domain: parts[1], Name: parts[2]}, true
+	}
+	return Key{}, false
+}
+
+// Filter selects keys to list. Empty fields match any value.
+type Filter struct {
+	MeasurementID string
+	Domain        string
+	Kind          ArtifactKind
+}
+
+func (f Filter) match(k Key) bool {
+	return (f.MeasurementID == "" || f.MeasurementID == k.MeasurementID) &&
+		(f.Domain == "" || f.Domain == k.Domain) &&
+		(f.Kind == "" || f.Kind == k.Kind())
+}
+
+// ResultStore stores the result files.
+// Get returns an error wrapping fs.ErrNotExist if the key does not exist.
+type ResultStore interface {
+	Put(ctx context.Context, key Key, r io.Reader) error
+	Get(ctx context.Context, key Key) (io.ReadCloser, error)
+	List(ctx context.Context, filter Filter) ([]Key, error)
+	// MeasurementIDs returns the IDs of all measurements in the store without listing their files.
+	MeasurementIDs(ctx context.Context) ([]string, error)
+}
+
+// Config is the location of a result store.
+type Config struct {
+	// URL is a directory path, file:///path/to/dir or s3://bucket/prefix.
+	URL string `json:"url" yaml:"url"`
+	// Endpoint is the endpoint of an S3 compatible storage, e.g. http://localhost:9000 for MinIO.
+	// If empty, the endpoint of AWS S3 is used.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	Region   string `json:"region" yaml:"region"`
+	// Profile is the profile of the AWS shared config and credentials files.
+	Profile string `json:"profile" yaml:"profile"`
+}
+
+// RegisterFlags defines the flags of the config, whose default values are the current values of c.
+func (c *Config) RegisterFlags(flags *flag.FlagSet) {
+	flags.StringVar(&c.URL, "store", c.URL, "result store. a directory path or s3://bucket/prefix")
+	flags.StringVar(&c.Endpoint, "s3-endpoint", c.Endpoint, "endpoint of S3 compatible storage (e.g. http://localhost:9000 for MinIO). if empty, AWS S3 is used")
+	flags.StringVar(&c.Region, "s3-region", c.Region, "region of S3")
+	flags.StringVar(&c.Profile, "aws-profile", c.Profile, "profile of AWS shared config")
+}
+
+// New opens the result store of the config.
+func New(cfg Config) (ResultStore, error) {
+	switch {
+	case cfg.URL == "":
+		return nil, errors.New("result store URL is empty")
+	case strings.HasPrefix(cfg.URL, "s3://"):
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(cfg.URL, "s3://"), "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("bucket is empty in %s", cfg.URL)
+		}
+		return NewS3Store(cfg, bucket, prefix)
+	case strings.HasPrefix(cfg.URL, "file://"):
+		return NewFileStore(strings.TrimPrefix(cfg.URL, "file://")), nil
+	case strings.Contains(cfg.URL, "://"):
+		return nil, fmt.Errorf("unsupported result store %s: must be a directory path, file:// or s3://", cfg.URL)
+	}
+	return NewFileStore(cfg.URL), nil
+}
+
+// UploadDir puts all files of the result directory of a measurement, which is in the layout of the store, under the measurement ID.
+// The manifest is put last, so that a reader who finds a finished manifest also finds all the other files.
+func UploadDir(ctx context.Context, store ResultStore, measurementID, dir string) (int, error) {
+	var keys []Key
+	paths := make(map[Key]string)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		key, ok := parseKey(measurementID + "/" + filepath.ToSlash(rel))
+		if !ok {
+			return fmt.Errorf("%s is not in the layout of result store", p)
+		}
+		keys = append(keys, key)
+		paths[key] = p
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	manifestKey := Key{MeasurementID: measurementID, Name: utils.ManifestFileName}
+	slices.SortStableFunc(keys, func(a, b Key) int {
+		return cmpBool(a == manifestKey, b == manifestKey)
+	})
+
+	uploaded := 0
+	for _, key := range keys {
+		if err := putFile(ctx, store, key, paths[key]); err != nil {
+			return uploaded, err
+		}
+		uploaded++
+	}
+	return uploaded, nil
+}
+
+func cmpBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+func putFile(ctx context.Context, store ResultStore, key Key, p string) error {
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := store.Put(ctx, key, file); err != nil {
+		return fmt.Errorf("failed to put %s: %w", key.Path(), err)
+	}
+	return nil
+}
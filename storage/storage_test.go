@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// fakeS3 is a minimal S3 compatible server, which serves the bucket in path style like MinIO.
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = body
+	case r.Method == http.MethodGet && key != "":
+		body, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		w.Write(body)
+	case r.Method == http.MethodGet:
+		type content struct {
+			Key  string
+			Size int
+		}
+		type commonPrefix struct {
+			Prefix string
+		}
+		var result struct {
+			XMLName        xml.Name `xml:"ListBucketResult"`
+			Name           string
+			Prefix         string
+			Delimiter      string
+			IsTruncated    bool
+			Contents       []content
+			CommonPrefixes []commonPrefix
+		}
+		result.Name = f.bucket
+		result.Prefix = r.URL.Query().Get("prefix")
+		result.Delimiter = r.URL.Query().Get("delimiter")
+		prefixes := make(map[string]bool)
+		for k, v := range f.objects {
+			if !strings.HasPrefix(k, result.Prefix) {
+				continue
+			}
+			if i := strings.Index(strings.TrimPrefix(k, result.Prefix), result.Delimiter); result.Delimiter != "" && i >= 0 {
+				prefixes[k[:len(result.Prefix)+i+len(result.Delimiter)]] = true
+				continue
+			}
+			result.Contents = append(result.Contents, content{Key: k, Size: len(v)})
+		}
+		for p := range prefixes {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: p})
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		sort.Slice(result.CommonPrefixes, func(i, j int) bool { return result.CommonPrefixes[i].Prefix < result.CommonPrefixes[j].Prefix })
+		xml.NewEncoder(w).Encode(result)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3Store(t *testing.T, prefix string) (*S3Store, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{bucket: "pageloadtime-results", objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("minioadmin", "minioadmin", ""),
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newS3StoreWithClient(s3.New(sess), fake.bucket, prefix), fake
+}
+
+func TestResultStore(t *testing.T) {
+	s3Store, _ := newTestS3Store(t, "results")
+	stores := map[string]ResultStore{
+		"file": NewFileStore(t.TempDir()),
+		"s3":   s3Store,
+	}
+
+	keys := []Key{
+		{MeasurementID: "tokyo-01", Domain: "example.com", Name: "example.com-with-cache-with-dane.har"},
+		{MeasurementID: "tokyo-01", Domain: "example.com", Name: "example.com-with-cache-with-dane.csv"},
+		{MeasurementID: "tokyo-01", Domain: "example.com", Name: "letsdane-example.com-with-cache-with-dane.csv"},
+		{MeasurementID: "tokyo-01", Domain: "example.org", Name: "letsdane-example.org-with-cache-with-dane.csv"},
+		{MeasurementID: "tokyo-01", Name: "pageloadtime-with-cache-with-dane.csv"},
+		{MeasurementID: "tokyo-02", Domain: "example.com", Name: "letsdane-example.com-with-cache-with-dane.csv"},
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, key := range keys {
+				if err := store.Put(ctx, key, strings.NewReader(key.Path())); err != nil {
+					t.Fatalf("Put(%s) error = %v", key.Path(), err)
+				}
+			}
+
+			body, err := store.Get(ctx, keys[0])
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			got, _ := io.ReadAll(body)
+			body.Close()
+			if string(got) != keys[0].Path() {
+				t.Errorf("Get() = %q, want %q", got, keys[0].Path())
+			}
+
+			if _, err := store.Get(ctx, Key{MeasurementID: "tokyo-01", Domain: "example.com", Name: "missing.har"}); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Get() of missing key error = %v, want fs.ErrNotExist", err)
+			}
+
+			listed, err := store.List(ctx, Filter{MeasurementID: "tokyo-01", Kind: KindDANEValidation})
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if want := []Key{keys[2], keys[3]}; !slices.Equal(listed, want) {
+				t.Errorf("List() = %v, want %v", listed, want)
+			}
+
+			listed, err = store.List(ctx, Filter{Domain: "example.com", Kind: KindDANEValidation})
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if want := []Key{keys[2], keys[5]}; !slices.Equal(listed, want) {
+				t.Errorf("List() = %v, want %v", listed, want)
+			}
+
+			if ids, err := store.MeasurementIDs(ctx); err != nil || !slices.Equal(ids, []string{"tokyo-01", "tokyo-02"}) {
+				t.Errorf("MeasurementIDs() = %v, %v, want [tokyo-01 tokyo-02]", ids, err)
+			}
+
+			if listed, err := store.List(ctx, Filter{MeasurementID: "osaka-01"}); err != nil || len(listed) != 0 {
+				t.Errorf("List() of missing measurement = %v, %v, want none", listed, err)
+			}
+
+			if err := store.Put(ctx, Key{MeasurementID: "tokyo-01", Domain: "..", Name: "a.har"}, strings.NewReader("")); err == nil {
+				t.Error("Put() with .. error = nil")
+			}
+		})
+	}
+}
+
+func TestS3StorePrefix(t *testing.T) {
+	store, fake := newTestS3Store(t, "/results/")
+	key := Key{MeasurementID: "tokyo-01", Domain: "example.com", Name: "example.com-with-cache-with-dane.har"}
+	if err := store.Put(context.Background(), key, strings.NewReader("har")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.objects["results/tokyo-01/example.com/example.com-with-cache-with-dane.har"]; !ok {
+		t.Errorf("objects = %v, want the key under results/", fake.objects)
+	}
+}
+
+func TestKeyKind(t *testing.T) {
+	tests := []struct {
+		key  Key
+		want ArtifactKind
+	}{
+		{Key{MeasurementID: "m", Domain: "example.com", Name: "example.com-with-cache-with-dane.har"}, KindHAR},
+		{Key{MeasurementID: "m", Domain: "example.com", Name: "example.com-with-cache-with-dane.csv"}, KindHARCSV},
+		{Key{MeasurementID: "m", Domain: "example.com", Name: "letsdane-example.com-with-cache-with-dane.csv"}, KindDANEValidation},
+		{Key{MeasurementID: "m", Domain: "example.com", Name: "letsdane-example.com-with-cache-with-dane.pcap"}, KindPcap},
+		{Key{MeasurementID: "m", Domain: "example.com", Name: "resources-example.com-with-cache-with-dane-summary.csv"}, KindResources},
+		{Key{MeasurementID: "m", Name: "journal.jsonl"}, KindRunResult},
+	}
+	for _, tt := range tests {
+		if got := tt.key.Kind(); got != tt.want {
+			t.Errorf("Kind(%s) = %s, want %s", tt.key.Path(), got, tt.want)
+		}
+	}
+}
+
+func TestParseMeasurementName(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   MeasurementName
+		wantOK bool
+	}{
+		{"example.com-with-cache-with-dane.csv", MeasurementName{Domain: "example.com", Cache: true, DANE: true, DNSSEC: true, Trial: 1}, true},
+		{"example.com-without-cache-without-dane-trial-3.csv", MeasurementName{Domain: "example.com", DNSSEC: true, Trial: 3}, true},
+		{"example.com-with-cache-with-dane-without-dnssec-stub-resolver.csv", MeasurementName{Domain: "example.com", Cache: true, DANE: true, Resolver: "stub", Trial: 1}, true},
+		{"example.com-without-cache-with-dane-recursive-resolver-rtt50-trial-2.har", MeasurementName{Domain: "example.com", DANE: true, DNSSEC: true, Resolver: "recursive", Trial: 2}, true},
+		{"www.example.com-with-cache-without-dane-repeat-visit-trial-2.csv", MeasurementName{Domain: "www.example.com", Cache: true, DNSSEC: true, RepeatVisit: true, Trial: 2}, true},
+		{"example.com-with-cache-with-dane", MeasurementName{Domain: "example.com", Cache: true, DANE: true, DNSSEC: true, Trial: 1}, true},
+		{"manifest.json", MeasurementName{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseMeasurementName(tt.name)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParseMeasurementName(%q) = %+v, %t, want %+v, %t", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestUploadDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, p := range []string{"manifest.json", "pageloadtime-with-cache-with-dane.csv", "example.com/example.com-with-cache-with-dane.har"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, p)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, p), []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := &recordingStore{ResultStore: NewFileStore(t.TempDir())}
+	n, err := UploadDir(context.Background(), store, "tokyo-01", dir)
+	if err != nil || n != 3 {
+		t.Fatalf("UploadDir() = %d, %v, want 3", n, err)
+	}
+	keys, err := store.List(context.Background(), Filter{MeasurementID: "tokyo-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Key{
+		{MeasurementID: "tokyo-01", Domain: "example.com", Name: "example.com-with-cache-with-dane.har"},
+		{MeasurementID: "tokyo-01", Name: "manifest.json"},
+		{MeasurementID: "tokyo-01", Name: "pageloadtime-with-cache-with-dane.csv"},
+	}
+	if !slices.Equal(keys, want) {
+		t.Errorf("List() = %v, want %v", keys, want)
+	}
+	if last := store.puts[len(store.puts)-1]; last.Name != "manifest.json" {
+		t.Errorf("last Put() = %s, want manifest.json", last.Path())
+	}
+}
+
+// recordingStore records the order of Put.
+type recordingStore struct {
+	ResultStore
+	puts []Key
+}
+
+func (s *recordingStore) Put(ctx context.Context, key Key, r io.Reader) error {
+	s.puts = append(s.puts, key)
+	return s.ResultStore.Put(ctx, key, r)
+}
+
+func TestNew(t *testing.T) {
+	if store, err := New(Config{URL: "s3://pageloadtime-results/prefix", Region: "ap-northeast-1"}); err != nil {
+		t.Errorf("New(s3) error = %v", err)
+	} else if s, ok := store.(*S3Store); !ok || s.bucket != "pageloadtime-results" || s.prefix != "prefix/" {
+		t.Errorf("New(s3) = %+v", store)
+	}
+	if store, err := New(Config{URL: "file:///tmp/result"}); err != nil {
+		t.Errorf("New(file) error = %v", err)
+	} else if s, ok := store.(*FileStore); !ok || s.root != "/tmp/result" {
+		t.Errorf("New(file) = %+v", store)
+	}
+	for _, url := range []string{"", "s3://", "gs://bucket"} {
+		if _, err := New(Config{URL: url}); err == nil {
+			t.Errorf("New(%q) error = nil", url)
+		}
+	}
+}
@@ -1,17 +1,83 @@
 package utils
 
 import (
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 type DomainList []Record
 
+// Record is a row of a domain list. A row is a domain or a URL, optionally followed by tags separated by ";".
+//
+// e.g.
+//
+//	example.com
+//	https://example.com/news/,inner;news
 type Record struct {
+	// Domain is the host name of URL for a row with a URL.
 	Domain string
+	// URL is empty for a row with only a domain, which means https://[domain].
+	URL  string
+	Tags []string
+	// Metadata is the extra columns of a dataset with a header. See ReadDataset.
+	Metadata Metadata
 }
 
+// TargetURL returns the URL of the page to measure.
+func (r Record) TargetURL() string {
+	if r.URL == "" {
+		return "https://" + r.Domain
+	}
+	return r.URL
+}
+
+// maxSlugLength keeps the file and container names which contain the slug in the limits of file systems.
+const maxSlugLength = 100
+
+var slugUnsafe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// Slug returns a name of the page which can be used as a directory, file or container name.
+// It is the domain for a row with only a domain or the top page of https://[domain], so that the results of
+// domain lists keep the same layout, and otherwise the domain followed by the port, path and query. e.g.
+//
+//	https://example.com/news/?page=2 -> example.com_news_page_2
+//
+// A long slug is truncated and ends with the hash of the URL, so that it is still unique.
+func (r Record) Slug() string {
+	u, err := url.Parse(r.URL)
+	if r.URL == "" || err != nil {
+		return r.Domain
+	}
+	slug := strings.ToLower(u.Hostname())
+	if u.Port() != "" {
+		slug += "_" + u.Port()
+	}
+	rest := strings.Trim(u.Path, "/")
+	if u.RawQuery != "" {
+		rest += "?" + u.RawQuery
+	}
+	if rest = strings.Trim(slugUnsafe.ReplaceAllString(rest, "_"), "_"); rest != "" {
+		slug += "_" + rest
+	}
+	if len(slug) > maxSlugLength {
+		sum := sha256.Sum256([]byte(r.URL))
+		slug = slug[:maxSlugLength-9] + "_" + hex.EncodeToString(sum[:4])
+	}
+	return slug
+}
+
+// ReadDomainListCSV reads a domain list. The first column of each row is a domain or an http(s) URL,
+// and the second column, if any, is the tags separated by ";". The other columns are ignored.
+// Every row is a record as it is. ReadDataset also skips the header, comments and duplicates.
 func ReadDomainListCSV(path string) (DomainList, error) {
 	var domainList DomainList
 	file, err := os.Open(path)
@@ -20,18 +86,51 @@ func ReadDomainListCSV(path string) (DomainList, error) {
 	}
 	defer file.Close()
 	reader := csv.NewReader(file)
+	// the tags are optional, so the number of columns can differ by row.
+	reader.FieldsPerRecord = -1
 	rows, err := reader.ReadAll()
 	if err != nil {
 		return domainList, err
 	}
-	for _, row := range rows {
-		domainList = append(domainList, Record{
-			Domain: row[0],
-		})
+	for i, row := range rows {
+		record, err := parseDomainListRow(row)
+		if err != nil {
+			return nil, fmt.Errorf("%s: row %d: %w", path, i+1, err)
+		}
+		domainList = append(domainList, record)
 	}
 	return domainList, nil
 }
 
+func parseDomainListRow(row []string) (Record, error) {
+	record := Record{Domain: row[0]}
+	if strings.Contains(row[0], "://") {
+		u, err := url.Parse(row[0])
+		if err != nil {
+			return Record{}, err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return Record{}, fmt.Errorf("invalid URL %q: must be http:// or https:// with a host", row[0])
+		}
+		record = Record{Domain: u.Hostname(), URL: row[0]}
+	}
+	if len(row) > 1 {
+		record.Tags = parseTags(row[1])
+	}
+	return record, nil
+}
+
+// parseTags splits the tags separated by ";".
+func parseTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ";") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
 func WriteDomainListCSV(path string, domainList DomainList) error {
 	file, err := os.Create(path)
 	if err != nil {
@@ -43,8 +142,14 @@ func WriteDomainListCSV(path string, domainList DomainList) error {
 	defer writer.Flush()
 
 	for _, record := range domainList {
-		record := []string{record.Domain}
-		if err := writer.Write(record); err != nil {
+		row := []string{record.Domain}
+		if record.URL != "" {
+			row[0] = record.URL
+		}
+		if len(record.Tags) > 0 {
+			row = append(row, strings.Join(record.Tags, ";"))
+		}
+		if err := writer.Write(row); err != nil {
 			return err
 		}
 	}
@@ -52,7 +157,60 @@ func WriteDomainListCSV(path string, domainList DomainList) error {
 	return nil
 }
 
+// PageLoadTimeRecord is a row of pageloadtime-*.csv.
+type PageLoadTimeRecord struct {
+	// Domain is the slug of the page, which is the domain for a row of a domain list with only a domain. See Record.Slug.
+	Domain string
+	// URL is the measured page, and Tags are the tags of the row of the domain list separated by ";".
+	URL  string
+	Tags string
+	// PageLoadTime is onLoad of the first page in milliseconds. It is empty if the measurement failed.
+	PageLoadTime string
+	Cache        bool
+	Dane         bool
+	// WithoutDNSSEC is true if DNSSEC validation was disabled in the resolver. It is written as dnssec_validation false.
+	WithoutDNSSEC bool
+	// Resolver is the resolver of letsdane, stub or recursive. It is empty if the arguments of letsdane decided it.
+	Resolver string
+	// RepeatVisit is true if the second load of the page in the same browser profile was measured.
+	RepeatVisit bool
+	// Impairment is the name of the network impairment profile. It is empty without impairment.
+	Impairment string
+	// Trial is the index of the trial starting from 1.
+	Trial int
+	// FailureReason is why the measurement failed, e.g. browser-timeout. It is empty if the measurement succeeded.
+	FailureReason string
+	// HostSaturated is true if the CPU of the host was saturated while loading the page, which may inflate PageLoadTime.
+	HostSaturated bool
+	// Attempt is the attempt of the measurement which produced the row, starting from 1. It is more than 1 for a row
+	// measured again by -retry-from. 0 is written as 1.
+	Attempt int
+}
+
 func WritePageLoadTimeCSV(path string, domainPageLoadMap map[string]string, cache, dane bool) error {
+	domains := make([]string, 0, len(domainPageLoadMap))
+	for domain := range domainPageLoadMap {
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		return domains[i] < domains[j]
+	})
+
+	records := make([]PageLoadTimeRecord, 0, len(domains))
+	for _, domain := range domains {
+		records = append(records, PageLoadTimeRecord{
+			Domain:       domain,
+			PageLoadTime: domainPageLoadMap[domain],
+			Cache:        cache,
+			Dane:         dane,
+			Trial:        1,
+		})
+	}
+	return WritePageLoadTimeRecordsCSV(path, records)
+}
+
+// WritePageLoadTimeRecordsCSV writes records in the given order, so that several scenarios can be written into one table.
+func WritePageLoadTimeRecordsCSV(path string, records []PageLoadTimeRecord) error {
 	file, err := os.Create(path)
 	if err != nil {
 		return err
@@ -62,25 +220,155 @@ func WritePageLoadTimeCSV(path string, domainPageLoadMap map[string]string, cach
 	writer := csv.NewWriter(file)
 	defer writer.Flush()
 
-	if err := writer.Write([]string{"domain", "pageLoadTime", "cache", "dane"}); err != nil {
+	if err := writer.Write(pageLoadTimeHeader); err != nil {
 		return err
 	}
 
-	domains := make([]string, 0, len(domainPageLoadMap))
-	for domain := range domainPageLoadMap {
-		domains = append(domains, domain)
+	for _, r := range records {
+		record := []string{r.Domain, r.PageLoadTime, strconv.FormatBool(r.Cache), strconv.FormatBool(r.Dane), strconv.Itoa(r.Trial), r.FailureReason, r.Impairment, r.URL, r.Tags, strconv.FormatBool(r.HostSaturated), strconv.FormatBool(!r.WithoutDNSSEC), r.Resolver, strconv.FormatBool(r.RepeatVisit), strconv.Itoa(max(r.Attempt, 1))}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
 	}
-	sort.Slice(domains, func(i, j int) bool {
-		return domains[i] < domains[j]
-	})
 
-	for _, domain := range domains {
-		record := []string{domain, domainPageLoadMap[domain], "false", "false"}
-		if cache {
-			record[2] = "true"
+	return nil
+}
+
+// pageLoadTimeHeader is the header of pageloadtime-*.csv. The columns were added at the end over time.
+var pageLoadTimeHeader = []string{"domain", "pageLoadTime", "cache", "dane", "trial", "failure_reason", "impairment", "url", "tags", "host_saturated", "dnssec_validation", "letsdane_resolver", "repeat_visit", "attempt"}
+
+// ReadPageLoadTimeRecordsCSV reads pageloadtime-*.csv by the names of the columns, so that the files written before
+// a column was added can be read. A missing column has its default: no failure reason, DNSSEC validation, the first trial and attempt.
+func ReadPageLoadTimeRecordsCSV(path string) ([]PageLoadTimeRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	// the rows of the older files have fewer columns.
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	for _, name := range []string{"domain", "pageLoadTime", "cache", "dane"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%s has no %s column", path, name)
+		}
+	}
+
+	records := make([]PageLoadTimeRecord, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		value := func(name string) string {
+			if j, ok := columns[name]; ok && j < len(row) {
+				return row[j]
+			}
+			return ""
+		}
+		var errs []error
+		boolValue := func(name string, def bool) bool {
+			v := value(name)
+			if v == "" {
+				return def
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			return b
 		}
-		if dane {
-			record[3] = "true"
+		intValue := func(name string) int {
+			v := value(name)
+			if v == "" {
+				return 1
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			return n
+		}
+
+		record := PageLoadTimeRecord{
+			Domain:        value("domain"),
+			URL:           value("url"),
+			Tags:          value("tags"),
+			PageLoadTime:  value("pageLoadTime"),
+			Cache:         boolValue("cache", false),
+			Dane:          boolValue("dane", false),
+			WithoutDNSSEC: !boolValue("dnssec_validation", true),
+			Resolver:      value("letsdane_resolver"),
+			RepeatVisit:   boolValue("repeat_visit", false),
+			Impairment:    value("impairment"),
+			Trial:         intValue("trial"),
+			FailureReason: value("failure_reason"),
+			HostSaturated: boolValue("host_saturated", false),
+			Attempt:       intValue("attempt"),
+		}
+		if err := errors.Join(errs...); err != nil {
+			return nil, fmt.Errorf("row %d of %s: %w", i+2, path, err)
+		}
+		if record.Domain == "" {
+			return nil, fmt.Errorf("row %d of %s: domain is empty", i+2, path)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// PageLoadTimeSummary is the statistics of the page load time of a domain over trials.
+type PageLoadTimeSummary struct {
+	Domain string
+	Cache  bool
+	Dane   bool
+	// Trials is the number of trials and Success is the number of trials which have a valid page load time.
+	Trials  int
+	Success int
+	// the statistics below are in milliseconds and only valid if Success > 0.
+	Median float64
+	Mean   float64
+	StdDev float64
+	Min    float64
+	Max    float64
+	IQR    float64
+}
+
+func WritePageLoadTimeSummaryCSV(path string, summaries []PageLoadTimeSummary) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"domain", "cache", "dane", "trials", "success", "median", "mean", "stddev", "min", "max", "iqr"}); err != nil {
+		return err
+	}
+
+	formatFloat := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+	for _, s := range summaries {
+		record := []string{s.Domain, strconv.FormatBool(s.Cache), strconv.FormatBool(s.Dane), strconv.Itoa(s.Trials), strconv.Itoa(s.Success), "", "", "", "", "", ""}
+		if s.Success > 0 {
+			record[5] = formatFloat(s.Median)
+			record[6] = formatFloat(s.Mean)
+			record[7] = formatFloat(s.StdDev)
+			record[8] = formatFloat(s.Min)
+			record[9] = formatFloat(s.Max)
+			record[10] = formatFloat(s.IQR)
 		}
 		if err := writer.Write(record); err != nil {
 			return err
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadDomainListCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.csv")
+	content := "example.com\nhttps://example.com/news/?page=2,inner;news\nhttp://example.org:8080/\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadDomainListCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		domain, targetURL, slug string
+		tags                    []string
+	}{
+		{"example.com", "https://example.com", "example.com", nil},
+		{"example.com", "https://example.com/news/?page=2", "example.com_news_page_2", []string{"inner", "news"}},
+		{"example.org", "http://example.org:8080/", "example.org_8080", nil},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ReadDomainListCSV() = %+v, want %d records", got, len(want))
+	}
+	for i, w := range want {
+		r := got[i]
+		if r.Domain != w.domain || r.TargetURL() != w.targetURL || r.Slug() != w.slug || !slices.Equal(r.Tags, w.tags) {
+			t.Errorf("record %d = %+v (url %s, slug %s), want %+v", i, r, r.TargetURL(), r.Slug(), w)
+		}
+	}
+
+	// a written domain list is read back to the same records.
+	written := filepath.Join(t.TempDir(), "written.csv")
+	if err := WriteDomainListCSV(written, got); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := os.ReadFile(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != content {
+		t.Errorf("WriteDomainListCSV() = %q, want %q", buf, content)
+	}
+}
+
+func TestReadDomainListCSVInvalidURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.csv")
+	if err := os.WriteFile(path, []byte("example.com\nftp://example.com/file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadDomainListCSV(path); err == nil || !strings.Contains(err.Error(), "row 2") {
+		t.Errorf("ReadDomainListCSV() error = %v, want an error of row 2", err)
+	}
+}
+
+func TestRecordSlugLong(t *testing.T) {
+	a := Record{Domain: "example.com", URL: "https://example.com/" + strings.Repeat("a", 200)}
+	b := Record{Domain: "example.com", URL: "https://example.com/" + strings.Repeat("a", 199) + "b"}
+	if len(a.Slug()) != maxSlugLength {
+		t.Errorf("len(Slug()) = %d, want %d", len(a.Slug()), maxSlugLength)
+	}
+	if a.Slug() == b.Slug() {
+		t.Errorf("Slug() of different URLs = %s, want different slugs", a.Slug())
+	}
+}
+
+func TestReadPageLoadTimeRecordsCSV(t *testing.T) {
+	dir := t.TempDir()
+	records := []PageLoadTimeRecord{
+		{Domain: "example.com", URL: "https://example.com", PageLoadTime: "1200", Cache: true, Dane: true, Trial: 1, Attempt: 1},
+		{Domain: "example.org", URL: "https://example.org", Tags: "inner;news", Dane: true, WithoutDNSSEC: true, Resolver: "stub", RepeatVisit: true, Impairment: "rtt50", Trial: 2, FailureReason: "browser-timeout", HostSaturated: true, Attempt: 3},
+	}
+	path := filepath.Join(dir, "pageloadtime-scenarios.csv")
+	if err := WritePageLoadTimeRecordsCSV(path, records); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadPageLoadTimeRecordsCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, records) {
+		t.Errorf("ReadPageLoadTimeRecordsCSV() = %+v, want %+v", got, records)
+	}
+
+	// a file written before the columns were added has their defaults.
+	old := filepath.Join(dir, "pageloadtime-with-cache-with-dane.csv")
+	if err := os.WriteFile(old, []byte("domain,pageLoadTime,cache,dane\nexample.com,,true,true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = ReadPageLoadTimeRecordsCSV(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []PageLoadTimeRecord{{Domain: "example.com", Cache: true, Dane: true, Trial: 1, Attempt: 1}}; !slices.Equal(got, want) {
+		t.Errorf("ReadPageLoadTimeRecordsCSV() = %+v, want %+v", got, want)
+	}
+
+	if err := os.WriteFile(old, []byte("domain,pageLoadTime,cache,dane\nexample.com,,yes,true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPageLoadTimeRecordsCSV(old); err == nil || !strings.Contains(err.Error(), "row 2") {
+		t.Errorf("ReadPageLoadTimeRecordsCSV() error = %v, want an error of row 2", err)
+	}
+}
@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Dataset is a domain list read by ReadDataset.
+type Dataset struct {
+	Records DomainList
+	// Columns are the names of the columns of Record.Metadata in the order of the header. It is empty without a header.
+	Columns []string
+	// Rejected are the rows which are not in Records, in the order of the file.
+	Rejected []RejectedRow
+}
+
+// RejectedRow is a row of a dataset which is not measured.
+type RejectedRow struct {
+	// Line is the 1-based line number of the row in the file.
+	Line   int
+	Value  string
+	Reason string
+}
+
+func (r RejectedRow) String() string {
+	return fmt.Sprintf("line %d (%q): %s", r.Line, r.Value, r.Reason)
+}
+
+// Metadata is the extra columns of a row by the names in the header.
+type Metadata map[string]string
+
+// Get returns the value of the column. It is empty if the row has no such column.
+func (m Metadata) Get(name string) string {
+	return m[name]
+}
+
+// Int parses the value of the column as an integer.
+func (m Metadata) Int(name string) (int, error) {
+	v, ok := m[name]
+	if !ok {
+		return 0, fmt.Errorf("no column %s", name)
+	}
+	return strconv.Atoi(v)
+}
+
+// Float parses the value of the column as a floating point number.
+func (m Metadata) Float(name string) (float64, error) {
+	v, ok := m[name]
+	if !ok {
+		return 0, fmt.Errorf("no column %s", name)
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// Bool parses the value of the column as a boolean, e.g. true, false, 1 or 0.
+func (m Metadata) Bool(name string) (bool, error) {
+	v, ok := m[name]
+	if !ok {
+		return false, fmt.Errorf("no column %s", name)
+	}
+	return strconv.ParseBool(v)
+}
+
+// headerNames are the names of the first column which make the first row a header.
+var headerNames = map[string]bool{"domain": true, "url": true, "website": true, "site": true, "host": true}
+
+// ReadDataset reads a domain list more strictly than ReadDomainListCSV:
+//
+//   - the first row is a header if its first column is domain, url, website, site or host (e.g. domain,ip).
+//     Then the column named tags is Record.Tags, and the other columns are Record.Metadata.
+//     Without a header, the second column is the tags as in ReadDomainListCSV.
+//   - lines starting with # are comments, and the spaces around values are trimmed.
+//   - domains are normalized to lower case punycode, e.g. Bücher.example is xn--bcher-kva.example.
+//   - invalid domains and URLs, and the pages with the same slug as a previous row are rejected with their line numbers.
+func ReadDataset(path string) (*Dataset, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dataset, err := parseDataset(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return dataset, nil
+}
+
+func parseDataset(r io.Reader) (*Dataset, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	dataset := &Dataset{}
+	var header []string
+	lines := make(map[string]int)
+	first := true
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			dataset.Rejected = append(dataset.Rejected, RejectedRow{Line: parseErr.StartLine, Reason: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+		}
+
+		if first {
+			first = false
+			if headerNames[strings.ToLower(row[0])] {
+				header = row
+				dataset.Columns = metadataColumns(header)
+				continue
+			}
+		}
+
+		record, err := datasetRecord(row, header)
+		if err != nil {
+			dataset.Rejected = append(dataset.Rejected, RejectedRow{Line: line, Value: row[0], Reason: err.Error()})
+			continue
+		}
+		slug := record.Slug()
+		if previous, ok := lines[slug]; ok {
+			dataset.Rejected = append(dataset.Rejected, RejectedRow{Line: line, Value: row[0], Reason: fmt.Sprintf("duplicate of line %d", previous)})
+			continue
+		}
+		lines[slug] = line
+		dataset.Records = append(dataset.Records, record)
+	}
+	return dataset, nil
+}
+
+func metadataColumns(header []string) []string {
+	var columns []string
+	for _, name := range header[1:] {
+		if name != "tags" {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+// datasetRecord parses a row of the dataset with the header, which is nil without a header.
+func datasetRecord(row, header []string) (Record, error) {
+	record, err := parseDomainListRow(row[:1])
+	if err != nil {
+		return Record{}, err
+	}
+	if err := normalizeRecord(&record); err != nil {
+		return Record{}, err
+	}
+
+	if header == nil {
+		if len(row) > 1 {
+			record.Tags = parseTags(row[1])
+		}
+		return record, nil
+	}
+	for i := 1; i < len(header) && i < len(row); i++ {
+		if header[i] == "tags" {
+			record.Tags = parseTags(row[i])
+			continue
+		}
+		if record.Metadata == nil {
+			record.Metadata = make(Metadata)
+		}
+		record.Metadata[header[i]] = row[i]
+	}
+	return record, nil
+}
+
+// normalizeRecord converts the domain, and the host of the URL, to lower case punycode.
+func normalizeRecord(record *Record) error {
+	if record.Domain == "" {
+		return errors.New("domain is empty")
+	}
+	domain, err := normalizeDomain(record.Domain)
+	if err != nil {
+		return err
+	}
+	record.Domain = domain
+	if record.URL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(record.URL)
+	if err != nil {
+		return err
+	}
+	if u.Port() != "" {
+		u.Host = net.JoinHostPort(domain, u.Port())
+	} else {
+		u.Host = domain
+	}
+	record.URL = u.String()
+	return nil
+}
+
+// domainProfile is idna.Lookup which also rejects empty labels and too long names.
+var domainProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.VerifyDNSLength(true))
+
+func normalizeDomain(domain string) (string, error) {
+	ascii, err := domainProfile.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil {
+		return "", fmt.Errorf("invalid domain %q: %w", domain, err)
+	}
+	if !strings.Contains(ascii, ".") {
+		return "", fmt.Errorf("invalid domain %q: must have two or more labels", domain)
+	}
+	return ascii, nil
+}
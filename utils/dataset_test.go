@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDataset(t *testing.T) {
+	input := strings.Join([]string{
+		"domain,ip,rank,tags",
+		"# comment",
+		"  Example.COM. , 192.0.2.1, 1, top",
+		"bücher.example,192.0.2.2,2,",
+		"example.com,192.0.2.3,3,",
+		"localhost,127.0.0.1,4,",
+		"https://Example.com:8443/news,192.0.2.4,5,inner;news",
+		"bad..example,192.0.2.5,6,",
+		"",
+	}, "\n")
+	dataset, err := parseDataset(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var targets []string
+	for _, r := range dataset.Records {
+		targets = append(targets, r.TargetURL())
+	}
+	wantTargets := []string{"https://example.com", "https://xn--bcher-kva.example", "https://example.com:8443/news"}
+	if !slices.Equal(targets, wantTargets) {
+		t.Errorf("records = %q, want %q", targets, wantTargets)
+	}
+	if !slices.Equal(dataset.Columns, []string{"ip", "rank"}) {
+		t.Errorf("columns = %q, want [ip rank]", dataset.Columns)
+	}
+
+	first := dataset.Records[0]
+	if first.Metadata.Get("ip") != "192.0.2.1" || !slices.Equal(first.Tags, []string{"top"}) {
+		t.Errorf("record = %+v, want ip 192.0.2.1 and tag top", first)
+	}
+	if rank, err := first.Metadata.Int("rank"); err != nil || rank != 1 {
+		t.Errorf("rank = %d, %v, want 1", rank, err)
+	}
+	if _, err := first.Metadata.Int("missing"); err == nil {
+		t.Error("Int(missing) error = nil, want an error")
+	}
+	if deep := dataset.Records[2]; deep.Domain != "example.com" || deep.Slug() != "example.com_8443_news" {
+		t.Errorf("record = %+v (slug %s), want domain example.com and slug example.com_8443_news", deep, deep.Slug())
+	}
+
+	var lines []int
+	for _, r := range dataset.Rejected {
+		lines = append(lines, r.Line)
+	}
+	if !slices.Equal(lines, []int{5, 6, 8}) {
+		t.Errorf("rejected = %v, want lines 5, 6 and 8", dataset.Rejected)
+	}
+	if reason := dataset.Rejected[0].Reason; reason != "duplicate of line 3" {
+		t.Errorf("reason = %s, want duplicate of line 3", reason)
+	}
+}
+
+func TestParseDatasetWithoutHeader(t *testing.T) {
+	input := "example.com\nexample.org,news\n\"broken\n"
+	dataset, err := parseDataset(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dataset.Records) != 2 || dataset.Columns != nil {
+		t.Fatalf("dataset = %+v, want 2 records without columns", dataset)
+	}
+	if !slices.Equal(dataset.Records[1].Tags, []string{"news"}) {
+		t.Errorf("tags = %q, want [news]", dataset.Records[1].Tags)
+	}
+	if len(dataset.Rejected) != 1 || dataset.Rejected[0].Line != 3 {
+		t.Errorf("rejected = %v, want line 3", dataset.Rejected)
+	}
+}
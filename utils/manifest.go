@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestFileName is the file in the result directory of a measurement which records how the measurement was run.
+const ManifestFileName = "manifest.json"
+
+const (
+	ManifestStatusRunning  = "running"
+	ManifestStatusFinished = "finished"
+	ManifestStatusFailed   = "failed"
+	// ManifestStatusInterrupted means the measurement was stopped by a signal and can be resumed.
+	ManifestStatusInterrupted = "interrupted"
+)
+
+// Manifest is written by pageloadtime at the start and the end of a measurement.
+type Manifest struct {
+	MeasurementID string     `json:"measurementID"`
+	Status        string     `json:"status"`
+	StartedAt     time.Time  `json:"startedAt"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+	// Error is the reason why the measurement failed.
+	Error string `json:"error,omitempty"`
+	// Args are the command line arguments of pageloadtime.
+	Args      []string      `json:"args"`
+	Host      ManifestHost  `json:"host"`
+	Build     ManifestBuild `json:"build"`
+	Scenarios []string      `json:"scenarios"`
+	// Experiment is the experiment definition after the flags are applied.
+	Experiment json.RawMessage `json:"experiment"`
+	// Images are the images used by the measurement. The key is the role, e.g. unboundWithCache.
+	Images map[string]ManifestImage `json:"images"`
+	// LetsdaneResolvers are the resolvers of letsdane, stub or recursive, by the scenarios with DANE.
+	LetsdaneResolvers map[string]string `json:"letsdaneResolvers,omitempty"`
+	// Counts is set at the end of the measurement.
+	Counts *ManifestCounts `json:"counts,omitempty"`
+}
+
+type ManifestHost struct {
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	NumCPU   int    `json:"numCPU"`
+	// Region is AWS_REGION or AWS_DEFAULT_REGION of the environment.
+	Region string `json:"region,omitempty"`
+}
+
+type ManifestBuild struct {
+	GoVersion   string `json:"goVersion"`
+	Path        string `json:"path"`
+	Version     string `json:"version"`
+	VCSRevision string `json:"vcsRevision,omitempty"`
+	VCSTime     string `json:"vcsTime,omitempty"`
+	VCSModified bool   `json:"vcsModified,omitempty"`
+}
+
+type ManifestImage struct {
+	Name        string            `json:"name"`
+	ID          string            `json:"id,omitempty"`
+	RepoDigests []string          `json:"repoDigests,omitempty"`
+	Created     string            `json:"created,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// Error is set if the image could not be inspected.
+	Error string `json:"error,omitempty"`
+}
+
+type ManifestCounts struct {
+	Domains int `json:"domains"`
+	// Planned is the number of measurements of this run, which does not include the ones finished before resuming.
+	Planned   int                      `json:"planned"`
+	Success   int                      `json:"success"`
+	Failed    int                      `json:"failed"`
+	Scenarios []ManifestScenarioCounts `json:"scenarios"`
+}
+
+type ManifestScenarioCounts struct {
+	Scenario string `json:"scenario"`
+	Planned  int    `json:"planned"`
+	Success  int    `json:"success"`
+	Failed   int    `json:"failed"`
+}
+
+func ReadManifest(r io.Reader) (Manifest, error) {
+	var m Manifest
+	err := json.NewDecoder(r).Decode(&m)
+	return m, err
+}
+
+// WriteManifest replaces the manifest file at once, so that a reader never sees a partially written manifest.
+func WriteManifest(path string, m Manifest) error {
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, append(buf, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}